@@ -0,0 +1,159 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// ActionsGroupAttribute holds the title of the `::group::` a github actions log line was written in.
+const ActionsGroupAttribute = "group"
+
+var (
+	// actionsTimestamp matches the timestamp prefixed to the lines of downloaded workflow logs.
+	actionsTimestamp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?Z) `)
+	// actionsCommand matches a `::command key=value,...::message` workflow command.
+	actionsCommand = regexp.MustCompile(`^::([a-z-]+)(?: ([^:]*))?::(.*)$`)
+	// actionsLogCommand matches the `##[command]message` form commands are rendered as in downloaded logs.
+	actionsLogCommand = regexp.MustCompile(`^##\[([a-z]+)\](.*)$`)
+)
+
+var (
+	actionsDataEscapes     = strings.NewReplacer("%0D", "\r", "%0A", "\n", "%25", "%")
+	actionsPropertyEscapes = strings.NewReplacer("%0D", "\r", "%0A", "\n", "%3A", ":", "%2C", ",", "%25", "%")
+)
+
+// actionsProperties maps the properties of an annotation command to log attributes.
+var actionsProperties = map[string]string{
+	"file":      string(semconv.CodeFilepathKey),
+	"line":      string(semconv.CodeLineNumberKey),
+	"col":       string(semconv.CodeColumnKey),
+	"endLine":   "code.end_lineno",
+	"endColumn": "code.end_column",
+	"title":     "title",
+}
+
+func actionsLevel(command string) (string, bool) {
+	switch command {
+	case "error":
+		return model.LogLevelError.String(), true
+	case "warning":
+		return model.LogLevelWarn.String(), true
+	case "notice":
+		return model.LogLevelInfo.String(), true
+	case "debug":
+		return model.LogLevelDebug.String(), true
+	}
+	return "", false
+}
+
+// parseActionsLog parses github actions workflow logs, interpreting the workflow commands that
+// annotate and group lines. Lines between `::group::` and `::endgroup::` carry the group title,
+// and commands that do not produce output, such as `::add-mask::`, are dropped.
+func parseActionsLog(body []byte, now time.Time) []hlog.Log {
+	var logs []hlog.Log
+	var group string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		timestamp := now
+		if m := actionsTimestamp.FindStringSubmatch(line); m != nil {
+			if ts, err := time.Parse(time.RFC3339Nano, m[1]); err == nil {
+				timestamp = ts
+				line = line[len(m[0]):]
+			}
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		lg := hlog.Log{
+			Attributes: map[string]string{},
+			Message:    line,
+			Timestamp:  timestamp.UTC().Format(hlog.TimestampFormatNano),
+			Level:      model.LogLevelInfo.String(),
+		}
+		var command, properties string
+		if m := actionsCommand.FindStringSubmatch(line); m != nil {
+			command, properties, lg.Message = m[1], m[2], actionsDataEscapes.Replace(m[3])
+		} else if m := actionsLogCommand.FindStringSubmatch(line); m != nil {
+			command, lg.Message = m[1], m[2]
+		}
+
+		switch command {
+		case "":
+		case "group":
+			group = lg.Message
+			continue
+		case "endgroup":
+			group = ""
+			continue
+		default:
+			level, ok := actionsLevel(command)
+			if !ok {
+				continue
+			}
+			lg.Level = level
+			for _, property := range strings.Split(properties, ",") {
+				key, value, _ := strings.Cut(strings.TrimSpace(property), "=")
+				if attr, ok := actionsProperties[key]; ok && value != "" {
+					lg.Attributes[attr] = actionsPropertyEscapes.Replace(value)
+				}
+			}
+		}
+		if group != "" {
+			lg.Attributes[ActionsGroupAttribute] = group
+		}
+		logs = append(logs, lg)
+	}
+	return logs
+}
+
+// HandleActionsLog ingests github actions workflow logs, such as those written by a job or
+// downloaded from a workflow run.
+func HandleActionsLog(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http github actions gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http github actions body")
+		writeBodyError(w, err)
+		return
+	}
+
+	logs := parseActionsLog(body, time.Now())
+	if serviceName != "" {
+		for _, lg := range logs {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const ActionsLog = `2023-10-11T22:14:15.1234567Z ##[group]Run go test ./...
+2023-10-11T22:14:15.2000000Z go test ./...
+2023-10-11T22:14:15.3000000Z ##[endgroup]
+::group::Build
+go build ./...
+::add-mask::hunter2
+::error file=backend/http/logging.go,line=42,col=7,title=Build%3A failed::undefined: foo%0Aexit status 1
+::endgroup::
+::warning::deprecated flag
+Done
+`
+
+func TestParseActionsLog(t *testing.T) {
+	now := time.Date(2023, 10, 11, 22, 15, 0, 0, time.UTC)
+	logs := parseActionsLog([]byte(ActionsLog), now)
+	if !assert.Equal(t, 5, len(logs)) {
+		return
+	}
+
+	assert.Equal(t, "go test ./...", logs[0].Message)
+	assert.Equal(t, "2023-10-11T22:14:15.2Z", logs[0].Timestamp)
+	assert.Equal(t, "Run go test ./...", logs[0].Attributes[ActionsGroupAttribute])
+
+	assert.Equal(t, "go build ./...", logs[1].Message)
+	assert.Equal(t, "info", logs[1].Level)
+	assert.Equal(t, "2023-10-11T22:15:00Z", logs[1].Timestamp)
+	assert.Equal(t, "Build", logs[1].Attributes[ActionsGroupAttribute])
+
+	assert.Equal(t, "undefined: foo\nexit status 1", logs[2].Message)
+	assert.Equal(t, "error", logs[2].Level)
+	assert.Equal(t, "backend/http/logging.go", logs[2].Attributes["code.filepath"])
+	assert.Equal(t, "42", logs[2].Attributes["code.lineno"])
+	assert.Equal(t, "7", logs[2].Attributes["code.column"])
+	assert.Equal(t, "Build: failed", logs[2].Attributes["title"])
+	assert.Equal(t, "Build", logs[2].Attributes[ActionsGroupAttribute])
+
+	assert.Equal(t, "deprecated flag", logs[3].Message)
+	assert.Equal(t, "warn", logs[3].Level)
+	assert.NotContains(t, logs[3].Attributes, ActionsGroupAttribute)
+
+	assert.Equal(t, "Done", logs[4].Message)
+	for _, lg := range logs {
+		assert.NotContains(t, lg.Message, "hunter2")
+	}
+}
+
+func TestHandleActionsLog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/github-actions?%s=1&%s=ci", LogDrainProjectQueryParam, LogDrainServiceQueryParam), strings.NewReader(ActionsLog))
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 5, len(*submitted))
+	assert.Equal(t, "ci", (*submitted)[2].log.Attributes["service.name"])
+	assert.Equal(t, "error", (*submitted)[2].log.Level)
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"sync"
+)
+
+// ServiceAllowlist restricts the service names a project accepts logs for.
+type ServiceAllowlist struct {
+	Services []string
+	// Fallback is the service name assigned to logs of services that are not allowed.
+	// When empty, those logs are dropped instead.
+	Fallback string
+}
+
+var serviceAllowlists = struct {
+	sync.RWMutex
+	byProject map[int]*ServiceAllowlist
+}{byProject: make(map[int]*ServiceAllowlist)}
+
+// SetServiceAllowlist replaces the service allowlist of a project. An empty allowlist allows every service.
+func SetServiceAllowlist(projectID int, allowlist *ServiceAllowlist) {
+	serviceAllowlists.Lock()
+	defer serviceAllowlists.Unlock()
+	if allowlist == nil || len(allowlist.Services) == 0 {
+		delete(serviceAllowlists.byProject, projectID)
+		return
+	}
+	serviceAllowlists.byProject[projectID] = allowlist
+}
+
+// allowedServiceName returns the service name a log should be stored under, or false if it should be dropped.
+func allowedServiceName(projectID int, serviceName string) (string, bool) {
+	serviceAllowlists.RLock()
+	allowlist, ok := serviceAllowlists.byProject[projectID]
+	serviceAllowlists.RUnlock()
+	if !ok {
+		return serviceName, true
+	}
+	for _, s := range allowlist.Services {
+		if s == serviceName {
+			return serviceName, true
+		}
+	}
+	return allowlist.Fallback, allowlist.Fallback != ""
+}
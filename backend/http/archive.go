@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/openlyinc/pointy"
+	log "github.com/sirupsen/logrus"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const (
+	defaultArchiveBatchBytes    = 8 << 20
+	defaultArchiveFlushInterval = time.Minute
+)
+
+// S3ObjectPutter is the subset of the s3 client used to write archived logs.
+type S3ObjectPutter interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Archive configures archiving the parsed logs to s3 as gzipped ndjson objects
+// keyed `<prefix><project>/<date>/<hour>/<uuid>.ndjson.gz` by their ingestion time.
+type S3Archive struct {
+	Client S3ObjectPutter
+	Bucket string
+	Prefix string
+	// MaxBatchBytes is the uncompressed size at which a batch is written. Defaults to 8MB.
+	MaxBatchBytes int
+	// FlushInterval is the longest a log is buffered before its batch is written. Defaults to a minute.
+	FlushInterval time.Duration
+}
+
+type archivePartition struct {
+	projectID int
+	hour      time.Time
+}
+
+type s3Archiver struct {
+	cfg     S3Archive
+	mu      sync.Mutex
+	batches map[archivePartition]*bytes.Buffer
+	uploads sync.WaitGroup
+	done    chan struct{}
+}
+
+var archiver *s3Archiver
+
+// SetS3Archive enables archiving the parsed logs to s3. Passing nil disables it. The batches of
+// a previous archive are written before it is replaced.
+func SetS3Archive(cfg *S3Archive) {
+	if archiver != nil {
+		archiver.close()
+		archiver = nil
+	}
+	if cfg == nil {
+		return
+	}
+	a := &s3Archiver{cfg: *cfg, batches: make(map[archivePartition]*bytes.Buffer), done: make(chan struct{})}
+	if a.cfg.MaxBatchBytes <= 0 {
+		a.cfg.MaxBatchBytes = defaultArchiveBatchBytes
+	}
+	if a.cfg.FlushInterval <= 0 {
+		a.cfg.FlushInterval = defaultArchiveFlushInterval
+	}
+	if a.cfg.Prefix != "" && !strings.HasSuffix(a.cfg.Prefix, "/") {
+		a.cfg.Prefix += "/"
+	}
+	go a.run()
+	archiver = a
+}
+
+func (a *s3Archiver) run() {
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.flush()
+		case <-a.done:
+			return
+		}
+	}
+}
+
+func (a *s3Archiver) close() {
+	close(a.done)
+	a.flush()
+	a.uploads.Wait()
+}
+
+// add buffers the logs of a project, writing its batch in the background once it is full.
+func (a *s3Archiver) add(projectID int, logs []hlog.Log) {
+	partition := archivePartition{projectID: projectID, hour: time.Now().UTC().Truncate(time.Hour)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	batch, ok := a.batches[partition]
+	if !ok {
+		batch = new(bytes.Buffer)
+		a.batches[partition] = batch
+	}
+	encoder := json.NewEncoder(batch)
+	for _, lg := range logs {
+		if err := encoder.Encode(lg); err != nil {
+			log.WithError(err).WithField("project_id", projectID).Error("failed to encode archived http log")
+		}
+	}
+	if batch.Len() >= a.cfg.MaxBatchBytes {
+		delete(a.batches, partition)
+		a.uploads.Add(1)
+		go func() {
+			defer a.uploads.Done()
+			a.upload(partition, batch)
+		}()
+	}
+}
+
+// flush writes every buffered batch.
+func (a *s3Archiver) flush() {
+	a.mu.Lock()
+	batches := a.batches
+	a.batches = make(map[archivePartition]*bytes.Buffer)
+	a.mu.Unlock()
+
+	for partition, batch := range batches {
+		a.upload(partition, batch)
+	}
+}
+
+func (a *s3Archiver) key(partition archivePartition) string {
+	return fmt.Sprintf("%s%d/%s/%s/%s.ndjson.gz", a.cfg.Prefix, partition.projectID,
+		partition.hour.Format("2006-01-02"), partition.hour.Format("15"), uuid.New().String())
+}
+
+func (a *s3Archiver) upload(partition archivePartition, batch *bytes.Buffer) {
+	key := a.key(partition)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := batch.WriteTo(gz)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		_, err = a.cfg.Client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:          pointy.String(a.cfg.Bucket),
+			Key:             pointy.String(key),
+			Body:            bytes.NewReader(compressed.Bytes()),
+			ContentType:     pointy.String("application/x-ndjson"),
+			ContentEncoding: pointy.String("gzip"),
+		})
+	}
+	if err != nil {
+		log.WithError(err).WithField("bucket", a.cfg.Bucket).WithField("key", key).Error("failed to archive http logs to s3")
+	}
+}
+
+// archiveLogs buffers the logs for archival. Archival failures are only logged, so they never fail ingestion.
+func archiveLogs(projectID int, logs []hlog.Log) {
+	if a := archiver; a != nil && len(logs) > 0 {
+		a.add(projectID, logs)
+	}
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+type archivedObject struct {
+	bucket string
+	key    string
+	logs   []hlog.Log
+}
+
+type mockS3Putter struct {
+	mu      sync.Mutex
+	objects []archivedObject
+	err     error
+}
+
+func (m *mockS3Putter) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	gz, err := gzip.NewReader(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	var logs []hlog.Log
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var lg hlog.Log
+		if err := json.Unmarshal(scanner.Bytes(), &lg); err != nil {
+			return nil, err
+		}
+		logs = append(logs, lg)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects = append(m.objects, archivedObject{bucket: *params.Bucket, key: *params.Key, logs: logs})
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockS3Putter) archived() []archivedObject {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]archivedObject(nil), m.objects...)
+}
+
+func TestS3Archive(t *testing.T) {
+	submitted := captureSubmits(t)
+	putter := &mockS3Putter{}
+	SetS3Archive(&S3Archive{Client: putter, Bucket: "logs-archive", Prefix: "highlight", FlushInterval: time.Hour})
+	defer SetS3Archive(nil)
+
+	ctx := context.Background()
+	var logs []hlog.Log
+	for i := 0; i < 3; i++ {
+		logs = append(logs, hlog.Log{Message: fmt.Sprintf("log %d", i), Timestamp: "2023-08-11T02:52:40.000Z", Level: "info"})
+	}
+	assert.Nil(t, submitLogs(ctx, 1, logs))
+	assert.NoError(t, submitLog(ctx, 2, hlog.Log{Message: "other project", Timestamp: "2023-08-11T02:52:40.000Z"}))
+	assert.Equal(t, 4, len(*submitted))
+	// batches are buffered until they are full or flushed
+	assert.Empty(t, putter.archived())
+
+	now := time.Now().UTC()
+	SetS3Archive(nil)
+
+	objects := putter.archived()
+	assert.Equal(t, 2, len(objects))
+	byProject := map[string]archivedObject{}
+	for _, object := range objects {
+		assert.Equal(t, "logs-archive", object.bucket)
+		match := regexp.MustCompile(`^highlight/(\d+)/(\d{4}-\d{2}-\d{2})/(\d{2})/[0-9a-f-]{36}\.ndjson\.gz$`).FindStringSubmatch(object.key)
+		if assert.NotNil(t, match, object.key) {
+			assert.Equal(t, now.Format("2006-01-02"), match[2])
+			assert.Equal(t, now.Format("15"), match[3])
+			byProject[match[1]] = object
+		}
+	}
+	if assert.Equal(t, 3, len(byProject["1"].logs)) {
+		assert.Equal(t, "log 0", byProject["1"].logs[0].Message)
+		assert.Equal(t, "log 2", byProject["1"].logs[2].Message)
+	}
+	if assert.Equal(t, 1, len(byProject["2"].logs)) {
+		assert.Equal(t, "other project", byProject["2"].logs[0].Message)
+	}
+}
+
+func TestS3ArchiveFlushesFullBatches(t *testing.T) {
+	captureSubmits(t)
+	putter := &mockS3Putter{}
+	SetS3Archive(&S3Archive{Client: putter, Bucket: "logs-archive", MaxBatchBytes: 1, FlushInterval: time.Hour})
+	defer SetS3Archive(nil)
+
+	ctx := context.Background()
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "first"}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "second"}))
+	assert.Eventually(t, func() bool { return len(putter.archived()) == 2 }, time.Second, 10*time.Millisecond)
+	for _, object := range putter.archived() {
+		assert.Regexp(t, `^1/`, object.key)
+		assert.Equal(t, 1, len(object.logs))
+	}
+}
+
+func TestS3ArchiveFailureDoesNotFailIngestion(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetS3Archive(&S3Archive{Client: &mockS3Putter{err: errors.New("access denied")}, Bucket: "logs-archive", MaxBatchBytes: 1})
+	defer SetS3Archive(nil)
+
+	assert.NoError(t, submitLog(context.Background(), 1, hlog.Log{Message: "hello"}))
+	assert.Equal(t, 1, len(*submitted))
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// asffFinding holds the fields of an AWS Security Finding Format finding that are ingested.
+type asffFinding struct {
+	Id           string
+	ProductArn   string
+	GeneratorId  string
+	AwsAccountId string
+	Region       string
+	Types        []string
+	CreatedAt    string
+	Title        string
+	Description  string
+	RecordState  string
+	Severity     struct {
+		Label string
+	}
+	Compliance struct {
+		Status string
+	}
+	Workflow struct {
+		Status string
+	}
+	Resources []struct {
+		Type   string
+		Id     string
+		Region string
+	}
+}
+
+// asffLevel maps a finding severity label to a log level.
+func asffLevel(label string) string {
+	switch strings.ToUpper(label) {
+	case "CRITICAL":
+		return model.LogLevelFatal.String()
+	case "HIGH":
+		return model.LogLevelError.String()
+	case "MEDIUM":
+		return model.LogLevelWarn.String()
+	default:
+		// LOW and INFORMATIONAL
+		return model.LogLevelInfo.String()
+	}
+}
+
+// parseASFFLogs converts the Security Hub findings of a firehose record into logs. Findings are sent
+// either as a BatchImportFindings document with a top level `Findings` list or as the EventBridge
+// event of imported findings, which holds them under `detail.findings`.
+func parseASFFLogs(msg []byte) ([]hlog.Log, bool) {
+	var doc struct {
+		Findings []asffFinding
+		Detail   struct {
+			Findings []asffFinding
+		} `json:"detail"`
+	}
+	if err := json.Unmarshal(msg, &doc); err != nil {
+		return nil, false
+	}
+	findings := doc.Findings
+	if len(findings) == 0 {
+		findings = doc.Detail.Findings
+	}
+	if len(findings) == 0 || findings[0].ProductArn == "" {
+		return nil, false
+	}
+
+	var logs []hlog.Log
+	for _, finding := range findings {
+		lg := hlog.Log{
+			Attributes: map[string]string{
+				string(semconv.ServiceNameKey):    "security-hub",
+				string(semconv.CloudAccountIDKey): finding.AwsAccountId,
+				string(semconv.CloudRegionKey):    finding.Region,
+				"asff.id":                         finding.Id,
+				"asff.product_arn":                finding.ProductArn,
+				"asff.generator_id":               finding.GeneratorId,
+				"asff.severity":                   finding.Severity.Label,
+				"asff.types":                      strings.Join(finding.Types, ","),
+				"asff.compliance_status":          finding.Compliance.Status,
+				"asff.workflow_status":            finding.Workflow.Status,
+				"asff.record_state":               finding.RecordState,
+			},
+			Timestamp: time.Now().UTC().Format(hlog.TimestampFormat),
+			Level:     asffLevel(finding.Severity.Label),
+			Message:   finding.Title,
+		}
+		if finding.Description != "" {
+			lg.Message = strings.TrimSpace(fmt.Sprintf("%s\n%s", finding.Title, finding.Description))
+		}
+		if ts, ok := parseTimestamp(finding.CreatedAt); ok {
+			lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+		}
+		for idx, resource := range finding.Resources {
+			lg.Attributes[fmt.Sprintf("asff.resources.%d.type", idx)] = resource.Type
+			lg.Attributes[fmt.Sprintf("asff.resources.%d.id", idx)] = resource.Id
+			lg.Attributes[fmt.Sprintf("asff.resources.%d.region", idx)] = resource.Region
+		}
+		for k, v := range lg.Attributes {
+			if v == "" {
+				delete(lg.Attributes, k)
+			}
+		}
+		logs = append(logs, lg)
+	}
+	return logs, true
+}
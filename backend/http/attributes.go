@@ -0,0 +1,198 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// AttributesTruncatedAttribute marks a log whose attributes beyond the configured count were dropped.
+const AttributesTruncatedAttribute = "highlight_attributes_truncated"
+
+// ArrayMode controls how an array attribute is converted to log attributes.
+type ArrayMode int
+
+const (
+	// ArrayModeDrop drops array attributes.
+	ArrayModeDrop ArrayMode = iota
+	// ArrayModeIndex expands the array to indexed keys such as `tags.0` and `tags.1`.
+	ArrayModeIndex
+	// ArrayModeJoin joins an array of scalars into a single value. Arrays holding objects are still expanded.
+	ArrayModeJoin
+	// ArrayModeJSON keeps the array as a single json encoded value.
+	ArrayModeJSON
+)
+
+const defaultMaxArrayElements = 100
+
+// ArrayAttributes configures the conversion of array attributes.
+type ArrayAttributes struct {
+	// Default is the mode of arrays without a mode in Keys.
+	Default ArrayMode
+	// Keys sets the mode of the arrays by their flattened attribute key.
+	Keys map[string]ArrayMode
+	// Separator joins the values of ArrayModeJoin arrays, defaulting to a comma.
+	Separator string
+	// MaxElements is the number of elements of an array that are converted, defaulting to 100.
+	// The remaining elements are dropped.
+	MaxElements int
+}
+
+var arrayAttributes = ArrayAttributes{}
+
+// SetArrayAttributes configures how array attributes are converted. It should be called once at startup.
+func SetArrayAttributes(cfg ArrayAttributes) {
+	arrayAttributes = cfg
+}
+
+const defaultMaxAttributeDepth = 5
+
+var maxAttributeDepth = defaultMaxAttributeDepth
+var maxAttributes = 0
+
+// SetMaxAttributeDepth sets the number of levels of nested json objects and arrays that are flattened
+// to dotted keys, defaulting to 5. Deeper values are kept as a single json encoded value. Zero
+// disables the limit.
+func SetMaxAttributeDepth(depth int) {
+	maxAttributeDepth = depth
+}
+
+// SetMaxAttributes sets the maximum number of attributes of a json log. The attributes beyond the
+// limit, in key order, are dropped. Zero disables the limit.
+func SetMaxAttributes(limit int) {
+	maxAttributes = limit
+}
+
+func formatScalar(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case int64:
+		// integers of decoded otlp maps and arrays
+		return strconv.FormatInt(value, 10), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case nil:
+		return "", true
+	}
+	return "", false
+}
+
+// formatJSONAttribute keeps a json value as a single encoded attribute.
+func formatJSONAttribute(k string, v interface{}) map[string]string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return map[string]string{k: string(b)}
+}
+
+func formatArrayAttribute(ctx context.Context, k string, values []interface{}, depth int) map[string]string {
+	mode, ok := arrayAttributes.Keys[k]
+	if !ok {
+		mode = arrayAttributes.Default
+	}
+	if mode == ArrayModeDrop {
+		return nil
+	}
+	maxElements := arrayAttributes.MaxElements
+	if maxElements <= 0 {
+		maxElements = defaultMaxArrayElements
+	}
+	if len(values) > maxElements {
+		values = values[:maxElements]
+	}
+
+	if mode == ArrayModeJSON {
+		return formatJSONAttribute(k, values)
+	}
+
+	if mode == ArrayModeJoin {
+		scalars := make([]string, 0, len(values))
+		for _, v := range values {
+			s, ok := formatScalar(v)
+			if !ok {
+				break
+			}
+			scalars = append(scalars, s)
+		}
+		if len(scalars) == len(values) {
+			separator := arrayAttributes.Separator
+			if separator == "" {
+				separator = ","
+			}
+			return flattenAttributes(ctx, k, strings.Join(scalars, separator), depth)
+		}
+	}
+
+	if maxAttributeDepth > 0 && depth >= maxAttributeDepth {
+		return formatJSONAttribute(k, values)
+	}
+	m := make(map[string]string)
+	for idx, v := range values {
+		for key, value := range flattenAttributes(ctx, fmt.Sprintf("%s.%d", k, idx), v, depth+1) {
+			m[key] = value
+		}
+	}
+	return m
+}
+
+// formatAttributes flattens a json value into log attributes, expanding objects to dotted keys and
+// converting arrays as configured with SetArrayAttributes. Values are not truncated here so that
+// every limit is enforced by truncateLog.
+func formatAttributes(ctx context.Context, k string, v interface{}) map[string]string {
+	return flattenAttributes(ctx, k, v, 1)
+}
+
+// flattenAttributes flattens a value whose key is at the given depth, where a top level key is
+// at depth 1. Objects and arrays at the maximum depth are not expanded any further.
+func flattenAttributes(ctx context.Context, k string, v interface{}, depth int) map[string]string {
+	switch value := v.(type) {
+	case []interface{}:
+		return formatArrayAttribute(ctx, k, value, depth)
+	case map[string]interface{}:
+		if maxAttributeDepth > 0 && depth >= maxAttributeDepth {
+			return formatJSONAttribute(k, value)
+		}
+		m := make(map[string]string)
+		for mapKey, mapV := range value {
+			for key, formatted := range flattenAttributes(ctx, fmt.Sprintf("%s.%s", k, mapKey), mapV, depth+1) {
+				m[key] = formatted
+			}
+		}
+		return m
+	}
+	// json numbers are decoded as float64, which is formatted without an exponent so that whole
+	// numbers read as plain integers. null values are dropped.
+	if s, ok := formatScalar(v); ok && v != nil {
+		return map[string]string{k: s}
+	}
+	return nil
+}
+
+// limitAttributes drops the attributes of a log beyond the configured count, keeping the first
+// keys in order so that the same attributes are kept for every log of a shape.
+func limitAttributes(ctx context.Context, lg *hlog.Log) {
+	if maxAttributes <= 0 || len(lg.Attributes) <= maxAttributes {
+		return
+	}
+	keys := make([]string, 0, len(lg.Attributes))
+	for k := range lg.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[maxAttributes:] {
+		delete(lg.Attributes, k)
+	}
+	lg.Attributes[AttributesTruncatedAttribute] = "true"
+	if stats := getIngestStats(ctx); stats != nil {
+		stats.attributesTruncated.Add(int64(len(keys) - maxAttributes))
+	}
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func TestFormatAttributes(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name     string
+		json     string
+		expected map[string]string
+	}{
+		{"int", `{"user_id":15000}`, map[string]string{"user_id": "15000"}},
+		{"large int", `{"id":1234567890123}`, map[string]string{"id": "1234567890123"}},
+		{"negative int", `{"offset":-3}`, map[string]string{"offset": "-3"}},
+		{"float", `{"ratio":0.25}`, map[string]string{"ratio": "0.25"}},
+		{"small float", `{"epsilon":1e-7}`, map[string]string{"epsilon": "0.0000001"}},
+		{"exponent", `{"big":1.5E+21}`, map[string]string{"big": "1500000000000000000000"}},
+		{"bool", `{"ok":true,"failed":false}`, map[string]string{"ok": "true", "failed": "false"}},
+		{"string", `{"name":"checkout"}`, map[string]string{"name": "checkout"}},
+		{"null", `{"missing":null}`, map[string]string{}},
+		{"nested", `{"user":{"id":42,"admin":true,"address":{"city":"Paris"}}}`, map[string]string{"user.id": "42", "user.admin": "true", "user.address.city": "Paris"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var attrs map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(tc.json), &attrs))
+			formatted := map[string]string{}
+			for k, v := range attrs {
+				for key, value := range formatAttributes(ctx, k, v) {
+					formatted[key] = value
+				}
+			}
+			assert.Equal(t, tc.expected, formatted)
+		})
+	}
+}
+
+func TestFormatArrayAttributes(t *testing.T) {
+	defer SetArrayAttributes(ArrayAttributes{})
+	ctx := context.Background()
+	tags := []interface{}{"prod", "api", 2.0}
+
+	// arrays are dropped unless configured
+	assert.Empty(t, formatAttributes(ctx, "tags", tags))
+
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeIndex})
+	assert.Equal(t, map[string]string{"tags.0": "prod", "tags.1": "api", "tags.2": "2"}, formatAttributes(ctx, "tags", tags))
+
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeIndex, Keys: map[string]ArrayMode{"tags": ArrayModeJoin}})
+	assert.Equal(t, map[string]string{"tags": "prod,api,2"}, formatAttributes(ctx, "tags", tags))
+	assert.Equal(t, map[string]string{"other.0": "a"}, formatAttributes(ctx, "other", []interface{}{"a"}))
+
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeJSON})
+	assert.Equal(t, map[string]string{"tags": `["prod","api",2]`}, formatAttributes(ctx, "tags", tags))
+	assert.Equal(t, map[string]string{"matrix": `[[1,2],{"a":true}]`}, formatAttributes(ctx, "matrix", []interface{}{
+		[]interface{}{1.0, 2.0},
+		map[string]interface{}{"a": true},
+	}))
+
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeJoin, Separator: " "})
+	assert.Equal(t, map[string]string{"tags": "prod api 2"}, formatAttributes(ctx, "tags", tags))
+	assert.Equal(t, map[string]string{"request.tags": "a b"}, formatAttributes(ctx, "request", map[string]interface{}{"tags": []interface{}{"a", "b"}}))
+
+	// arrays of objects are always expanded
+	assert.Equal(t, map[string]string{"users.0.id": "1", "users.1.id": "2"}, formatAttributes(ctx, "users", []interface{}{
+		map[string]interface{}{"id": 1.0},
+		map[string]interface{}{"id": 2.0},
+	}))
+}
+
+func TestFormatArrayAttributesMaxElements(t *testing.T) {
+	defer SetArrayAttributes(ArrayAttributes{})
+	ctx := context.Background()
+	values := make([]interface{}, 1000)
+	for idx := range values {
+		values[idx] = "v"
+	}
+
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeIndex})
+	assert.Len(t, formatAttributes(ctx, "big", values), defaultMaxArrayElements)
+
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeIndex, MaxElements: 2})
+	assert.Equal(t, map[string]string{"big.0": "v", "big.1": "v"}, formatAttributes(ctx, "big", values))
+
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeJoin, MaxElements: 3})
+	assert.Equal(t, map[string]string{"big": "v,v,v"}, formatAttributes(ctx, "big", values))
+}
+
+func TestFormatAttributesMaxDepth(t *testing.T) {
+	defer SetMaxAttributeDepth(defaultMaxAttributeDepth)
+	defer SetArrayAttributes(ArrayAttributes{})
+	ctx := context.Background()
+	var nested interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"b":{"c":{"d":{"e":{"f":1}}}}}`), &nested))
+
+	// objects below the maximum depth are kept as json
+	assert.Equal(t, map[string]string{"a.b.c.d.e": `{"f":1}`}, formatAttributes(ctx, "a", nested))
+
+	SetMaxAttributeDepth(2)
+	assert.Equal(t, map[string]string{"a.b": `{"c":{"d":{"e":{"f":1}}}}`}, formatAttributes(ctx, "a", nested))
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeIndex})
+	assert.Equal(t, map[string]string{"a.tags": `["foo","bar"]`}, formatAttributes(ctx, "a", map[string]interface{}{"tags": []interface{}{"foo", "bar"}}))
+
+	SetMaxAttributeDepth(0)
+	assert.Equal(t, map[string]string{"a.b.c.d.e.f": "1"}, formatAttributes(ctx, "a", nested))
+}
+
+func TestHandleJSONLogMaxAttributes(t *testing.T) {
+	submitted := captureSubmits(t)
+	defer SetMaxAttributes(0)
+	defer SetArrayAttributes(ArrayAttributes{})
+	SetArrayAttributes(ArrayAttributes{Default: ArrayModeIndex})
+
+	send := func() hlog.Log {
+		*submitted = nil
+		r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"failed","level":"error","timestamp":"2023-10-11T22:14:15Z","http":{"status":500,"method":"POST"},"tags":["foo","bar"]}`))
+		r.Header.Set(LogDrainProjectHeader, "1")
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, len(*submitted))
+		return (*submitted)[0].log
+	}
+
+	lg := send()
+	assert.Equal(t, "failed", lg.Message)
+	assert.Equal(t, "error", lg.Level)
+	assert.Equal(t, "500", lg.Attributes["http.status"])
+	assert.Equal(t, "POST", lg.Attributes["http.method"])
+	assert.Equal(t, "foo", lg.Attributes["tags.0"])
+	assert.Equal(t, "bar", lg.Attributes["tags.1"])
+	for _, reserved := range []string{"message", "level", "timestamp"} {
+		assert.NotContains(t, lg.Attributes, reserved)
+	}
+	assert.NotContains(t, lg.Attributes, AttributesTruncatedAttribute)
+
+	SetMaxAttributes(2)
+	lg = send()
+	assert.Equal(t, "POST", lg.Attributes["http.method"])
+	assert.Equal(t, "500", lg.Attributes["http.status"])
+	assert.NotContains(t, lg.Attributes, "tags.0")
+	assert.Equal(t, "true", lg.Attributes[AttributesTruncatedAttribute])
+}
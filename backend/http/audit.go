@@ -0,0 +1,79 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AuditEvent describes an ingestion request that was rejected because it did not
+// present a valid project. The presented key is only ever recorded as a short prefix.
+type AuditEvent struct {
+	Timestamp time.Time
+	RemoteIP  string
+	Endpoint  string
+	KeyPrefix string
+	Reason    string
+}
+
+type AuditSink interface {
+	Audit(ctx context.Context, event AuditEvent)
+}
+
+// LogrusAuditSink writes audit events as structured logrus entries.
+type LogrusAuditSink struct{}
+
+func (LogrusAuditSink) Audit(ctx context.Context, event AuditEvent) {
+	log.WithContext(ctx).WithFields(log.Fields{
+		"audit":      true,
+		"timestamp":  event.Timestamp,
+		"remote_ip":  event.RemoteIP,
+		"endpoint":   event.Endpoint,
+		"key_prefix": event.KeyPrefix,
+		"reason":     event.Reason,
+	}).Warn("rejected unauthenticated http logs request")
+}
+
+var auditSink AuditSink = LogrusAuditSink{}
+
+// SetAuditSink replaces the sink of audit events for authentication failures, which logs them
+// with logrus by default. Passing nil disables them.
+func SetAuditSink(sink AuditSink) {
+	auditSink = sink
+}
+
+func redactKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	n := len(key) / 2
+	if n > 4 {
+		n = 4
+	}
+	return key[:n] + strings.Repeat("*", 4)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func auditAuthFailure(r *http.Request, key string, reason string) {
+	if auditSink == nil {
+		return
+	}
+	auditSink.Audit(r.Context(), AuditEvent{
+		Timestamp: time.Now().UTC(),
+		RemoteIP:  remoteIP(r),
+		Endpoint:  r.URL.Path,
+		KeyPrefix: redactKey(key),
+		Reason:    reason,
+	})
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAuditSink struct {
+	events []AuditEvent
+}
+
+func (m *mockAuditSink) Audit(_ context.Context, event AuditEvent) {
+	m.events = append(m.events, event)
+}
+
+func TestAuditAuthFailure(t *testing.T) {
+	sink := &mockAuditSink{}
+	SetAuditSink(sink)
+	defer SetAuditSink(LogrusAuditSink{})
+
+	secret := "!nvalid-secret-key"
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello"}`))
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set(LogDrainProjectHeader, secret)
+	w := &MockResponseWriter{}
+	HandleJSONLog(w, r)
+
+	assert.Equal(t, 1, len(sink.events))
+	assert.Equal(t, "10.0.0.1", sink.events[0].RemoteIP)
+	assert.Equal(t, "/v1/logs/json", sink.events[0].Endpoint)
+	assert.Equal(t, "!nva****", sink.events[0].KeyPrefix)
+	assert.NotContains(t, sink.events[0].KeyPrefix, secret)
+}
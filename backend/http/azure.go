@@ -0,0 +1,145 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// azureEnvelope is the body of the azure monitor diagnostic logs exported through event hubs.
+type azureEnvelope struct {
+	Records []azureRecord `json:"records"`
+}
+
+// azureRecord is an azure monitor diagnostic log in the common top level schema. The properties
+// are specific to the category of the log, and some services send them as a json string.
+type azureRecord struct {
+	Time              string          `json:"time"`
+	ResourceID        string          `json:"resourceId"`
+	Category          string          `json:"category"`
+	OperationName     string          `json:"operationName"`
+	ResultType        string          `json:"resultType"`
+	ResultDescription string          `json:"resultDescription"`
+	CorrelationID     string          `json:"correlationId"`
+	CallerIPAddress   string          `json:"callerIpAddress"`
+	Location          string          `json:"location"`
+	Level             string          `json:"level"`
+	Properties        json.RawMessage `json:"properties"`
+}
+
+// azureMessageProperties are the properties holding the message of a log, in order of precedence.
+var azureMessageProperties = []string{"message", "Message", "msg", "ResultDescription"}
+
+// azureLevel maps azure monitor levels, such as Informational and Warning, onto log levels.
+// Unknown levels are info.
+func azureLevel(level string) string {
+	if level := normalizeLevel(level); level != "" {
+		return level
+	}
+	return model.LogLevelInfo.String()
+}
+
+// parseAzureRecord converts an azure monitor record into a log. The message is the result
+// description or a message property, falling back to the operation name.
+func parseAzureRecord(ctx context.Context, record *azureRecord, fallback time.Time) hlog.Log {
+	lg := hlog.Log{
+		Attributes: map[string]string{},
+		Message:    record.ResultDescription,
+		Level:      azureLevel(record.Level),
+		Timestamp:  fallback.Format(hlog.TimestampFormatNano),
+	}
+	if ts, ok := parseTimestamp(record.Time); ok {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+	}
+
+	var properties map[string]interface{}
+	if err := json.Unmarshal(record.Properties, &properties); err != nil {
+		var encoded string
+		if json.Unmarshal(record.Properties, &encoded) == nil {
+			_ = json.Unmarshal([]byte(encoded), &properties)
+		}
+	}
+	for _, key := range azureMessageProperties {
+		if message, ok := properties[key].(string); ok && lg.Message == "" {
+			lg.Message = message
+			delete(properties, key)
+		}
+	}
+	if lg.Message == "" {
+		lg.Message = record.OperationName
+	}
+	for key, value := range formatAttributes(ctx, "properties", properties) {
+		lg.Attributes[key] = value
+	}
+
+	for k, v := range map[string]string{
+		"azure.resource_id":    record.ResourceID,
+		"azure.category":       record.Category,
+		"azure.operation_name": record.OperationName,
+		"azure.result_type":    record.ResultType,
+		"azure.correlation_id": record.CorrelationID,
+		"azure.location":       record.Location,
+		"azure.caller_ip":      record.CallerIPAddress,
+	} {
+		if v != "" {
+			lg.Attributes[k] = v
+		}
+	}
+	return lg
+}
+
+// HandleAzureLog ingests the azure monitor diagnostic logs that are exported to an event hub and
+// forwarded with the highlight headers, each request holding a batch of records.
+func HandleAzureLog(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http azure gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http azure body")
+		writeBodyError(w, err)
+		return
+	}
+
+	var envelope azureEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http azure records")
+		writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not an azure monitor batch")
+		return
+	}
+
+	now := time.Now().UTC()
+	var logs []hlog.Log
+	for idx := range envelope.Records {
+		lg := parseAzureRecord(r.Context(), &envelope.Records[idx], now)
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, lg)
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
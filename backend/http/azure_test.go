@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const AzureRecords = `{"records":[
+	{"time":"2023-10-11T22:14:15.1234567Z","resourceId":"/SUBSCRIPTIONS/0000/RESOURCEGROUPS/CHECKOUT/PROVIDERS/MICROSOFT.WEB/SITES/CHECKOUT-API","category":"FunctionAppLogs","operationName":"Microsoft.Web/sites/functions/log","level":"Warning","location":"West Europe","properties":{"appName":"checkout-api","functionName":"Charge","message":"charge declined","exceptionDetails":{"type":"CardError"}}},
+	{"time":"2023-10-11T22:14:16Z","resourceId":"/SUBSCRIPTIONS/0000/RESOURCEGROUPS/CHECKOUT/PROVIDERS/MICROSOFT.KEYVAULT/VAULTS/SECRETS","category":"AuditEvent","operationName":"SecretGet","resultType":"Success","level":"Informational","callerIpAddress":"10.0.0.4","properties":"{\"id\":\"https://secrets.vault.azure.net/secrets/stripe\",\"httpStatusCode\":200}"},
+	{"time":"2023-10-11T22:14:17Z","category":"Administrative","operationName":"Microsoft.Compute/virtualMachines/delete","resultDescription":"The client does not have authorization","level":"Error"}
+]}`
+
+func TestHandleAzureLog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/azure", strings.NewReader(AzureRecords))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	if assert.Equal(t, 3, len(*submitted)) {
+		function := (*submitted)[0].log
+		assert.Equal(t, "charge declined", function.Message)
+		assert.Equal(t, "warn", function.Level)
+		assert.Equal(t, "2023-10-11T22:14:15.1234567Z", function.Timestamp)
+		assert.Equal(t, "/SUBSCRIPTIONS/0000/RESOURCEGROUPS/CHECKOUT/PROVIDERS/MICROSOFT.WEB/SITES/CHECKOUT-API", function.Attributes["azure.resource_id"])
+		assert.Equal(t, "FunctionAppLogs", function.Attributes["azure.category"])
+		assert.Equal(t, "Charge", function.Attributes["properties.functionName"])
+		assert.Equal(t, "CardError", function.Attributes["properties.exceptionDetails.type"])
+		assert.NotContains(t, function.Attributes, "properties.message")
+
+		audit := (*submitted)[1].log
+		assert.Equal(t, "SecretGet", audit.Message)
+		assert.Equal(t, "info", audit.Level)
+		assert.Equal(t, "200", audit.Attributes["properties.httpStatusCode"])
+		assert.Equal(t, "10.0.0.4", audit.Attributes["azure.caller_ip"])
+
+		activity := (*submitted)[2].log
+		assert.Equal(t, "The client does not have authorization", activity.Message)
+		assert.Equal(t, "error", activity.Level)
+	}
+}
+
+func TestAzureLevel(t *testing.T) {
+	for level, expected := range map[string]string{
+		"Informational": "info",
+		"Warning":       "warn",
+		"Error":         "error",
+		"Critical":      "fatal",
+		"Verbose":       "trace",
+		"":              "info",
+	} {
+		assert.Equal(t, expected, azureLevel(level), level)
+	}
+}
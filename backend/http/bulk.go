@@ -0,0 +1,265 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// BulkIndexAttribute holds the index that a log of an elasticsearch bulk request was written to.
+const BulkIndexAttribute = "index"
+
+const bulkTimestampField = "@timestamp"
+
+var bulkIndexServices = struct {
+	sync.RWMutex
+	services map[string]string
+}{}
+
+// SetBulkIndexServices maps the indices of elasticsearch bulk requests to the service of their logs,
+// such as `myapp-logs` to `myapp`. The service of a document and the service header of a request
+// take precedence.
+func SetBulkIndexServices(services map[string]string) {
+	bulkIndexServices.Lock()
+	defer bulkIndexServices.Unlock()
+	bulkIndexServices.services = services
+}
+
+func getBulkIndexService(index string) string {
+	bulkIndexServices.RLock()
+	defer bulkIndexServices.RUnlock()
+	return bulkIndexServices.services[index]
+}
+
+// setBulkService sets the service of a bulk document that does not hold its own, from the service
+// header or else from the service mapped to its index.
+func setBulkService(lg *hlog.Log, index string, serviceName string) {
+	if lg.Attributes[string(semconv.ServiceNameKey)] != "" {
+		return
+	}
+	if serviceName == "" {
+		serviceName = getBulkIndexService(index)
+	}
+	if serviceName != "" {
+		lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+	}
+}
+
+// bulkAction is an action line of a bulk request, keyed by its action.
+type bulkAction map[string]struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+type bulkItemResult struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id,omitempty"`
+	Status int             `json:"status"`
+	Error  *bulkItemReason `json:"error,omitempty"`
+}
+
+type bulkItemReason struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// bulkResponse mirrors the response of the elasticsearch bulk api, which beats, logstash and
+// fluent bit read to retry the items that failed.
+type bulkResponse struct {
+	Took   int64                       `json:"took"`
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+// parseBulkDocument converts the source of a bulk action into a log of the given index. Update
+// actions hold the document in `doc`.
+func parseBulkDocument(ctx context.Context, action string, source []byte, index string) (hlog.Log, error) {
+	if action == "update" {
+		var update struct {
+			Doc json.RawMessage `json:"doc"`
+		}
+		if err := json.Unmarshal(source, &update); err != nil {
+			return hlog.Log{}, err
+		}
+		if update.Doc == nil {
+			return hlog.Log{}, fmt.Errorf("update action has no doc")
+		}
+		source = update.Doc
+	}
+	lg, err := parseJSONLog(ctx, source)
+	if err != nil {
+		return lg, err
+	}
+	if ts, ok := parseTimestamp(lg.Attributes[bulkTimestampField]); ok && lg.Timestamp == "" {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+		delete(lg.Attributes, bulkTimestampField)
+	}
+	if index != "" {
+		lg.Attributes[BulkIndexAttribute] = index
+	}
+	return lg, nil
+}
+
+// HandleElasticsearchBulk ingests the bulk requests of the elasticsearch and opensearch outputs of
+// beats, logstash and fluent bit. The index of a log is read from its action or from the request
+// path, `/<index>/_bulk`. The create, index and update actions are ingested while deletes are ignored.
+func HandleElasticsearchBulk(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http bulk gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http bulk body")
+		writeBodyError(w, err)
+		return
+	}
+
+	pathIndex := chi.URLParam(r, "index")
+	var resp bulkResponse
+	var logs []hlog.Log
+	// the item of each log, so that its submit error is reported on it
+	var items []int
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var action bulkAction
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "invalid bulk action line")
+			return
+		}
+		for name, meta := range action {
+			index := meta.Index
+			if index == "" {
+				index = pathIndex
+			}
+			if name == "delete" {
+				resp.Items = append(resp.Items, map[string]bulkItemResult{name: {Index: index, ID: meta.ID, Status: http.StatusOK}})
+				continue
+			}
+			if !scanner.Scan() {
+				writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, fmt.Sprintf("bulk %s action has no source", name))
+				return
+			}
+			item := bulkItemResult{Index: index, ID: meta.ID, Status: http.StatusCreated}
+			if name != "create" && name != "index" && name != "update" {
+				item.Status = http.StatusBadRequest
+				item.Error = &bulkItemReason{Type: "illegal_argument_exception", Reason: fmt.Sprintf("unsupported bulk action %s", name)}
+			} else if lg, err := parseBulkDocument(r.Context(), name, scanner.Bytes(), index); err != nil {
+				recordDecodeErrors(r.Context(), endpointBulk, projectID, 1)
+				item.Status = http.StatusBadRequest
+				item.Error = &bulkItemReason{Type: "mapper_parsing_exception", Reason: "failed to parse the document"}
+			} else {
+				setBulkService(&lg, index, serviceName)
+				applyTraceContext(&lg)
+				logs = append(logs, lg)
+				items = append(items, len(resp.Items))
+			}
+			if item.Error != nil {
+				resp.Errors = true
+			}
+			resp.Items = append(resp.Items, map[string]bulkItemResult{name: item})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http bulk body")
+		writeBodyError(w, err)
+		return
+	}
+
+	recordReceived(r.Context(), endpointBulk, projectID, len(logs), len(body))
+	errs := submitLogs(r.Context(), projectID, logs)
+	failed := 0
+	for idx, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		resp.Errors = true
+		for name, item := range resp.Items[items[idx]] {
+			item.Status = submitErrorStatus(err)
+			item.Error = &bulkItemReason{Type: "submit_exception", Reason: "failed to submit logs"}
+			resp.Items[items[idx]][name] = item
+		}
+	}
+	recordSubmitted(r.Context(), endpointBulk, projectID, len(logs)-failed, failed)
+	if failed > 0 && failed == len(logs) {
+		log.WithContext(r.Context()).WithError(firstError(errs)).Error("failed to submit log")
+		writeSubmitError(w, firstError(errs))
+		return
+	}
+
+	resp.Took = time.Since(start).Milliseconds()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// HandleElasticsearchDoc ingests a single document written to `/<index>/_doc`.
+func HandleElasticsearchDoc(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http doc gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http doc body")
+		writeBodyError(w, err)
+		return
+	}
+
+	index := chi.URLParam(r, "index")
+	lg, err := parseBulkDocument(r.Context(), "index", body, index)
+	if err != nil {
+		recordDecodeErrors(r.Context(), endpointBulk, projectID, 1)
+		writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not valid json")
+		return
+	}
+	setBulkService(&lg, index, serviceName)
+	applyTraceContext(&lg)
+
+	recordReceived(r.Context(), endpointBulk, projectID, 1, len(body))
+	if err := submitLog(r.Context(), projectID, lg); err != nil {
+		recordSubmitted(r.Context(), endpointBulk, projectID, 0, 1)
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
+	}
+	recordSubmitted(r.Context(), endpointBulk, projectID, 1, 0)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"_index": index, "result": "created"})
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleElasticsearchBulk(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetBulkIndexServices(map[string]string{"myapp-logs": "myapp"})
+	defer SetBulkIndexServices(nil)
+
+	body := strings.Join([]string{
+		`{"index":{}}`,
+		`{"@timestamp":"2023-10-11T22:14:15.123Z","message":"order placed","level":"info"}`,
+		`{"create":{"_index":"billing-logs"}}`,
+		`{"message":"invoice sent","service.name":"billing"}`,
+		`{"delete":{"_id":"1"}}`,
+		`{"update":{"_id":"2"}}`,
+		`{"doc":{"message":"order shipped"}}`,
+		`{"index":{}}`,
+		`{"message":`,
+	}, "\n") + "\n"
+	r, _ := http.NewRequest("POST", "/v1/logs/myapp-logs/_bulk", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp bulkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	// the invalid document is reported on its item so that the client does not retry the others
+	assert.True(t, resp.Errors)
+	if assert.Equal(t, 5, len(resp.Items)) {
+		assert.Equal(t, http.StatusCreated, resp.Items[0]["index"].Status)
+		assert.Equal(t, "billing-logs", resp.Items[1]["create"].Index)
+		assert.Equal(t, http.StatusOK, resp.Items[2]["delete"].Status)
+		assert.Equal(t, http.StatusCreated, resp.Items[3]["update"].Status)
+		assert.Equal(t, http.StatusBadRequest, resp.Items[4]["index"].Status)
+	}
+
+	if assert.Equal(t, 3, len(*submitted)) {
+		first := (*submitted)[0].log
+		assert.Equal(t, "order placed", first.Message)
+		assert.Equal(t, "myapp-logs", first.Attributes[BulkIndexAttribute])
+		assert.Equal(t, "myapp", first.Attributes["service.name"])
+		assert.Equal(t, "2023-10-11T22:14:15.123Z", first.Timestamp)
+		assert.NotContains(t, first.Attributes, "@timestamp")
+
+		second := (*submitted)[1].log
+		assert.Equal(t, "billing-logs", second.Attributes[BulkIndexAttribute])
+		assert.Equal(t, "billing", second.Attributes["service.name"])
+
+		assert.Equal(t, "order shipped", (*submitted)[2].log.Message)
+	}
+}
+
+func TestHandleElasticsearchDoc(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/myapp-logs/_doc", strings.NewReader(`{"message":"hello"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "hello", (*submitted)[0].log.Message)
+		assert.Equal(t, "myapp-logs", (*submitted)[0].log.Attributes[BulkIndexAttribute])
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// ClockRegressionAttribute flags a log whose timestamp is earlier than the last one seen from its source.
+const ClockRegressionAttribute = "clock_regression"
+
+const clockSourceCacheSize = 100_000
+
+// ClockRegressionCheck flags logs whose timestamp goes backwards per (project, service).
+type ClockRegressionCheck struct {
+	// Threshold is how far a timestamp may go backwards before the log is flagged.
+	// Logs shipped concurrently are rarely in order, so small regressions are expected.
+	Threshold time.Duration
+}
+
+type clockSource struct {
+	projectID   int
+	serviceName string
+}
+
+type clockRegressionTracker struct {
+	check ClockRegressionCheck
+	mu    sync.Mutex
+	last  *lru.Cache[clockSource, time.Time]
+}
+
+var clockTracker *clockRegressionTracker
+
+// SetClockRegressionCheck enables flagging logs with the ClockRegressionAttribute. Passing nil disables it.
+func SetClockRegressionCheck(check *ClockRegressionCheck) {
+	if check == nil {
+		clockTracker = nil
+		return
+	}
+	last, _ := lru.New[clockSource, time.Time](clockSourceCacheSize)
+	clockTracker = &clockRegressionTracker{check: *check, last: last}
+}
+
+// observe records the timestamp of the source and reports whether it regressed past the threshold.
+// The last-seen timestamp only moves forward so that a single skewed log does not flag the ones after it.
+func (c *clockRegressionTracker) observe(source clockSource, ts time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, ok := c.last.Get(source)
+	if !ok || ts.After(last) {
+		c.last.Add(source, ts)
+		return false
+	}
+	return last.Sub(ts) > c.check.Threshold
+}
+
+// flagClockRegression marks the log with the ClockRegressionAttribute when its timestamp regressed.
+func flagClockRegression(projectID int, lg *hlog.Log) {
+	tracker := clockTracker
+	if tracker == nil {
+		return
+	}
+	ts, ok := parseTimestamp(lg.Timestamp)
+	if !ok {
+		return
+	}
+	source := clockSource{projectID: projectID, serviceName: lg.Attributes[string(semconv.ServiceNameKey)]}
+	if tracker.observe(source, ts) {
+		lg.Attributes[ClockRegressionAttribute] = "true"
+	}
+}
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const (
+	CloudflareScriptNameAttribute = "cloudflare.script_name"
+	CloudflareOutcomeAttribute    = "cloudflare.outcome"
+)
+
+// cloudflareWorkersTraceEvent is a line of the workers trace events dataset of cloudflare
+// logpush. Each event holds the console logs and uncaught exceptions of one invocation.
+type cloudflareWorkersTraceEvent struct {
+	ScriptName       string  `json:"ScriptName"`
+	Outcome          string  `json:"Outcome"`
+	EventTimestampMs float64 `json:"EventTimestampMs"`
+	Event            struct {
+		Request *struct {
+			URL    string `json:"url"`
+			Method string `json:"method"`
+		} `json:"Request"`
+	} `json:"Event"`
+	Logs []struct {
+		Level       string        `json:"Level"`
+		Message     []interface{} `json:"Message"`
+		TimestampMs float64       `json:"TimestampMs"`
+	} `json:"Logs"`
+	Exceptions []struct {
+		Name        string  `json:"Name"`
+		Message     string  `json:"Message"`
+		TimestampMs float64 `json:"TimestampMs"`
+	} `json:"Exceptions"`
+}
+
+// cloudflareLogMessage joins the arguments of a console call as the worker runtime prints them,
+// keeping the objects as their json.
+func cloudflareLogMessage(args []interface{}) string {
+	parts := make([]string, len(args))
+	for idx, arg := range args {
+		if s, ok := arg.(string); ok {
+			parts[idx] = s
+		} else {
+			parts[idx] = coerceMessage(arg)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseCloudflareWorkersEvent expands the console logs and exceptions of a workers trace event
+// into logs, stamping the script and outcome of the invocation on each.
+func parseCloudflareWorkersEvent(event *cloudflareWorkersTraceEvent) []hlog.Log {
+	attributes := map[string]string{
+		CloudflareScriptNameAttribute: event.ScriptName,
+		CloudflareOutcomeAttribute:    event.Outcome,
+	}
+	if event.Event.Request != nil {
+		attributes[string(semconv.HTTPURLKey)] = event.Event.Request.URL
+		attributes[string(semconv.HTTPMethodKey)] = event.Event.Request.Method
+	}
+	newLog := func(timestampMs float64) hlog.Log {
+		lg := hlog.Log{Attributes: make(map[string]string, len(attributes))}
+		for k, v := range attributes {
+			if v != "" {
+				lg.Attributes[k] = v
+			}
+		}
+		if timestampMs == 0 {
+			timestampMs = event.EventTimestampMs
+		}
+		lg.Timestamp = epochTime(timestampMs).Format(hlog.TimestampFormatNano)
+		return lg
+	}
+
+	var logs []hlog.Log
+	for _, l := range event.Logs {
+		lg := newLog(l.TimestampMs)
+		lg.Message = cloudflareLogMessage(l.Message)
+		lg.Level = normalizeLevel(l.Level)
+		if lg.Level == "" {
+			lg.Level = model.LogLevelInfo.String()
+		}
+		logs = append(logs, lg)
+	}
+	for _, e := range event.Exceptions {
+		lg := newLog(e.TimestampMs)
+		lg.Message = e.Message
+		lg.Level = model.LogLevelError.String()
+		lg.Attributes[string(semconv.ExceptionTypeKey)] = e.Name
+		lg.Attributes[string(semconv.ExceptionMessageKey)] = e.Message
+		logs = append(logs, lg)
+	}
+	return logs
+}
+
+// HandleCloudflareWorkers ingests the workers trace events that cloudflare logpush delivers to an
+// http destination as gzipped json lines. The highlight headers are set through the `header_`
+// parameters of the destination url.
+func HandleCloudflareWorkers(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http cloudflare gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http cloudflare body")
+		writeBodyError(w, err)
+		return
+	}
+
+	var logs []hlog.Log
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event cloudflareWorkersTraceEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("invalid http cloudflare workers trace event")
+			writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not workers trace events")
+			return
+		}
+		// the test file that logpush sends when a destination is created is not a trace event
+		if event.ScriptName == "" {
+			continue
+		}
+		for _, lg := range parseCloudflareWorkersEvent(&event) {
+			if serviceName != "" {
+				lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+			} else {
+				lg.Attributes[string(semconv.ServiceNameKey)] = event.ScriptName
+			}
+			logs = append(logs, lg)
+		}
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const CloudflareWorkersTraceEvent = `{"ScriptName":"checkout-worker","Outcome":"exception","EventTimestampMs":1697062455000,"Event":{"Request":{"url":"https://shop.example.com/cart","method":"POST"}},"Logs":[{"Level":"log","Message":["cart loaded",{"items":3}],"TimestampMs":1697062455123},{"Level":"warn","Message":["inventory low"],"TimestampMs":1697062455200}],"Exceptions":[{"Name":"TypeError","Message":"price is undefined","TimestampMs":1697062455300}]}`
+
+func TestHandleCloudflareWorkers(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	// logpush sends a test file when the destination is created
+	_, _ = gz.Write([]byte(`{"content":"tests","filename":"test.txt"}` + "\n" + CloudflareWorkersTraceEvent + "\n"))
+	assert.NoError(t, gz.Close())
+
+	r, _ := http.NewRequest("POST", "/v1/logs/cloudflare", &b)
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	if assert.Equal(t, 3, len(*submitted)) {
+		first := (*submitted)[0].log
+		assert.Equal(t, `cart loaded {"items":3}`, first.Message)
+		assert.Equal(t, "info", first.Level)
+		assert.Equal(t, "2023-10-11T22:14:15.123Z", first.Timestamp)
+		assert.Equal(t, "checkout-worker", first.Attributes[CloudflareScriptNameAttribute])
+		assert.Equal(t, "exception", first.Attributes[CloudflareOutcomeAttribute])
+		assert.Equal(t, "checkout-worker", first.Attributes["service.name"])
+		assert.Equal(t, "https://shop.example.com/cart", first.Attributes["http.url"])
+
+		second := (*submitted)[1].log
+		assert.Equal(t, "inventory low", second.Message)
+		assert.Equal(t, "warn", second.Level)
+		assert.Equal(t, "2023-10-11T22:14:15.2Z", second.Timestamp)
+
+		third := (*submitted)[2].log
+		assert.Equal(t, "price is undefined", third.Message)
+		assert.Equal(t, "error", third.Level)
+		assert.Equal(t, "TypeError", third.Attributes["exception.type"])
+		assert.Equal(t, "checkout-worker", third.Attributes[CloudflareScriptNameAttribute])
+	}
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// DeadLetter is a log that could not be submitted.
+type DeadLetter struct {
+	Timestamp time.Time `json:"timestamp"`
+	ProjectID int       `json:"project_id"`
+	Error     string    `json:"error"`
+	Log       hlog.Log  `json:"log"`
+}
+
+// DeadLetterSink receives the logs that failed to be submitted so that they are not lost.
+type DeadLetterSink interface {
+	DeadLetter(ctx context.Context, letter DeadLetter)
+}
+
+// WriterDeadLetterSink writes dead letters as ndjson, one per line.
+type WriterDeadLetterSink struct {
+	mu     sync.Mutex
+	writer func() io.Writer
+}
+
+// NewStdoutDeadLetterSink writes dead letters to stdout, which is handy to debug submit failures
+// in local development.
+func NewStdoutDeadLetterSink() *WriterDeadLetterSink {
+	return &WriterDeadLetterSink{writer: func() io.Writer { return os.Stdout }}
+}
+
+// NewStderrDeadLetterSink writes dead letters to stderr.
+func NewStderrDeadLetterSink() *WriterDeadLetterSink {
+	return &WriterDeadLetterSink{writer: func() io.Writer { return os.Stderr }}
+}
+
+func (s *WriterDeadLetterSink) DeadLetter(ctx context.Context, letter DeadLetter) {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("failed to encode http logs dead letter")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.writer().Write(append(line, '\n')); err != nil {
+		log.WithContext(ctx).WithError(err).Error("failed to write http logs dead letter")
+	}
+}
+
+var deadLetterSink DeadLetterSink
+
+// SetDeadLetterSink sends the logs that fail to be submitted to the sink. Passing nil disables it.
+func SetDeadLetterSink(sink DeadLetterSink) {
+	deadLetterSink = sink
+}
+
+// deadLetter hands a log that failed to be submitted to the dead letter sink.
+func deadLetter(ctx context.Context, projectID int, lg hlog.Log, err error) {
+	if deadLetterSink == nil {
+		return
+	}
+	deadLetterSink.DeadLetter(ctx, DeadLetter{
+		Timestamp: time.Now().UTC(),
+		ProjectID: projectID,
+		Error:     err.Error(),
+		Log:       lg,
+	})
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func TestStdoutDeadLetterSink(t *testing.T) {
+	captureSubmits(t)
+	submitHTTPLogs = func(_ context.Context, _ trace.Tracer, _ int, logs []hlog.Log) []error {
+		errs := make([]error, len(logs))
+		errs[1] = errors.New("otlp exporter unavailable")
+		return errs
+	}
+	SetDeadLetterSink(NewStdoutDeadLetterSink())
+	defer SetDeadLetterSink(nil)
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	errs := submitLogs(context.Background(), 1, []hlog.Log{
+		{Message: "ok", Timestamp: "2023-10-11T22:14:15.123Z", Level: "info"},
+		{Message: "lost", Timestamp: "2023-10-11T22:14:16.123Z", Level: "warn"},
+	})
+	os.Stdout = stdout
+	assert.NoError(t, w.Close())
+	assert.Nil(t, errs[0])
+	assert.Error(t, errs[1])
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var letter DeadLetter
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &letter))
+		letters = append(letters, letter)
+	}
+	if assert.Equal(t, 1, len(letters)) {
+		assert.Equal(t, 1, letters[0].ProjectID)
+		assert.Equal(t, "otlp exporter unavailable", letters[0].Error)
+		assert.Equal(t, "lost", letters[0].Log.Message)
+		assert.Equal(t, "warn", letters[0].Log.Level)
+	}
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	hmetric "github.com/highlight/highlight/sdk/highlight-go/metric"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const metricDuplicates = "http-logs.duplicates"
+
+// DefaultDedupStoreSize is the number of keys kept by the in-memory dedup store.
+const DefaultDedupStoreSize = 1_000_000
+
+// DedupStore remembers the keys of the logs that were submitted so that retried deliveries are not
+// ingested twice. An implementation may be shared by the instances of a deployment.
+type DedupStore interface {
+	// Seen reports whether the key was added within its ttl.
+	Seen(ctx context.Context, key string) bool
+	// Add remembers the key for the ttl.
+	Add(ctx context.Context, key string, ttl time.Duration)
+}
+
+// MemoryDedupStore is the default DedupStore, which keeps a bounded number of keys in memory and
+// evicts the least recently used ones first.
+type MemoryDedupStore struct {
+	mu      sync.Mutex
+	expires *lru.Cache[string, time.Time]
+}
+
+// NewMemoryDedupStore returns a DedupStore holding up to size keys. A size of zero uses the
+// DefaultDedupStoreSize.
+func NewMemoryDedupStore(size int) *MemoryDedupStore {
+	if size <= 0 {
+		size = DefaultDedupStoreSize
+	}
+	expires, _ := lru.New[string, time.Time](size)
+	return &MemoryDedupStore{expires: expires}
+}
+
+func (s *MemoryDedupStore) Seen(_ context.Context, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.expires.Get(key)
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		s.expires.Remove(key)
+		return false
+	}
+	return true
+}
+
+func (s *MemoryDedupStore) Add(_ context.Context, key string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expires.Add(key, time.Now().Add(ttl))
+}
+
+var firehoseDedup = struct {
+	sync.RWMutex
+	store DedupStore
+	ttl   time.Duration
+}{}
+
+// SetFirehoseDedup skips the firehose logs that were already submitted within the ttl, since
+// firehose retries a whole delivery when any of it fails. Passing a nil store or a zero ttl
+// disables it.
+func SetFirehoseDedup(store DedupStore, ttl time.Duration) {
+	firehoseDedup.Lock()
+	defer firehoseDedup.Unlock()
+	if ttl <= 0 {
+		store = nil
+	}
+	firehoseDedup.store = store
+	firehoseDedup.ttl = ttl
+}
+
+func getFirehoseDedup() (DedupStore, time.Duration) {
+	firehoseDedup.RLock()
+	defer firehoseDedup.RUnlock()
+	return firehoseDedup.store, firehoseDedup.ttl
+}
+
+// firehoseDedupKeys returns the key of each log of a firehose request. Cloudwatch events are
+// keyed by their event id, which is kept when they are redelivered by another request, while
+// other logs are keyed by their position in the request since firehose retries reuse its id.
+func firehoseDedupKeys(projectID int, requestId string, logs []hlog.Log, records []int) []string {
+	keys := make([]string, len(logs))
+	position := 0
+	for idx, lg := range logs {
+		if idx > 0 && records[idx] != records[idx-1] {
+			position = 0
+		}
+		if eventID := lg.Attributes[CloudWatchEventIDAttribute]; eventID != "" {
+			keys[idx] = fmt.Sprintf("%d:event:%s", projectID, eventID)
+		} else {
+			keys[idx] = fmt.Sprintf("%d:request:%s:%d:%d", projectID, requestId, records[idx], position)
+		}
+		position++
+	}
+	return keys
+}
+
+// dropDuplicateLogs removes the logs of a firehose request that were already submitted, returning
+// the keys of the kept logs and the number of duplicates.
+func dropDuplicateLogs(ctx context.Context, projectID int, requestId string, logs []hlog.Log, records []int) ([]hlog.Log, []int, []string, int) {
+	store, _ := getFirehoseDedup()
+	if store == nil {
+		return logs, records, nil, 0
+	}
+	var kept []hlog.Log
+	var keptRecords []int
+	var keptKeys []string
+	for idx, key := range firehoseDedupKeys(projectID, requestId, logs, records) {
+		if store.Seen(ctx, key) {
+			continue
+		}
+		kept = append(kept, logs[idx])
+		keptRecords = append(keptRecords, records[idx])
+		keptKeys = append(keptKeys, key)
+	}
+	duplicates := len(logs) - len(kept)
+	if duplicates > 0 {
+		hmetric.Incr(ctx, metricDuplicates, metricTags(endpointFirehose, projectID), float64(duplicates))
+	}
+	return kept, keptRecords, keptKeys, duplicates
+}
+
+// markSubmittedLogs remembers the keys of the logs whose record was submitted. The logs of a
+// failed record are not remembered so that they are ingested when firehose retries them.
+func markSubmittedLogs(ctx context.Context, keys []string, records []int, failed []firehoseRecordError) {
+	store, ttl := getFirehoseDedup()
+	if store == nil || keys == nil {
+		return
+	}
+	failedRecords := make(map[int]bool, len(failed))
+	for _, f := range failed {
+		failedRecords[f.Index] = true
+	}
+	for idx, key := range keys {
+		if !failedRecords[records[idx]] {
+			store.Add(ctx, key, ttl)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryDedupStore(2)
+	assert.False(t, store.Seen(ctx, "a"))
+
+	store.Add(ctx, "a", time.Minute)
+	assert.True(t, store.Seen(ctx, "a"))
+
+	store.Add(ctx, "b", -time.Second)
+	assert.False(t, store.Seen(ctx, "b"), "expired keys are not seen")
+
+	// the store is bounded, evicting the least recently used key
+	store.Add(ctx, "c", time.Minute)
+	store.Add(ctx, "d", time.Minute)
+	assert.False(t, store.Seen(ctx, "a"))
+	assert.True(t, store.Seen(ctx, "d"))
+}
+
+func TestHandleFirehoseLogDedup(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetFirehoseDedup(NewMemoryDedupStore(0), time.Minute)
+	defer SetFirehoseDedup(nil, 0)
+
+	fail := true
+	submitHTTPLogs = func(_ context.Context, _ trace.Tracer, projectID int, logs []hlog.Log) []error {
+		errs := make([]error, len(logs))
+		for idx, lg := range logs {
+			if lg.Message == "flaky" && fail {
+				errs[idx] = errors.New("flaky log")
+				continue
+			}
+			*submitted = append(*submitted, submittedLog{projectID: projectID, log: lg})
+		}
+		return errs
+	}
+
+	cloudwatch := `{"messageType":"DATA_MESSAGE","logGroup":"/aws/lambda/checkout","logEvents":[{"id":"1","timestamp":1697062455000,"message":"order placed"},{"id":"2","timestamp":1697062456000,"message":"order shipped"}]}`
+	deliver := func() (int, int) {
+		w := httptest.NewRecorder()
+		HandleFirehoseLog(w, newFirehoseRequest(cloudwatch, "raw record", "flaky"))
+		var response struct {
+			Duplicates int `json:"duplicates"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response.Duplicates
+	}
+
+	code, duplicates := deliver()
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.Equal(t, 0, duplicates)
+	assert.Equal(t, 3, len(*submitted))
+
+	// the retry only ingests the record that failed
+	fail = false
+	code, duplicates = deliver()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, duplicates)
+	if assert.Equal(t, 4, len(*submitted)) {
+		assert.Equal(t, "flaky", (*submitted)[3].log.Message)
+	}
+
+	code, duplicates = deliver()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 4, duplicates)
+	assert.Equal(t, 4, len(*submitted))
+}
+
+func TestFirehoseDedupKeys(t *testing.T) {
+	logs := []hlog.Log{
+		{Attributes: map[string]string{CloudWatchEventIDAttribute: "123"}},
+		{Attributes: map[string]string{}},
+		{Attributes: map[string]string{}},
+		{Attributes: map[string]string{}},
+	}
+	assert.Equal(t, []string{
+		"1:event:123",
+		"1:request:abc:0:1",
+		"1:request:abc:2:0",
+		"1:request:abc:2:1",
+	}, firehoseDedupKeys(1, "abc", logs, []int{0, 0, 2, 2}))
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Denylist drops logs whose message contains any of the substrings or matches any of the patterns.
+type Denylist struct {
+	Substrings []string
+	Patterns   []*regexp.Regexp
+}
+
+func (d *Denylist) Matches(message string) bool {
+	for _, s := range d.Substrings {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	for _, p := range d.Patterns {
+		if p.MatchString(message) {
+			return true
+		}
+	}
+	return false
+}
+
+var denylists = struct {
+	sync.RWMutex
+	byProject map[int]*Denylist
+}{byProject: make(map[int]*Denylist)}
+
+// SetDenylist replaces the denylist of a project. It may be called at any time to hot-reload the
+// patterns and takes effect for the next ingested log. Passing nil removes the project's denylist.
+func SetDenylist(projectID int, denylist *Denylist) {
+	denylists.Lock()
+	defer denylists.Unlock()
+	if denylist == nil {
+		delete(denylists.byProject, projectID)
+		return
+	}
+	denylists.byProject[projectID] = denylist
+}
+
+func isDenylisted(projectID int, message string) bool {
+	denylists.RLock()
+	denylist, ok := denylists.byProject[projectID]
+	denylists.RUnlock()
+	return ok && denylist.Matches(message)
+}
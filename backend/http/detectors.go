@@ -0,0 +1,44 @@
+package http
+
+import "sync"
+
+// FirehoseDetector is a format that firehose records are detected as before falling back to raw logs.
+type FirehoseDetector string
+
+const (
+	// FirehoseDetectorASFF detects security hub findings in the aws security finding format.
+	FirehoseDetectorASFF FirehoseDetector = "asff"
+	// FirehoseDetectorEMF detects cloudwatch embedded metric format documents.
+	FirehoseDetectorEMF FirehoseDetector = "emf"
+	// FirehoseDetectorCloudWatch detects cloudwatch logs subscription payloads.
+	FirehoseDetectorCloudWatch FirehoseDetector = "cloudwatch"
+)
+
+var disabledFirehoseDetectors = struct {
+	sync.RWMutex
+	byProject map[int]map[FirehoseDetector]bool
+}{byProject: make(map[int]map[FirehoseDetector]bool)}
+
+// SetDisabledFirehoseDetectors disables detecting the formats for the firehose records of the project,
+// so that its records are treated as raw logs instead. Every detector is enabled by default, and passing
+// no detectors enables them all again.
+func SetDisabledFirehoseDetectors(projectID int, detectors ...FirehoseDetector) {
+	disabledFirehoseDetectors.Lock()
+	defer disabledFirehoseDetectors.Unlock()
+	if len(detectors) == 0 {
+		delete(disabledFirehoseDetectors.byProject, projectID)
+		return
+	}
+	disabled := make(map[FirehoseDetector]bool)
+	for _, detector := range detectors {
+		disabled[detector] = true
+	}
+	disabledFirehoseDetectors.byProject[projectID] = disabled
+}
+
+// firehoseDetectorEnabled reports whether the format should be detected for the records of the project.
+func firehoseDetectorEnabled(projectID int, detector FirehoseDetector) bool {
+	disabledFirehoseDetectors.RLock()
+	defer disabledFirehoseDetectors.RUnlock()
+	return !disabledFirehoseDetectors.byProject[projectID][detector]
+}
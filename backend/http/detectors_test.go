@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisabledFirehoseDetectors(t *testing.T) {
+	submitted := captureSubmits(t)
+	defer SetDisabledFirehoseDetectors(1)
+
+	cloudtrail := `{"Records":[{"eventVersion":"1.08","eventSource":"s3.amazonaws.com","eventName":"GetObject","awsRegion":"us-east-1"}]}`
+	cloudwatch := `{"messageType":"DATA_MESSAGE","logGroup":"/aws/lambda/checkout","logStream":"stream","logEvents":[{"id":"1","timestamp":1697062455123,"message":"order placed"}]}`
+
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(cloudwatch))
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "order placed", (*submitted)[0].log.Message)
+	}
+
+	// with the detector disabled the records of the project are raw logs
+	*submitted = nil
+	SetDisabledFirehoseDetectors(1, FirehoseDetectorCloudWatch)
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(cloudtrail, cloudwatch))
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 2, len(*submitted)) {
+		assert.Equal(t, cloudtrail, (*submitted)[0].log.Message)
+		assert.Equal(t, cloudwatch, (*submitted)[1].log.Message)
+		assert.NotContains(t, (*submitted)[1].log.Attributes, CloudWatchEventIDAttribute)
+	}
+
+	// other projects are not affected
+	assert.True(t, firehoseDetectorEnabled(2, FirehoseDetectorCloudWatch))
+	assert.True(t, firehoseDetectorEnabled(1, FirehoseDetectorEMF))
+
+	SetDisabledFirehoseDetectors(1)
+	assert.True(t, firehoseDetectorEnabled(1, FirehoseDetectorCloudWatch))
+}
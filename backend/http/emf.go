@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+)
+
+type emfMetadata struct {
+	Timestamp         int64
+	CloudWatchMetrics []struct {
+		Namespace string
+	}
+}
+
+// parseEMFLog converts a CloudWatch embedded metric format document into a log.
+// The _aws metadata provides the timestamp and the remaining top level dimension and
+// metric fields become attributes, keeping any message-like field as the message.
+func parseEMFLog(ctx context.Context, msg []byte) (*hlog.Log, bool) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &doc); err != nil {
+		return nil, false
+	}
+	awsJSON, ok := doc["_aws"]
+	if !ok {
+		return nil, false
+	}
+	var metadata emfMetadata
+	if err := json.Unmarshal(awsJSON, &metadata); err != nil || len(metadata.CloudWatchMetrics) == 0 {
+		return nil, false
+	}
+
+	lg := hlog.Log{
+		Attributes: make(map[string]string),
+		Timestamp:  time.UnixMilli(metadata.Timestamp).UTC().Format(hlog.TimestampFormat),
+		Level:      model.LogLevelInfo.String(),
+		Message:    metadata.CloudWatchMetrics[0].Namespace,
+	}
+	lg.Attributes["emf.namespace"] = metadata.CloudWatchMetrics[0].Namespace
+
+	for k, raw := range doc {
+		if k == "_aws" {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			continue
+		}
+		if has := map[string]bool{"message": true, "msg": true, "Message": true}[k]; has {
+			if str, ok := v.(string); ok {
+				lg.Message = str
+				continue
+			}
+		}
+		for key, value := range formatAttributes(ctx, k, v) {
+			lg.Attributes[key] = value
+		}
+	}
+	return &lg, true
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const defaultMaxBodyBytes = 10 << 20
+
+var maxBodyBytes int64 = defaultMaxBodyBytes
+
+// SetMaxBodyBytes caps the size in bytes of a request body, both as sent and once decompressed.
+// A non-positive limit restores the 10MiB default.
+func SetMaxBodyBytes(limit int64) {
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	maxBodyBytes = limit
+}
+
+// limitBody fails reads past the max body size with an *http.MaxBytesError.
+func limitBody(r io.Reader) io.Reader {
+	return http.MaxBytesReader(nil, io.NopCloser(r), maxBodyBytes)
+}
+
+// writeBodyError responds with a 413 json error when the body exceeded the max body size,
+// with a 503 when decompression is saturated and with a 400 otherwise.
+func writeBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errDecompressionSaturated) {
+		writeError(w, http.StatusServiceUnavailable, ErrorCodeOverloaded, err.Error())
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrorCodeBodyTooLarge, fmt.Sprintf("request body exceeds the limit of %d bytes", maxBytesErr.Limit))
+		return
+	}
+	if errors.Is(err, errUnsupportedEncoding) {
+		writeError(w, http.StatusBadRequest, ErrorCodeUnsupportedEncoding, err.Error())
+		return
+	}
+	// the errors of decoding the body are internal, such as the offset of a malformed gzip stream
+	writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "failed to decode the request body")
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+var errDecompressionSaturated = errors.New("too many concurrent decompressions, retry later")
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+var decompressions = struct {
+	sync.RWMutex
+	slots chan struct{}
+}{}
+
+// SetMaxConcurrentDecompressions bounds the number of bodies decompressed at once, so that a flood
+// of compressed requests can not exhaust memory and cpu. Requests past the limit are shed with a 503
+// rather than queued. Zero disables the limit.
+func SetMaxConcurrentDecompressions(limit int) {
+	decompressions.Lock()
+	defer decompressions.Unlock()
+	if limit <= 0 {
+		decompressions.slots = nil
+		return
+	}
+	decompressions.slots = make(chan struct{}, limit)
+}
+
+// acquireDecompression takes a decompression slot, returning the func that releases it.
+func acquireDecompression() (func(), error) {
+	decompressions.RLock()
+	slots := decompressions.slots
+	decompressions.RUnlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		var once sync.Once
+		// the slot is returned to the channel it was taken from in case the limit is reconfigured
+		return func() { once.Do(func() { <-slots }) }, nil
+	default:
+		return nil, errDecompressionSaturated
+	}
+}
+
+// decompressionReader holds a decompression slot until the body is read to the end, fails or is closed.
+type decompressionReader struct {
+	io.Reader
+	release func()
+}
+
+func (r *decompressionReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil {
+		r.release()
+	}
+	return n, err
+}
+
+func (r *decompressionReader) Close() error {
+	r.release()
+	return nil
+}
+
+// decodeBody decompresses a body sent with the given content encoding. An empty or identity
+// encoding returns the body as is and an unsupported one is an error naming the encoding.
+// Decompressing takes one of the slots limited by SetMaxConcurrentDecompressions, which is
+// held until the returned body is read to the end or closed.
+func decodeBody(encoding string, r io.Reader) (io.ReadCloser, error) {
+	var decode func() (io.Reader, error)
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		decode = func() (io.Reader, error) {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			// log archives appended to by `gzip -c >>` hold several gzip members that must all be read
+			gz.Multistream(true)
+			return gz, nil
+		}
+	case "zstd":
+		decode = func() (io.Reader, error) {
+			// a single threaded decoder decodes synchronously, so it does not need to be closed
+			return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		}
+	case "br":
+		decode = func() (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		}
+	case "deflate":
+		decode = func() (io.Reader, error) {
+			return zlib.NewReader(r)
+		}
+	default:
+		return nil, fmt.Errorf("%w %q, supported encodings are gzip, zstd, br and deflate", errUnsupportedEncoding, encoding)
+	}
+
+	release, err := acquireDecompression()
+	if err != nil {
+		return nil, err
+	}
+	body, err := decode()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &decompressionReader{Reader: body, release: release}, nil
+}
+
+// sniffEncoding detects the compression of data that carries no content encoding, such as a
+// firehose record, from its magic bytes. Brotli and deflate have no reliable magic bytes.
+func sniffEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(data, zstdMagic):
+		return "zstd"
+	}
+	return ""
+}
@@ -0,0 +1,202 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func compress(t *testing.T, encoding string, data string) []byte {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "zstd":
+		var err error
+		w, err = zstd.NewWriter(&b)
+		assert.NoError(t, err)
+	case "br":
+		w = brotli.NewWriter(&b)
+	case "deflate":
+		w = zlib.NewWriter(&b)
+	default:
+		return []byte(data)
+	}
+	_, err := w.Write([]byte(data))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	for _, encoding := range []string{"", "identity", "gzip", "zstd", "br", "deflate"} {
+		body, err := decodeBody(encoding, bytes.NewReader(compress(t, encoding, "hello world")))
+		assert.NoError(t, err, encoding)
+		decoded, err := io.ReadAll(body)
+		assert.NoError(t, err, encoding)
+		assert.Equal(t, "hello world", string(decoded), encoding)
+	}
+
+	_, err := decodeBody("compress", strings.NewReader("hello world"))
+	assert.ErrorContains(t, err, `"compress"`)
+}
+
+func TestHandleFirehoseLogEncodings(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	for _, encoding := range []string{"gzip", "zstd", "br", "deflate"} {
+		body, _ := io.ReadAll(newFirehoseRequest("hello from " + encoding).Body)
+		r, _ := http.NewRequest("POST", "/v1/logs/firehose", bytes.NewReader(compress(t, encoding, string(body))))
+		r.Header.Set("Content-Encoding", encoding)
+		r.Header.Set("X-Amz-Firehose-Common-Attributes", `{"commonAttributes":{"x-highlight-project":"1"}}`)
+		w := httptest.NewRecorder()
+		HandleFirehoseLog(w, r)
+		assert.Equal(t, 200, w.Code, encoding)
+	}
+
+	// records compressed by the producer are detected from their magic bytes
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(string(compress(t, "zstd", "zstd record")), string(compress(t, "gzip", "gzip record"))))
+	assert.Equal(t, 200, w.Code)
+
+	var messages []string
+	for _, s := range *submitted {
+		messages = append(messages, s.log.Message)
+	}
+	assert.Equal(t, []string{"hello from gzip", "hello from zstd", "hello from br", "hello from deflate", "zstd record", "gzip record"}, messages)
+
+	r := newFirehoseRequest("hello")
+	r.Header.Set("Content-Encoding", "compress")
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unsupported_encoding"`)
+	assert.Contains(t, w.Body.String(), "compress")
+}
+
+func TestHandleJSONLogEncodings(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	for _, encoding := range []string{"gzip", "zstd", "br", "deflate"} {
+		r, _ := http.NewRequest("POST", "/v1/logs/json", bytes.NewReader(compress(t, encoding, fmt.Sprintf(`{"message":"hello from %s","user":{"id":1}}`, encoding))))
+		r.Header.Set("Content-Encoding", encoding)
+		r.Header.Set(LogDrainProjectHeader, "1")
+		w := httptest.NewRecorder()
+		HandleJSONLog(w, r)
+		assert.Equal(t, 200, w.Code, encoding)
+	}
+
+	// ndjson bodies are split into lines once they are decompressed
+	r, _ := http.NewRequest("POST", "/v1/logs/json", bytes.NewReader(compress(t, "gzip", "{\"message\":\"first\"}\n{\"message\":\"second\",\"level\":\"warn\"}\n")))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	var messages []string
+	for _, s := range *submitted {
+		messages = append(messages, s.log.Message)
+	}
+	assert.Equal(t, []string{"hello from gzip", "hello from zstd", "hello from br", "hello from deflate", "first", "second"}, messages)
+	assert.Equal(t, "1", (*submitted)[0].log.Attributes["user.id"])
+	assert.Equal(t, "warn", (*submitted)[5].log.Level)
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	captureSubmits(t)
+	SetMaxBodyBytes(1024)
+	defer SetMaxBodyBytes(0)
+
+	send := func(handler http.HandlerFunc, path string, encoding string, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", path, bytes.NewReader(compress(t, encoding, body)))
+		r.Header.Set("Content-Encoding", encoding)
+		r.Header.Set(LogDrainProjectHeader, "1")
+		r.Header.Set("X-Amz-Firehose-Common-Attributes", `{"commonAttributes":{"x-highlight-project":"1"}}`)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := send(HandleJSONLog, "/v1/logs/json", "", `{"message":"hello"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(HandleJSONLog, "/v1/logs/json", "", fmt.Sprintf(`{"message":"%s"}`, strings.Repeat("a", 2048)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":{"code":"body_too_large","message":"request body exceeds the limit of 1024 bytes"}}`, w.Body.String())
+
+	// a body that is small on the wire is still limited once decompressed
+	bomb := fmt.Sprintf(`{"message":"%s"}`, strings.Repeat("a", 256<<10))
+	assert.Less(t, len(compress(t, "gzip", bomb)), 1024)
+	w = send(HandleJSONLog, "/v1/logs/json", "gzip", bomb)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	firehose, _ := io.ReadAll(newFirehoseRequest(strings.Repeat("a", 2048)).Body)
+	w = send(HandleFirehoseLog, "/v1/logs/firehose", "zstd", string(firehose))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// records compressed by the producer are limited once decompressed as well, failing only that record
+	firehose, _ = io.ReadAll(newFirehoseRequest(string(compress(t, "gzip", strings.Repeat("a", 256<<10)))).Body)
+	w = send(HandleFirehoseLog, "/v1/logs/firehose", "", string(firehose))
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Contains(t, w.Body.String(), `"failed":[{"index":0,"error":"http: request body too large"}]`)
+}
+
+func TestMaxConcurrentDecompressions(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetMaxConcurrentDecompressions(2)
+	defer SetMaxConcurrentDecompressions(0)
+
+	send := func(encoding string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/v1/logs/json", bytes.NewReader(compress(t, encoding, `{"message":"hello"}`)))
+		r.Header.Set("Content-Encoding", encoding)
+		r.Header.Set(LogDrainProjectHeader, "1")
+		w := httptest.NewRecorder()
+		HandleJSONLog(w, r)
+		return w
+	}
+
+	// bodies that are still being read hold their slots
+	var held []io.ReadCloser
+	for i := 0; i < 2; i++ {
+		body, err := decodeBody("zstd", bytes.NewReader(compress(t, "zstd", "hello")))
+		assert.NoError(t, err)
+		held = append(held, body)
+	}
+	_, err := decodeBody("gzip", bytes.NewReader(compress(t, "gzip", "hello")))
+	assert.ErrorIs(t, err, errDecompressionSaturated)
+
+	w := send("br")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	// uncompressed bodies do not need a slot
+	w = send("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, len(*submitted))
+
+	// a slot is released once its body is read to the end
+	_, err = io.ReadAll(held[0])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, send("gzip").Code)
+	// or closed
+	held[0], err = decodeBody("zstd", bytes.NewReader(compress(t, "zstd", "hello")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, send("deflate").Code)
+	assert.NoError(t, held[1].Close())
+	assert.NoError(t, held[1].Close())
+	assert.Equal(t, http.StatusOK, send("deflate").Code)
+	assert.Equal(t, http.StatusOK, send("zstd").Code)
+	assert.Equal(t, 4, len(*submitted))
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const (
+	defaultIngestErrorsSize = 100
+	ingestErrorDetailLimit  = 512
+)
+
+// IngestError describes a request that the http log endpoints rejected.
+type IngestError struct {
+	Timestamp time.Time `json:"timestamp"`
+	Endpoint  string    `json:"endpoint"`
+	Project   string    `json:"project,omitempty"`
+	Status    int       `json:"status"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// ingestErrorRing keeps the most recent ingestion errors in memory.
+type ingestErrorRing struct {
+	mu      sync.Mutex
+	entries []IngestError
+	next    int
+	full    bool
+}
+
+func newIngestErrorRing(size int) *ingestErrorRing {
+	return &ingestErrorRing{entries: make([]IngestError, size)}
+}
+
+func (b *ingestErrorRing) add(e IngestError) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// list returns the errors from newest to oldest.
+func (b *ingestErrorRing) list() []IngestError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := b.next
+	if b.full {
+		n = len(b.entries)
+	}
+	result := make([]IngestError, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, b.entries[(b.next-i+len(b.entries))%len(b.entries)])
+	}
+	return result
+}
+
+var ingestErrors = newIngestErrorRing(defaultIngestErrorsSize)
+
+// SetIngestErrorsSize sets how many of the most recent ingestion errors are kept, clearing the current ones.
+func SetIngestErrorsSize(size int) {
+	if size <= 0 {
+		size = defaultIngestErrorsSize
+	}
+	ingestErrors = newIngestErrorRing(size)
+}
+
+var ingestErrorsToken string
+
+// SetIngestErrorsToken sets the bearer token required to read the ingestion errors.
+// The errors endpoint is disabled while the token is empty.
+func SetIngestErrorsToken(token string) {
+	ingestErrorsToken = token
+}
+
+// ingestErrorsResponseWriter captures the status and the start of the body of failed responses.
+type ingestErrorsResponseWriter struct {
+	http.ResponseWriter
+	status int
+	detail strings.Builder
+}
+
+func (w *ingestErrorsResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *ingestErrorsResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 && w.detail.Len() < ingestErrorDetailLimit {
+		w.detail.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *ingestErrorsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *ingestErrorsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// IngestErrorsMiddleware records the requests that were rejected with an error status.
+func IngestErrorsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &ingestErrorsResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status < 400 {
+			return
+		}
+		project := r.Header.Get(LogDrainProjectHeader)
+		if project == "" {
+			project = r.URL.Query().Get(LogDrainProjectQueryParam)
+		}
+		ingestErrors.add(IngestError{
+			Timestamp: time.Now().UTC(),
+			Endpoint:  r.URL.Path,
+			Project:   project,
+			Status:    rw.status,
+			Reason:    http.StatusText(rw.status),
+			Detail:    hlog.TruncateUTF8(strings.TrimSpace(rw.detail.String()), ingestErrorDetailLimit),
+		})
+	})
+}
+
+// HandleIngestErrors returns the most recent ingestion errors, newest first.
+func HandleIngestErrors(w http.ResponseWriter, r *http.Request) {
+	if ingestErrorsToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(getBearerToken(r)), []byte(ingestErrorsToken)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ingestErrors.list())
+}
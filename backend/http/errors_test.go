@@ -0,0 +1,55 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestErrors(t *testing.T) {
+	captureSubmits(t)
+	SetIngestErrorsSize(2)
+	SetIngestErrorsToken("secret")
+	defer SetIngestErrorsSize(0)
+	defer SetIngestErrorsToken("")
+
+	router := newTestRouter()
+	send := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	r, _ := http.NewRequest("POST", "/v1/logs/raw", strings.NewReader("no project"))
+	assert.Equal(t, http.StatusBadRequest, send(r).Code)
+	r, _ = http.NewRequest("POST", "/v1/logs/json", strings.NewReader("{not json"))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	assert.Equal(t, http.StatusBadRequest, send(r).Code)
+	r, _ = http.NewRequest("POST", fmt.Sprintf("/v1/logs/influx?%s=1", LogDrainProjectQueryParam), strings.NewReader("cpu"))
+	assert.Equal(t, http.StatusBadRequest, send(r).Code)
+	r, _ = http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("ok"))
+	assert.Equal(t, http.StatusOK, send(r).Code)
+
+	r, _ = http.NewRequest("GET", "/v1/logs/errors", nil)
+	assert.Equal(t, http.StatusUnauthorized, send(r).Code)
+
+	r.Header.Set("Authorization", "Bearer secret")
+	w := send(r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var errs []IngestError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errs))
+	// the buffer is bounded, so the oldest error was evicted
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, "/v1/logs/influx", errs[0].Endpoint)
+	assert.Equal(t, "1", errs[0].Project)
+	assert.Equal(t, http.StatusBadRequest, errs[0].Status)
+	assert.Contains(t, errs[0].Detail, "line protocol")
+	assert.Equal(t, "/v1/logs/json", errs[1].Endpoint)
+	assert.Equal(t, "Bad Request", errs[1].Reason)
+}
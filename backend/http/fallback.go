@@ -0,0 +1,25 @@
+package http
+
+var fallbackAttributes map[string]string
+
+// SetFallbackAttributes configures the attributes added to logs that carry no attributes at all,
+// such as bare firehose messages, so that no log is stored without any context. Unlike the header
+// attributes they are never added to a log with metadata of its own. Passing nil disables it.
+func SetFallbackAttributes(attributes map[string]string) {
+	fallbackAttributes = attributes
+}
+
+// applyFallbackAttributes adds the fallback attributes when every attribute of the log is empty.
+func applyFallbackAttributes(attributes map[string]string) {
+	if len(fallbackAttributes) == 0 {
+		return
+	}
+	for _, v := range attributes {
+		if v != "" {
+			return
+		}
+	}
+	for k, v := range fallbackAttributes {
+		attributes[k] = v
+	}
+}
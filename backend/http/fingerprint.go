@@ -0,0 +1,36 @@
+package http
+
+import (
+	"regexp"
+)
+
+const MessageTemplateAttribute = "highlight.message_template"
+
+// FingerprintRule replaces every match of Pattern with Placeholder when computing a message template.
+type FingerprintRule struct {
+	Pattern     *regexp.Regexp
+	Placeholder string
+}
+
+// DefaultFingerprintRules are applied in order, so more specific patterns come first.
+var DefaultFingerprintRules = []FingerprintRule{
+	{Pattern: regexp.MustCompile(`"[^"]*"|'[^']*'`), Placeholder: "<str>"},
+	{Pattern: regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), Placeholder: "<uuid>"},
+	{Pattern: regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{16,}\b`), Placeholder: "<hex>"},
+	{Pattern: regexp.MustCompile(`\b\d+(?:\.\d+)?\b`), Placeholder: "<num>"},
+}
+
+var fingerprintRules []FingerprintRule
+
+// SetFingerprintRules enables stamping logs with a normalized MessageTemplateAttribute
+// so that similar messages can be grouped. Passing nil disables it.
+func SetFingerprintRules(rules []FingerprintRule) {
+	fingerprintRules = rules
+}
+
+func messageTemplate(message string) string {
+	for _, rule := range fingerprintRules {
+		message = rule.Pattern.ReplaceAllString(message, rule.Placeholder)
+	}
+	return message
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// fluentBitMessageKeys are the record keys holding the message, as written by the tail, systemd
+// and forward inputs.
+var fluentBitMessageKeys = []string{"log", "MESSAGE"}
+
+// fluentBitDateKey is the default json_date_key of the http output.
+const fluentBitDateKey = "date"
+
+// fluentBitRecords returns the records of a fluent bit http output body in any of its formats:
+// a json array of records, json lines with a record per line, or gelf objects.
+func fluentBitRecords(body []byte) ([]json.RawMessage, error) {
+	var records []json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(value, []byte("[")) {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(value, &batch); err != nil {
+				return nil, err
+			}
+			records = append(records, batch...)
+			continue
+		}
+		records = append(records, value)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("request body holds no fluent bit records")
+	}
+	return records, nil
+}
+
+func isGELFRecord(fields map[string]interface{}) bool {
+	_, hasVersion := fields["version"]
+	_, hasMessage := fields["short_message"]
+	return hasVersion && hasMessage
+}
+
+// parseGELFRecord converts a gelf message into a log. The additional fields are kept as attributes
+// without their underscore prefix.
+func parseGELFRecord(ctx context.Context, fields map[string]interface{}, now time.Time) hlog.Log {
+	lg := hlog.Log{
+		Attributes: map[string]string{},
+		Timestamp:  now.Format(hlog.TimestampFormatNano),
+	}
+	lg.Message, _ = fields["short_message"].(string)
+	lg.Level = inferLevel(lg.Message, nil)
+	// gelf levels are syslog severities
+	if level, ok := fields["level"].(float64); ok && level >= 0 && level <= 7 {
+		lg.Level = syslogLevel(uint8(level))
+	}
+	if ts, ok := parseTimestamp(fields["timestamp"]); ok {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+	}
+	if host, ok := fields["host"].(string); ok && host != "" {
+		lg.Attributes[string(semconv.HostNameKey)] = host
+	}
+	for k, v := range fields {
+		switch k {
+		case "version", "host", "short_message", "level", "timestamp":
+			continue
+		}
+		for key, value := range formatAttributes(ctx, strings.TrimPrefix(k, "_"), v) {
+			lg.Attributes[key] = value
+		}
+	}
+	return lg
+}
+
+// parseFluentBitRecord converts a fluent bit record into a log, reading the message of the
+// inputs that do not write a `message` and the timestamp from the date key.
+func parseFluentBitRecord(ctx context.Context, record json.RawMessage, now time.Time) (hlog.Log, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return hlog.Log{}, err
+	}
+	if isGELFRecord(fields) {
+		return parseGELFRecord(ctx, fields, now), nil
+	}
+
+	lg, err := parseJSONLog(ctx, record)
+	if err != nil {
+		return lg, err
+	}
+	for _, key := range fluentBitMessageKeys {
+		if message, ok := fields[key].(string); ok && lg.Message == "" {
+			lg.Message = strings.TrimRight(message, "\r\n")
+			delete(lg.Attributes, key)
+		}
+	}
+	if ts, ok := parseTimestamp(fields[fluentBitDateKey]); ok && lg.Timestamp == "" {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+		delete(lg.Attributes, fluentBitDateKey)
+	}
+	if lg.Timestamp == "" {
+		lg.Timestamp = now.Format(hlog.TimestampFormatNano)
+	}
+	if lg.Level == "" {
+		lg.Level = inferLevel(lg.Message, lg.Attributes)
+	}
+	return lg, nil
+}
+
+// HandleFluentBit ingests the requests of the fluent bit http output. The format of the output,
+// json, json_lines or gelf, is detected from the shape of the body so that a single endpoint
+// serves every format.
+func HandleFluentBit(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http fluent bit gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http fluent bit body")
+		writeBodyError(w, err)
+		return
+	}
+	body = decodeText(body, r.Header.Get("Content-Type"))
+
+	records, err := fluentBitRecords(body)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http fluent bit records")
+		writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not a fluent bit json, json_lines or gelf batch")
+		return
+	}
+
+	now := time.Now().UTC()
+	var logs []hlog.Log
+	for _, record := range records {
+		lg, err := parseFluentBitRecord(r.Context(), record, now)
+		if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("invalid http fluent bit record")
+			writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body holds a record that is not a json object")
+			return
+		}
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, lg)
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
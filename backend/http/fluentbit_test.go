@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleFluentBit(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `[{"date":1697062455.5,"log":"charge declined\n","stream":"stderr","kubernetes":{"pod_name":"checkout-7d9"}},{"date":1697062456,"log":"level=warn msg=\"slow response\"","stream":"stdout","kubernetes":{"pod_name":"checkout-7d9"}}]`,
+		},
+		{
+			name:        "json_lines",
+			contentType: "application/x-ndjson",
+			body: `{"date":"2023-10-11T22:14:15.5Z","log":"charge declined\n","stream":"stderr","kubernetes":{"pod_name":"checkout-7d9"}}
+{"date":"2023-10-11T22:14:16Z","log":"level=warn msg=\"slow response\"","stream":"stdout","kubernetes":{"pod_name":"checkout-7d9"}}
+`,
+		},
+		{
+			name:        "gelf",
+			contentType: "application/json",
+			body: `{"version":"1.1","host":"checkout-7d9","short_message":"charge declined","timestamp":1697062455.5,"level":3,"_stream":"stderr","_kubernetes":{"pod_name":"checkout-7d9"}}
+{"version":"1.1","host":"checkout-7d9","short_message":"slow response","timestamp":1697062456,"level":4,"_stream":"stdout","_kubernetes":{"pod_name":"checkout-7d9"}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			submitted := captureSubmits(t)
+
+			r, _ := http.NewRequest("POST", "/v1/logs/fluentbit", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			r.Header.Set(LogDrainProjectHeader, "1")
+			w := httptest.NewRecorder()
+			newTestRouter().ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			if assert.Equal(t, 2, len(*submitted)) {
+				first := (*submitted)[0].log
+				assert.Equal(t, "charge declined", first.Message)
+				assert.Equal(t, "2023-10-11T22:14:15.5Z", first.Timestamp)
+				assert.Equal(t, "stderr", first.Attributes["stream"])
+				assert.Equal(t, "checkout-7d9", first.Attributes["kubernetes.pod_name"])
+				assert.NotContains(t, first.Attributes, "date")
+
+				second := (*submitted)[1].log
+				assert.Contains(t, second.Message, "slow response")
+				assert.Equal(t, "warn", second.Level)
+				assert.Equal(t, "2023-10-11T22:14:16Z", second.Timestamp)
+			}
+		})
+	}
+}
+
+func TestHandleFluentBitInvalid(t *testing.T) {
+	captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/fluentbit", strings.NewReader(`[1, 2]`))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), ErrorCodeDecodeFailed)
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// IngestGate allows pausing ingestion of a project without a redeploy.
+type IngestGate interface {
+	// Paused reports whether ingestion of the project is paused and the reason it was paused.
+	Paused(ctx context.Context, projectID int) (bool, string, error)
+}
+
+// IngestPausedError is returned when a log is rejected because its project is paused.
+type IngestPausedError struct {
+	ProjectID int
+	Reason    string
+}
+
+func (e *IngestPausedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("ingestion is paused for project %d", e.ProjectID)
+	}
+	return fmt.Sprintf("ingestion is paused for project %d: %s", e.ProjectID, e.Reason)
+}
+
+// MemoryIngestGate is an IngestGate that only applies to a single instance.
+type MemoryIngestGate struct {
+	mu     sync.RWMutex
+	paused map[int]string
+}
+
+func NewMemoryIngestGate() *MemoryIngestGate {
+	return &MemoryIngestGate{paused: make(map[int]string)}
+}
+
+func (g *MemoryIngestGate) Pause(projectID int, reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused[projectID] = reason
+}
+
+func (g *MemoryIngestGate) Resume(projectID int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.paused, projectID)
+}
+
+func (g *MemoryIngestGate) Paused(_ context.Context, projectID int) (bool, string, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	reason, ok := g.paused[projectID]
+	return ok, reason, nil
+}
+
+// RedisIngestGate is an IngestGate shared by every instance using the same redis.
+type RedisIngestGate struct {
+	client redis.Cmdable
+}
+
+func NewRedisIngestGate(client redis.Cmdable) *RedisIngestGate {
+	return &RedisIngestGate{client: client}
+}
+
+func redisIngestGateKey(projectID int) string {
+	return fmt.Sprintf("http-logs-ingest-paused-%d", projectID)
+}
+
+func (g *RedisIngestGate) Pause(ctx context.Context, projectID int, reason string) error {
+	return g.client.Set(ctx, redisIngestGateKey(projectID), reason, 0).Err()
+}
+
+func (g *RedisIngestGate) Resume(ctx context.Context, projectID int) error {
+	return g.client.Del(ctx, redisIngestGateKey(projectID)).Err()
+}
+
+func (g *RedisIngestGate) Paused(ctx context.Context, projectID int) (bool, string, error) {
+	reason, err := g.client.Get(ctx, redisIngestGateKey(projectID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, "", nil
+	} else if err != nil {
+		return false, "", err
+	}
+	return true, reason, nil
+}
+
+var ingestGate IngestGate
+
+// SetIngestGate enables pausing ingestion per project. Passing nil disables it.
+func SetIngestGate(gate IngestGate) {
+	ingestGate = gate
+}
+
+// checkIngestGate returns an IngestPausedError when the project is paused.
+// Failures of the gate itself are logged and do not stop ingestion.
+func checkIngestGate(ctx context.Context, projectID int) error {
+	if ingestGate == nil {
+		return nil
+	}
+	paused, reason, err := ingestGate.Paused(ctx, projectID)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("project_id", projectID).Warn("failed to check http logs ingest gate")
+		return nil
+	}
+	if paused {
+		return &IngestPausedError{ProjectID: projectID, Reason: reason}
+	}
+	return nil
+}
+
+// submitErrorStatus returns the http status code to respond with when a submission fails.
+func submitErrorStatus(err error) int {
+	var paused *IngestPausedError
+	if errors.As(err, &paused) {
+		return http.StatusServiceUnavailable
+	}
+	var rateLimited *ProjectRateLimitedError
+	if errors.As(err, &rateLimited) {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadRequest
+}
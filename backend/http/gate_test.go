@@ -0,0 +1,42 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestGate(t *testing.T) {
+	submitted := captureSubmits(t)
+	gate := NewMemoryIngestGate()
+	SetIngestGate(gate)
+	defer SetIngestGate(nil)
+
+	send := func() *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("hello"))
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Equal(t, 1, len(*submitted))
+
+	gate.Pause(1, "cost incident")
+	w := send()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "cost incident")
+	assert.Equal(t, 1, len(*submitted))
+
+	gate.Pause(2, "abuse")
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Equal(t, 2, len(*submitted))
+
+	gate.Resume(1)
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Equal(t, 3, len(*submitted))
+}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// gcpPushEnvelope is the body of a pub/sub push subscription request.
+type gcpPushEnvelope struct {
+	Message struct {
+		Data        string            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageID   string            `json:"messageId"`
+		PublishTime string            `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// gcpLogEntry is a cloud logging LogEntry, as exported to pub/sub by a log router sink.
+type gcpLogEntry struct {
+	LogName  string `json:"logName"`
+	Resource struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels"`
+	} `json:"resource"`
+	Timestamp        string                 `json:"timestamp"`
+	ReceiveTimestamp string                 `json:"receiveTimestamp"`
+	Severity         string                 `json:"severity"`
+	InsertID         string                 `json:"insertId"`
+	Labels           map[string]string      `json:"labels"`
+	TextPayload      string                 `json:"textPayload"`
+	JSONPayload      map[string]interface{} `json:"jsonPayload"`
+	Trace            string                 `json:"trace"`
+	SpanID           string                 `json:"spanId"`
+}
+
+var gcpProjectAttribute string
+
+// SetGCPProjectAttribute sets the pub/sub message attribute holding the project verbose id of a
+// gcp log, used when the request has no project header. Passing an empty attribute disables it.
+func SetGCPProjectAttribute(attribute string) {
+	gcpProjectAttribute = attribute
+}
+
+// gcpLevel maps cloud logging severities onto log levels. DEFAULT and unknown severities are info.
+func gcpLevel(severity string) string {
+	if level := normalizeLevel(severity); level != "" {
+		return level
+	}
+	return model.LogLevelInfo.String()
+}
+
+// getGCPProjectParams reads the project from the highlight headers, falling back to the
+// configured attribute of the pub/sub message.
+func getGCPProjectParams(r *http.Request, attributes map[string]string) (int, string, error) {
+	if r.Header.Get(LogDrainProjectHeader) != "" || gcpProjectAttribute == "" || attributes[gcpProjectAttribute] == "" {
+		return getProjectParams(r)
+	}
+	projectVerboseID := attributes[gcpProjectAttribute]
+	projectID, err := parseProjectID(projectVerboseID)
+	if err != nil {
+		auditAuthFailure(r, projectVerboseID, "invalid project")
+		log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", projectVerboseID).Error("failed to parse highlight project id from gcp pub/sub attribute")
+		return 0, "", err
+	}
+	serviceName, err := getHeader(r, LogDrainServiceHeader)
+	if err != nil {
+		return 0, "", err
+	}
+	return projectID, serviceName, nil
+}
+
+// parseGCPLogEntry converts a cloud logging entry into a log. The message is the text payload or
+// the `message` of the json payload, whose other fields are kept as attributes.
+func parseGCPLogEntry(ctx context.Context, entry *gcpLogEntry, fallback time.Time) hlog.Log {
+	lg := hlog.Log{
+		Attributes: map[string]string{},
+		Message:    entry.TextPayload,
+		Level:      gcpLevel(entry.Severity),
+		Timestamp:  fallback.Format(hlog.TimestampFormatNano),
+	}
+	if ts, ok := parseTimestamp(entry.Timestamp); ok {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+	} else if ts, ok := parseTimestamp(entry.ReceiveTimestamp); ok {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+	}
+
+	for k, v := range entry.JSONPayload {
+		if message, ok := v.(string); ok && k == "message" && lg.Message == "" {
+			lg.Message = message
+			continue
+		}
+		for key, value := range formatAttributes(ctx, k, v) {
+			lg.Attributes[key] = value
+		}
+	}
+	for k, v := range entry.Labels {
+		lg.Attributes["labels."+k] = v
+	}
+	for k, v := range entry.Resource.Labels {
+		lg.Attributes["resource.labels."+k] = v
+	}
+	for k, v := range map[string]string{
+		"resource.type": entry.Resource.Type,
+		"log_name":      entry.LogName,
+		"insert_id":     entry.InsertID,
+		"trace":         entry.Trace,
+		"span_id":       entry.SpanID,
+	} {
+		if v != "" {
+			lg.Attributes[k] = v
+		}
+	}
+	return lg
+}
+
+// HandleGCPLog ingests the cloud logging entries delivered by a pub/sub push subscription.
+// Each request holds a single message, so it is processed before acknowledging with a 200.
+func HandleGCPLog(w http.ResponseWriter, r *http.Request) {
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http gcp gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http gcp body")
+		writeBodyError(w, err)
+		return
+	}
+
+	var envelope gcpPushEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http gcp pub/sub envelope")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	projectID, serviceName, err := getGCPProjectParams(r, envelope.Message.Attributes)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid base64 gcp pub/sub message")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fallback := time.Now().UTC()
+	if ts, ok := parseTimestamp(envelope.Message.PublishTime); ok {
+		fallback = ts
+	}
+	var entry gcpLogEntry
+	var lg hlog.Log
+	if err := json.Unmarshal(data, &entry); err == nil && entry.LogName != "" {
+		lg = parseGCPLogEntry(r.Context(), &entry, fallback)
+	} else {
+		// messages published by other sources than a log sink are ingested as is
+		lg = hlog.Log{
+			Attributes: map[string]string{},
+			Message:    string(data),
+			Timestamp:  fallback.Format(hlog.TimestampFormatNano),
+			Level:      inferLevel(string(data), envelope.Message.Attributes),
+		}
+	}
+	if envelope.Message.MessageID != "" {
+		lg.Attributes["pubsub.message_id"] = envelope.Message.MessageID
+	}
+	if envelope.Subscription != "" {
+		lg.Attributes["pubsub.subscription"] = envelope.Subscription
+	}
+	if serviceName != "" {
+		lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+	}
+
+	if err := submitLog(r.Context(), projectID, lg); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
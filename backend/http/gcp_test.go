@@ -0,0 +1,91 @@
+package http
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const GCPLogEntry = `{"insertId":"1x2y3z","jsonPayload":{"message":"charge declined","order":{"id":7},"retryable":true},"resource":{"type":"cloud_run_revision","labels":{"service_name":"checkout","location":"us-central1"}},"timestamp":"2023-10-11T22:14:15.123456Z","severity":"WARNING","labels":{"instanceId":"00bf4bf0"},"logName":"projects/acme/logs/run.googleapis.com%2Fstdout","receiveTimestamp":"2023-10-11T22:14:15.3Z"}`
+
+func newGCPRequest(data string, attributes string) *http.Request {
+	body := fmt.Sprintf(`{"message":{"attributes":%s,"data":"%s","messageId":"2070443601311540","publishTime":"2023-10-11T22:14:16Z"},"subscription":"projects/acme/subscriptions/highlight"}`,
+		attributes, base64.StdEncoding.EncodeToString([]byte(data)))
+	r, _ := http.NewRequest("POST", "/v1/logs/gcp", strings.NewReader(body))
+	return r
+}
+
+func TestHandleGCPLog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r := newGCPRequest(GCPLogEntry, `{}`)
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, 1, (*submitted)[0].projectID)
+		lg := (*submitted)[0].log
+		assert.Equal(t, "charge declined", lg.Message)
+		assert.Equal(t, "warn", lg.Level)
+		assert.Equal(t, "2023-10-11T22:14:15.123456Z", lg.Timestamp)
+		assert.Equal(t, "7", lg.Attributes["order.id"])
+		assert.Equal(t, "true", lg.Attributes["retryable"])
+		assert.Equal(t, "cloud_run_revision", lg.Attributes["resource.type"])
+		assert.Equal(t, "checkout", lg.Attributes["resource.labels.service_name"])
+		assert.Equal(t, "00bf4bf0", lg.Attributes["labels.instanceId"])
+		assert.Equal(t, "1x2y3z", lg.Attributes["insert_id"])
+		assert.Equal(t, "2070443601311540", lg.Attributes["pubsub.message_id"])
+		assert.NotContains(t, lg.Attributes, "message")
+	}
+}
+
+func TestGCPLevel(t *testing.T) {
+	for severity, level := range map[string]string{
+		"DEFAULT":   "info",
+		"DEBUG":     "debug",
+		"NOTICE":    "info",
+		"WARNING":   "warn",
+		"ERROR":     "error",
+		"CRITICAL":  "fatal",
+		"EMERGENCY": "fatal",
+	} {
+		assert.Equal(t, level, gcpLevel(severity), severity)
+	}
+}
+
+func TestHandleGCPLogProjectAttribute(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetGCPProjectAttribute("highlight_project")
+	defer SetGCPProjectAttribute("")
+
+	w := httptest.NewRecorder()
+	HandleGCPLog(w, newGCPRequest(`{"textPayload":"GET /health 200","severity":"INFO","logName":"projects/acme/logs/requests"}`, `{"highlight_project":"2"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the header takes precedence over the attribute
+	r := newGCPRequest("not a log entry", `{"highlight_project":"2"}`)
+	r.Header.Set(LogDrainProjectHeader, "3")
+	w = httptest.NewRecorder()
+	HandleGCPLog(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		assert.Equal(t, 2, (*submitted)[0].projectID)
+		assert.Equal(t, "GET /health 200", (*submitted)[0].log.Message)
+		// without a timestamp on the entry the publish time is used
+		assert.Equal(t, "2023-10-11T22:14:16Z", (*submitted)[0].log.Timestamp)
+		assert.Equal(t, 3, (*submitted)[1].projectID)
+		assert.Equal(t, "not a log entry", (*submitted)[1].log.Message)
+	}
+
+	w = httptest.NewRecorder()
+	HandleGCPLog(w, newGCPRequest("not a log entry", `{}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
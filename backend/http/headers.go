@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// sensitiveHeaders may never be promoted to log attributes since they carry credentials.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":             true,
+	"Proxy-Authorization":       true,
+	"Cookie":                    true,
+	"Set-Cookie":                true,
+	"X-Api-Key":                 true,
+	"X-Amz-Firehose-Access-Key": true,
+	"X-Amz-Security-Token":      true,
+}
+
+var headerAttributes map[string]string
+
+// SetHeaderAttributeMapping configures request headers that are promoted to log attributes,
+// keyed by header name with the attribute key as the value.
+func SetHeaderAttributeMapping(mapping map[string]string) error {
+	m := make(map[string]string, len(mapping))
+	for header, attribute := range mapping {
+		header = http.CanonicalHeaderKey(header)
+		if sensitiveHeaders[header] {
+			return fmt.Errorf("header %s may not be mapped to a log attribute", header)
+		}
+		m[header] = attribute
+	}
+	headerAttributes = m
+	return nil
+}
+
+type requestAttributesKey struct{}
+
+func withRequestAttributes(ctx context.Context, attributes map[string]string) context.Context {
+	if len(attributes) == 0 {
+		return ctx
+	}
+	existing := requestAttributes(ctx)
+	merged := make(map[string]string, len(existing)+len(attributes))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range attributes {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, requestAttributesKey{}, merged)
+}
+
+// requestAttributes returns the attributes derived from the request that are applied to every log it carries.
+func requestAttributes(ctx context.Context) map[string]string {
+	attributes, _ := ctx.Value(requestAttributesKey{}).(map[string]string)
+	return attributes
+}
+
+// HeaderAttributesMiddleware stamps the configured request headers onto every log of the request.
+func HeaderAttributesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attributes := make(map[string]string)
+		for header, attribute := range headerAttributes {
+			if value := r.Header.Get(header); value != "" {
+				attributes[attribute] = value
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(withRequestAttributes(r.Context(), attributes)))
+	})
+}
+
+type DuplicateHeaderMode int
+
+const (
+	// DuplicateHeaderFirstWins uses the first value of a header sent several times.
+	DuplicateHeaderFirstWins DuplicateHeaderMode = iota
+	// DuplicateHeaderReject rejects requests sending a header several times with conflicting values.
+	DuplicateHeaderReject
+)
+
+var duplicateHeaderMode = DuplicateHeaderFirstWins
+
+// SetDuplicateHeaderMode configures how the highlight headers are read when a proxy duplicated them.
+func SetDuplicateHeaderMode(mode DuplicateHeaderMode) {
+	duplicateHeaderMode = mode
+}
+
+// listHeaders are the headers holding an identifier, which has no commas, so that a value that a
+// proxy merged from repeated headers is split back into its values. The values of other headers,
+// such as service names, are kept whole.
+var listHeaders = map[string]bool{
+	http.CanonicalHeaderKey(LogDrainProjectHeader): true,
+	http.CanonicalHeaderKey(LokiTenantHeader):      true,
+}
+
+var errConflictingHeader = errors.New("conflicting values for header")
+
+// getHeader returns the value of a highlight header. Proxies may repeat a header or merge the
+// repeated values of an identifier into a comma separated list, which is an error when the values
+// conflict and DuplicateHeaderReject is configured.
+func getHeader(r *http.Request, header string) (string, error) {
+	var first string
+	for _, value := range r.Header.Values(header) {
+		values := []string{value}
+		if listHeaders[http.CanonicalHeaderKey(header)] {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if first == "" {
+				first = v
+				if duplicateHeaderMode == DuplicateHeaderFirstWins {
+					return first, nil
+				}
+			} else if v != first {
+				return "", fmt.Errorf("%w %s: %q and %q", errConflictingHeader, http.CanonicalHeaderKey(header), first, v)
+			}
+		}
+	}
+	return first, nil
+}
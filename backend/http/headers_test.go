@@ -0,0 +1,94 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter() *chi.Mux {
+	r := chi.NewMux()
+	Listen(r, tracer)
+	return r
+}
+
+func TestHeaderAttributeMapping(t *testing.T) {
+	submitted := captureSubmits(t)
+	assert.NoError(t, SetHeaderAttributeMapping(map[string]string{"x-env": "deployment.environment"}))
+	defer func() { _ = SetHeaderAttributeMapping(nil) }()
+
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("hello"))
+	r.Header.Set("X-Env", "production")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 1, len(*submitted))
+	assert.Equal(t, "production", (*submitted)[0].log.Attributes["deployment.environment"])
+}
+
+func TestHeaderAttributeMappingRejectsSensitiveHeaders(t *testing.T) {
+	assert.Error(t, SetHeaderAttributeMapping(map[string]string{"authorization": "token"}))
+	assert.Error(t, SetHeaderAttributeMapping(map[string]string{"Cookie": "cookie"}))
+}
+
+func TestDuplicateProjectHeaders(t *testing.T) {
+	submitted := captureSubmits(t)
+	defer SetDuplicateHeaderMode(DuplicateHeaderFirstWins)
+
+	send := func(projects ...string) int {
+		r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello"}`))
+		for _, project := range projects {
+			r.Header.Add(LogDrainProjectHeader, project)
+		}
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("1", "2"))
+	assert.Equal(t, 1, (*submitted)[0].projectID)
+
+	SetDuplicateHeaderMode(DuplicateHeaderReject)
+	assert.Equal(t, http.StatusBadRequest, send("1", "2"))
+	// proxies may also merge the repeated values into a single header
+	assert.Equal(t, http.StatusBadRequest, send("1, 2"))
+	// repeating the same value is not a conflict
+	assert.Equal(t, http.StatusOK, send("1", "1"))
+	assert.Equal(t, http.StatusOK, send("1"))
+	assert.Equal(t, 3, len(*submitted))
+}
+
+func TestServiceHeaderWithComma(t *testing.T) {
+	submitted := captureSubmits(t)
+	defer SetDuplicateHeaderMode(DuplicateHeaderFirstWins)
+
+	send := func(services ...string) int {
+		r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello"}`))
+		r.Header.Set(LogDrainProjectHeader, "1")
+		for _, service := range services {
+			r.Header.Add(LogDrainServiceHeader, service)
+		}
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// a service name is not split on its commas
+	assert.Equal(t, http.StatusOK, send("billing, eu-west"))
+	SetDuplicateHeaderMode(DuplicateHeaderReject)
+	assert.Equal(t, http.StatusOK, send("billing, eu-west"))
+	assert.Equal(t, http.StatusOK, send("billing, eu-west", "billing, eu-west"))
+	if assert.Equal(t, 3, len(*submitted)) {
+		for _, s := range *submitted {
+			assert.Equal(t, "billing, eu-west", s.log.Attributes["service.name"])
+		}
+	}
+	// repeated headers with different services still conflict
+	assert.Equal(t, http.StatusBadRequest, send("billing, eu-west", "billing"))
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// readinessCacheTTL is how long a successful submission or the result of the readiness check
+// vouches for the submit path, so that frequent probes do not each run the check.
+const readinessCacheTTL = 10 * time.Second
+
+// ReadinessCheck reports whether the logs can be forwarded downstream.
+type ReadinessCheck func(ctx context.Context) error
+
+var readiness = struct {
+	lastSubmit atomic.Int64
+
+	mu        sync.Mutex
+	check     ReadinessCheck
+	checkedAt time.Time
+	checkErr  error
+}{}
+
+// SetReadinessCheck sets the check run by the readiness endpoint when no log was submitted recently.
+// Passing nil reports the instance as ready without checking the submit path.
+func SetReadinessCheck(check ReadinessCheck) {
+	readiness.mu.Lock()
+	defer readiness.mu.Unlock()
+	readiness.check = check
+	readiness.checkedAt = time.Time{}
+	readiness.checkErr = nil
+}
+
+// NewDialReadinessCheck returns a check that the otlp endpoint the logs are exported to accepts connections.
+func NewDialReadinessCheck(endpoint string, timeout time.Duration) ReadinessCheck {
+	return func(ctx context.Context) error {
+		address := endpoint
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			address = u.Host
+			if u.Port() == "" {
+				port := "80"
+				if u.Scheme == "https" {
+					port = "443"
+				}
+				address = net.JoinHostPort(u.Hostname(), port)
+			}
+		}
+		dialer := net.Dialer{Timeout: timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// recordSubmit marks the submit path as reachable after logs were forwarded downstream.
+func recordSubmit(now time.Time) {
+	readiness.lastSubmit.Store(now.UnixNano())
+}
+
+func lastSubmitTime() (time.Time, bool) {
+	if nanos := readiness.lastSubmit.Load(); nanos > 0 {
+		return time.Unix(0, nanos).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// checkReady reports whether the submit path is reachable, either because a log was submitted
+// recently or because the readiness check passed.
+func checkReady(ctx context.Context, now time.Time) error {
+	if last, ok := lastSubmitTime(); ok && now.Sub(last) < readinessCacheTTL {
+		return nil
+	}
+
+	readiness.mu.Lock()
+	defer readiness.mu.Unlock()
+	if readiness.check == nil {
+		return nil
+	}
+	if now.Sub(readiness.checkedAt) >= readinessCacheTTL {
+		readiness.checkErr = readiness.check(ctx)
+		readiness.checkedAt = now
+	}
+	return readiness.checkErr
+}
+
+type healthResponse struct {
+	Status     string `json:"status"`
+	LastSubmit string `json:"last_submit,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, status int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// HandleHealth is the liveness probe, which succeeds for as long as the process serves requests.
+func HandleHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// HandleReady is the readiness probe, which succeeds only while the logs can be forwarded downstream.
+func HandleReady(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{Status: "ready"}
+	if last, ok := lastSubmitTime(); ok {
+		response.LastSubmit = last.Format(time.RFC3339Nano)
+	}
+	if err := checkReady(r.Context(), time.Now()); err != nil {
+		log.WithContext(r.Context()).WithError(err).Warn("http logs submit path is not ready")
+		response.Status = "unavailable"
+		writeHealth(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	writeHealth(w, http.StatusOK, response)
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleHealth(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/v1/logs/health", nil)
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestHandleReady(t *testing.T) {
+	submitted := captureSubmits(t)
+	readiness.lastSubmit.Store(0)
+	defer SetReadinessCheck(nil)
+
+	router := newTestRouter()
+	ready := func() (int, healthResponse) {
+		r, _ := http.NewRequest("GET", "/v1/logs/ready", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var response healthResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	checks := 0
+	SetReadinessCheck(func(ctx context.Context) error {
+		checks++
+		return errors.New("connection refused")
+	})
+	code, response := ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", response.Status)
+	assert.Empty(t, response.LastSubmit)
+	// the result of the check is cached between probes
+	ready()
+	assert.Equal(t, 1, checks)
+
+	// a successful submission vouches for the submit path without running the check
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("hello"))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, 1, len(*submitted))
+	code, response = ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", response.Status)
+	last, err := time.Parse(time.RFC3339Nano, response.LastSubmit)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute)
+	assert.Equal(t, 1, checks)
+}
+
+func TestDialReadinessCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+
+	assert.NoError(t, NewDialReadinessCheck("http://"+address, time.Second)(context.Background()))
+	assert.NoError(t, listener.Close())
+	assert.Error(t, NewDialReadinessCheck("http://"+address, time.Second)(context.Background()))
+}
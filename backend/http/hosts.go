@@ -0,0 +1,62 @@
+package http
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// hostAttributeKeys are the attributes looked up in the host metadata table, in order of precedence.
+var hostAttributeKeys = []string{string(semconv.HostNameKey), "hostname", "host"}
+
+var hostMetadata = struct {
+	sync.RWMutex
+	byHost map[string]map[string]string
+}{}
+
+// SetHostMetadata replaces the table of attributes added to logs by their host, for example
+// {"web-1": {"datacenter": "us-east", "rack": "r12"}}. It may be called at any time to
+// hot-reload the table. Passing nil disables the enrichment.
+func SetHostMetadata(byHost map[string]map[string]string) {
+	hostMetadata.Lock()
+	defer hostMetadata.Unlock()
+	hostMetadata.byHost = byHost
+}
+
+// LoadHostMetadataFile replaces the host metadata table with the json object stored in the file.
+// Call it again to reload the table after the file changes.
+func LoadHostMetadataFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var byHost map[string]map[string]string
+	if err := json.Unmarshal(data, &byHost); err != nil {
+		return err
+	}
+	SetHostMetadata(byHost)
+	return nil
+}
+
+// enrichHostMetadata adds the metadata of the log's host without overriding existing attributes.
+func enrichHostMetadata(attributes map[string]string) {
+	hostMetadata.RLock()
+	defer hostMetadata.RUnlock()
+	if len(hostMetadata.byHost) == 0 {
+		return
+	}
+	for _, key := range hostAttributeKeys {
+		metadata, ok := hostMetadata.byHost[attributes[key]]
+		if !ok {
+			continue
+		}
+		for k, v := range metadata {
+			if _, ok := attributes[k]; !ok {
+				attributes[k] = v
+			}
+		}
+		return
+	}
+}
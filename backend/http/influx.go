@@ -0,0 +1,286 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+var lineProtocolMessageField = "message"
+
+// SetLineProtocolMessageField sets the line protocol field used as the log message.
+func SetLineProtocolMessageField(field string) {
+	lineProtocolMessageField = field
+}
+
+type lineProtocolPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Timestamp   *int64
+}
+
+// splitLineProtocol splits s on sep, ignoring separators that are escaped with a backslash
+// or, when quoted is set, inside a double-quoted string. At most n parts are returned if n > 0.
+func splitLineProtocol(s string, sep byte, quoted bool, n int) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			if n > 0 && len(parts) == n-1 {
+				continue
+			}
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeLineProtocol removes the backslash from escaped special characters.
+func unescapeLineProtocol(s string, special string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(special, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func parseLineProtocolValue(v string) (interface{}, error) {
+	if strings.HasPrefix(v, `"`) {
+		if len(v) < 2 || !strings.HasSuffix(v, `"`) {
+			return nil, fmt.Errorf("unterminated string field value %s", v)
+		}
+		return unescapeLineProtocol(v[1:len(v)-1], `"\`), nil
+	}
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	if strings.HasSuffix(v, "i") {
+		return strconv.ParseInt(strings.TrimSuffix(v, "i"), 10, 64)
+	}
+	if strings.HasSuffix(v, "u") {
+		return strconv.ParseUint(strings.TrimSuffix(v, "u"), 10, 64)
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+func parseLineProtocol(line string) (*lineProtocolPoint, error) {
+	// quotes are only meaningful in field values, so the measurement and tags are split off first
+	sections := splitLineProtocol(line, ' ', false, 2)
+	if len(sections) < 2 {
+		return nil, errors.New("line protocol requires a measurement and at least one field")
+	}
+	sections = append(sections[:1], splitLineProtocol(sections[1], ' ', true, 2)...)
+
+	point := lineProtocolPoint{
+		Tags:   make(map[string]string),
+		Fields: make(map[string]interface{}),
+	}
+	key := splitLineProtocol(sections[0], ',', false, -1)
+	point.Measurement = unescapeLineProtocol(key[0], `, `)
+	for _, tag := range key[1:] {
+		kv := splitLineProtocol(tag, '=', false, 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid tag %s", tag)
+		}
+		point.Tags[unescapeLineProtocol(kv[0], `,= `)] = unescapeLineProtocol(kv[1], `,= `)
+	}
+
+	for _, field := range splitLineProtocol(sections[1], ',', true, -1) {
+		kv := splitLineProtocol(field, '=', true, 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid field %s", field)
+		}
+		value, err := parseLineProtocolValue(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		point.Fields[unescapeLineProtocol(kv[0], `,= `)] = value
+	}
+
+	if len(sections) == 3 && sections[2] != "" {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		point.Timestamp = &ts
+	}
+	return &point, nil
+}
+
+// parseTelegrafJSON parses the batch json format of the telegraf http output.
+func parseTelegrafJSON(body []byte) ([]*lineProtocolPoint, error) {
+	var payload struct {
+		Metrics []struct {
+			Name      string                 `json:"name"`
+			Tags      map[string]string      `json:"tags"`
+			Fields    map[string]interface{} `json:"fields"`
+			Timestamp *int64                 `json:"timestamp"`
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	var points []*lineProtocolPoint
+	for _, metric := range payload.Metrics {
+		point := lineProtocolPoint{
+			Measurement: metric.Name,
+			Tags:        metric.Tags,
+			Fields:      metric.Fields,
+			Timestamp:   metric.Timestamp,
+		}
+		points = append(points, &point)
+	}
+	return points, nil
+}
+
+func formatLineProtocolValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// lineProtocolTime converts a timestamp with the influx write api `precision` to a time.
+func lineProtocolTime(ts int64, precision string) time.Time {
+	switch precision {
+	case "s":
+		return time.Unix(ts, 0).UTC()
+	case "ms":
+		return time.UnixMilli(ts).UTC()
+	case "us":
+		return time.UnixMicro(ts).UTC()
+	default:
+		return time.Unix(0, ts).UTC()
+	}
+}
+
+func lineProtocolLog(point *lineProtocolPoint, precision string) hlog.Log {
+	lg := hlog.Log{
+		Attributes: map[string]string{"measurement": point.Measurement},
+		Timestamp:  time.Now().UTC().Format(hlog.TimestampFormatNano),
+		Level:      model.LogLevelInfo.String(),
+	}
+	if point.Timestamp != nil {
+		lg.Timestamp = lineProtocolTime(*point.Timestamp, precision).Format(hlog.TimestampFormatNano)
+	}
+	for k, v := range point.Tags {
+		lg.Attributes[k] = v
+	}
+	for k, v := range point.Fields {
+		if k == lineProtocolMessageField {
+			lg.Message = formatLineProtocolValue(v)
+			continue
+		}
+		lg.Attributes[k] = formatLineProtocolValue(v)
+	}
+	if level := normalizeLevel(lg.Attributes["level"]); level != "" {
+		lg.Level = level
+	}
+	return lg
+}
+
+// HandleLineProtocol ingests InfluxDB line protocol points as logs. Bodies holding a json
+// object are parsed as the json output of telegraf.
+func HandleLineProtocol(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http line protocol gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http line protocol body")
+		writeBodyError(w, err)
+		return
+	}
+
+	// the whole body is parsed before submitting so that a malformed line rejects the request without
+	// a partial ingest of the lines preceding it
+	precision := r.URL.Query().Get("precision")
+	var points []*lineProtocolPoint
+	if trimmed := bytes.TrimSpace(body); bytes.HasPrefix(trimmed, []byte("{")) {
+		points, err = parseTelegrafJSON(trimmed)
+		if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("invalid telegraf json")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// telegraf serializes json timestamps in seconds unless configured otherwise
+		if precision == "" {
+			precision = "s"
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			point, err := parseLineProtocol(line)
+			if err != nil {
+				log.WithContext(r.Context()).WithError(err).WithField("line", line).Error("invalid line protocol")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			points = append(points, point)
+		}
+	}
+
+	var logs []hlog.Log
+	for _, point := range points {
+		lg := lineProtocolLog(point, precision)
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, lg)
+	}
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	point, err := parseLineProtocol(`disk\ events,location=us\ midwest,host=server01 message="disk \"sda\" full, retrying",temperature=82.5,count=3i,ok=true 1465839830100400200`)
+	assert.NoError(t, err)
+	assert.Equal(t, "disk events", point.Measurement)
+	assert.Equal(t, map[string]string{"location": "us midwest", "host": "server01"}, point.Tags)
+	assert.Equal(t, `disk "sda" full, retrying`, point.Fields["message"])
+	assert.Equal(t, 82.5, point.Fields["temperature"])
+	assert.Equal(t, int64(3), point.Fields["count"])
+	assert.Equal(t, true, point.Fields["ok"])
+	assert.Equal(t, int64(1465839830100400200), *point.Timestamp)
+
+	_, err = parseLineProtocol(`measurement_only`)
+	assert.Error(t, err)
+
+	// quotes in the measurement and tags are literal
+	point, err = parseLineProtocol(`"quoted,note="x message="hi" 1465839830100400200`)
+	assert.NoError(t, err)
+	assert.Equal(t, `"quoted`, point.Measurement)
+	assert.Equal(t, map[string]string{"note": `"x`}, point.Tags)
+	assert.Equal(t, "hi", point.Fields["message"])
+	assert.Equal(t, int64(1465839830100400200), *point.Timestamp)
+}
+
+func TestHandleLineProtocol(t *testing.T) {
+	submitted := captureSubmits(t)
+	body := "syslog,host=edge-7,level=warning message=\"battery low\",voltage=3.1,cycles=812i 1465839830100400200\n\nsyslog,host=edge-8 message=\"ok\"\n"
+	r, _ := http.NewRequest("POST", "/v1/logs/influx", strings.NewReader(body))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleLineProtocol(w, r)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 2, len(*submitted))
+	lg := (*submitted)[0].log
+	assert.Equal(t, "battery low", lg.Message)
+	assert.Equal(t, "warn", lg.Level)
+	assert.Equal(t, "2016-06-13T17:43:50.1004002Z", lg.Timestamp)
+	assert.Equal(t, "edge-7", lg.Attributes["host"])
+	assert.Equal(t, "syslog", lg.Attributes["measurement"])
+	assert.Equal(t, "3.1", lg.Attributes["voltage"])
+	assert.Equal(t, "812", lg.Attributes["cycles"])
+}
+
+func TestHandleLineProtocolMalformedLine(t *testing.T) {
+	submitted := captureSubmits(t)
+	body := "syslog,host=edge-7 message=\"first\"\nsyslog,host=edge-8\nsyslog,host=edge-9 message=\"third\"\n"
+	r, _ := http.NewRequest("POST", "/v1/logs/influx", strings.NewReader(body))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleLineProtocol(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, *submitted)
+}
+
+const TelegrafJSON = `{"metrics":[{"fields":{"message":"disk sda full","used_percent":97.5,"inodes":1024},"name":"disk","tags":{"host":"edge-7","level":"error"},"timestamp":1465839830},{"fields":{"message":"ok"},"name":"heartbeat","tags":{"host":"edge-8"},"timestamp":1465839831}]}`
+
+func TestHandleTelegrafJSON(t *testing.T) {
+	submitted := captureSubmits(t)
+	r, _ := http.NewRequest("POST", "/v1/logs/influx", strings.NewReader(TelegrafJSON))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleLineProtocol(w, r)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 2, len(*submitted))
+	lg := (*submitted)[0].log
+	assert.Equal(t, "disk sda full", lg.Message)
+	assert.Equal(t, "error", lg.Level)
+	assert.Equal(t, "2016-06-13T17:43:50Z", lg.Timestamp)
+	assert.Equal(t, "disk", lg.Attributes["measurement"])
+	assert.Equal(t, "edge-7", lg.Attributes["host"])
+	assert.Equal(t, "97.5", lg.Attributes["used_percent"])
+	assert.Equal(t, "1024", lg.Attributes["inodes"])
+	assert.Equal(t, "heartbeat", (*submitted)[1].log.Attributes["measurement"])
+}
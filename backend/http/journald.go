@@ -0,0 +1,139 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// JSONSeqContentType is the RFC7464 media type emitted by `journalctl -o json-seq`.
+const JSONSeqContentType = "application/json-seq"
+
+const recordSeparator = 0x1e
+
+// splitJournaldRecords splits a journalctl export into individual json records.
+// `-o json` emits one record per line while `-o json-seq` prefixes every record
+// with an RS byte, so a record may not be split on plain newlines.
+func splitJournaldRecords(r *http.Request, body []byte) [][]byte {
+	sep := []byte{'\n'}
+	if r.Header.Get("Content-Type") == JSONSeqContentType || bytes.IndexByte(body, recordSeparator) >= 0 {
+		sep = []byte{recordSeparator}
+	}
+	var records [][]byte
+	for _, record := range bytes.Split(body, sep) {
+		record = bytes.TrimSpace(record)
+		if len(record) == 0 {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func journaldLevel(priority string) string {
+	switch priority {
+	case "0", "1":
+		return model.LogLevelFatal.String()
+	case "2", "3":
+		return model.LogLevelError.String()
+	case "4":
+		return model.LogLevelWarn.String()
+	case "7":
+		return model.LogLevelDebug.String()
+	default:
+		// 5 (notice) and 6 (informational)
+		return model.LogLevelInfo.String()
+	}
+}
+
+func parseJournaldRecord(record []byte) (*hlog.Log, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return nil, err
+	}
+
+	lg := hlog.Log{
+		Attributes: make(map[string]string),
+		Timestamp:  time.Now().UTC().Format(hlog.TimestampFormat),
+	}
+	if msg, ok := fields["MESSAGE"].(string); ok {
+		lg.Message = msg
+	}
+	priority, _ := fields["PRIORITY"].(string)
+	lg.Level = journaldLevel(priority)
+	if ts, ok := fields["__REALTIME_TIMESTAMP"].(string); ok {
+		if us, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			lg.Timestamp = time.UnixMicro(us).UTC().Format(hlog.TimestampFormatNano)
+		}
+	}
+	if unit, ok := fields["_SYSTEMD_UNIT"].(string); ok {
+		lg.Attributes[string(semconv.ServiceNameKey)] = unit
+	} else if identifier, ok := fields["SYSLOG_IDENTIFIER"].(string); ok {
+		lg.Attributes[string(semconv.ServiceNameKey)] = identifier
+	}
+	if hostname, ok := fields["_HOSTNAME"].(string); ok {
+		lg.Attributes[string(semconv.HostNameKey)] = hostname
+	}
+
+	for k, v := range fields {
+		if has := map[string]bool{"MESSAGE": true, "PRIORITY": true, "__REALTIME_TIMESTAMP": true}[k]; has {
+			continue
+		}
+		if str, ok := v.(string); ok {
+			lg.Attributes[k] = str
+		}
+	}
+	return &lg, nil
+}
+
+// HandleJournaldLog ingests the output of `journalctl -o json` or `journalctl -o json-seq`.
+func HandleJournaldLog(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http journald gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http journald body")
+		writeBodyError(w, err)
+		return
+	}
+
+	var logs []hlog.Log
+	for _, record := range splitJournaldRecords(r, body) {
+		lg, err := parseJournaldRecord(record)
+		if err != nil {
+			// RFC7464 parsers should skip truncated or malformed texts rather than fail the sequence
+			log.WithContext(r.Context()).WithError(err).Warn("skipping invalid journald record")
+			continue
+		}
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, *lg)
+	}
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
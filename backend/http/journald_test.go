@@ -0,0 +1,46 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const JournaldJSONSeq = "\x1e{\"__REALTIME_TIMESTAMP\":\"1697062455123456\",\"PRIORITY\":\"3\",\"_HOSTNAME\":\"web-1\",\"_SYSTEMD_UNIT\":\"nginx.service\",\"MESSAGE\":\"upstream timed out\\nwhile reading response\"}\n" +
+	"\x1e{\"__REALTIME_TIMESTAMP\":\"1697062456000000\",\"PRIORITY\":\"6\",\"SYSLOG_IDENTIFIER\":\"sshd\",\"MESSAGE\":\"accepted publickey\"}\n"
+
+func TestHandleJournaldJSONSeq(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/v1/logs/journald", strings.NewReader(JournaldJSONSeq))
+	r.Header.Set("Content-Type", JSONSeqContentType)
+	r.Header.Set(LogDrainProjectHeader, "1")
+
+	records := splitJournaldRecords(r, []byte(JournaldJSONSeq))
+	assert.Equal(t, 2, len(records))
+
+	lg, err := parseJournaldRecord(records[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "upstream timed out\nwhile reading response", lg.Message)
+	assert.Equal(t, "error", lg.Level)
+	assert.Equal(t, "2023-10-11T22:14:15.123456Z", lg.Timestamp)
+	assert.Equal(t, "nginx.service", lg.Attributes["service.name"])
+	assert.Equal(t, "web-1", lg.Attributes["host.name"])
+
+	lg, err = parseJournaldRecord(records[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "info", lg.Level)
+	assert.Equal(t, "sshd", lg.Attributes["service.name"])
+
+	w := &MockResponseWriter{}
+	HandleJournaldLog(w, r)
+	assert.Equal(t, 200, w.statusCode)
+}
+
+func TestJournaldLevel(t *testing.T) {
+	for priority, level := range map[string]string{
+		"0": "fatal", "2": "error", "3": "error", "4": "warn", "5": "info", "6": "info", "7": "debug", "": "info",
+	} {
+		assert.Equal(t, level, journaldLevel(priority), priority)
+	}
+}
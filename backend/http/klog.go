@@ -0,0 +1,130 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// klogHeader matches the `Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg` header of a klog line.
+var klogHeader = regexp.MustCompile(`^([IWEF])(\d{2})(\d{2}) (\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+(\d+) ([^:\]\s]+):(\d+)\] ?(.*)$`)
+
+func klogLevel(severity string) string {
+	switch severity {
+	case "W":
+		return model.LogLevelWarn.String()
+	case "E":
+		return model.LogLevelError.String()
+	case "F":
+		return model.LogLevelFatal.String()
+	default:
+		return model.LogLevelInfo.String()
+	}
+}
+
+// klogTime infers the year of a klog timestamp, which only carries the month and day.
+// A timestamp that would be in the future is assumed to be from the previous year.
+func klogTime(month, day, clock string, now time.Time) (time.Time, bool) {
+	t, err := time.Parse("2006 0102 15:04:05", fmt.Sprintf("%d %s%s %s", now.Year(), month, day, clock))
+	if err != nil {
+		return time.Time{}, false
+	}
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, true
+}
+
+// parseKlogLine parses a single klog line, returning false if the line does not have a klog header.
+func parseKlogLine(line string, now time.Time) (*hlog.Log, bool) {
+	m := klogHeader.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	ts, ok := klogTime(m[2], m[3], m[4], now)
+	if !ok {
+		return nil, false
+	}
+	return &hlog.Log{
+		Message:   m[8],
+		Timestamp: ts.Format(hlog.TimestampFormatNano),
+		Level:     klogLevel(m[1]),
+		Attributes: map[string]string{
+			string(semconv.ProcessPIDKey):     m[5],
+			string(semconv.CodeFilepathKey):   m[6],
+			string(semconv.CodeLineNumberKey): m[7],
+		},
+	}, true
+}
+
+// HandleKlog ingests logs written in the klog format used by kubernetes components.
+// Lines without a klog header are treated as a continuation of the previous message.
+func HandleKlog(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http klog gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http klog body")
+		writeBodyError(w, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	var logs []hlog.Log
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if lg, ok := parseKlogLine(line, now); ok {
+			if serviceName != "" {
+				lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+			}
+			logs = append(logs, *lg)
+		} else if len(logs) > 0 {
+			logs[len(logs)-1].Message += "\n" + line
+		} else {
+			lg := hlog.Log{
+				Attributes: map[string]string{},
+				Message:    line,
+				Timestamp:  now.Format(hlog.TimestampFormat),
+				Level:      model.LogLevelInfo.String(),
+			}
+			if serviceName != "" {
+				lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+			}
+			logs = append(logs, lg)
+		}
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
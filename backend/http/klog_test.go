@@ -0,0 +1,64 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const KlogLines = `I0102 15:04:05.123456   12345 controller.go:42] Starting controller
+W0102 15:04:06.000001   12345 reflector.go:324] watch of *v1.Pod ended with: too old resource version
+E0102 15:04:07.500000   12346 server.go:1021] "Failed to sync" err="context deadline exceeded"
+	goroutine 1 [running]:
+F0102 15:04:08.000000       1 main.go:7] unable to load configuration
+`
+
+func TestParseKlogLine(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	lg, ok := parseKlogLine("I0102 15:04:05.123456   12345 controller.go:42] Starting controller", now)
+	assert.True(t, ok)
+	assert.Equal(t, "info", lg.Level)
+	assert.Equal(t, "Starting controller", lg.Message)
+	assert.Equal(t, "2024-01-02T15:04:05.123456Z", lg.Timestamp)
+	assert.Equal(t, "12345", lg.Attributes["process.pid"])
+	assert.Equal(t, "controller.go", lg.Attributes["code.filepath"])
+	assert.Equal(t, "42", lg.Attributes["code.lineno"])
+
+	for line, level := range map[string]string{
+		"W0102 15:04:06.000001   12345 reflector.go:324] watch ended":  "warn",
+		"E0102 15:04:07.500000   12346 server.go:1021] failed to sync": "error",
+		"F0102 15:04:08.000000       1 main.go:7] unable to load":      "fatal",
+	} {
+		lg, ok := parseKlogLine(line, now)
+		assert.True(t, ok)
+		assert.Equal(t, level, lg.Level)
+	}
+
+	// a december line received in january belongs to the previous year
+	lg, ok = parseKlogLine("I1231 23:59:59.000000 1 main.go:1] happy new year", time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, "2024-12-31T23:59:59Z", lg.Timestamp)
+
+	_, ok = parseKlogLine("not a klog line", now)
+	assert.False(t, ok)
+}
+
+func TestHandleKlog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/klog?%s=1&%s=kube-apiserver", LogDrainProjectQueryParam, LogDrainServiceQueryParam), strings.NewReader(KlogLines))
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 4, len(*submitted))
+	assert.Equal(t, "\"Failed to sync\" err=\"context deadline exceeded\"\n\tgoroutine 1 [running]:", (*submitted)[2].log.Message)
+	assert.Equal(t, "kube-apiserver", (*submitted)[3].log.Attributes["service.name"])
+	assert.Equal(t, "fatal", (*submitted)[3].log.Level)
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const LambdaEventTypeAttribute = "lambda.type"
+
+// lambdaTelemetryEvent is an event delivered by the lambda telemetry api. The record of `function`
+// and `extension` events is the logged line, or an object for functions using the json log format,
+// while the record of `platform.*` events describes the lifecycle of the execution environment.
+type lambdaTelemetryEvent struct {
+	Time   string          `json:"time"`
+	Type   string          `json:"type"`
+	Record json.RawMessage `json:"record"`
+}
+
+// lambdaReportedPlatformEvents are the platform events kept when lifecycle events are skipped,
+// since they report a problem rather than the progress of an invocation.
+var lambdaReportedPlatformEvents = map[string]bool{
+	"platform.logsDropped": true,
+}
+
+var skipLambdaPlatformEvents bool
+
+// SetSkipLambdaPlatformEvents sets whether the lifecycle events of the lambda platform, such as
+// `platform.start` and `platform.report`, are dropped rather than ingested.
+func SetSkipLambdaPlatformEvents(skip bool) {
+	skipLambdaPlatformEvents = skip
+}
+
+func isLambdaLifecycleEvent(eventType string) bool {
+	return strings.HasPrefix(eventType, "platform.") && !lambdaReportedPlatformEvents[eventType]
+}
+
+// parseLambdaTelemetryEvent converts a telemetry api event into a log, using the record as the
+// message. Object records are kept as their json.
+func parseLambdaTelemetryEvent(event *lambdaTelemetryEvent, fallback time.Time) hlog.Log {
+	lg := hlog.Log{
+		Attributes: map[string]string{LambdaEventTypeAttribute: event.Type},
+		Timestamp:  fallback.Format(hlog.TimestampFormatNano),
+	}
+	if ts, ok := parseTimestamp(event.Time); ok {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+	}
+
+	var record interface{}
+	if err := json.Unmarshal(event.Record, &record); err != nil {
+		record = string(event.Record)
+	}
+	switch r := record.(type) {
+	case string:
+		lg.Message = strings.TrimRight(r, "\r\n")
+		// the node runtime writes text logs as `<timestamp>\t<request id>\t<level>\t<message>`
+		if fields := strings.SplitN(lg.Message, "\t", 4); len(fields) == 4 {
+			if level := normalizeLevel(fields[2]); level != "" {
+				lg.Level = level
+				lg.Attributes[string(semconv.FaaSExecutionKey)] = fields[1]
+			}
+		}
+	case map[string]interface{}:
+		lg.Message = string(event.Record)
+		if requestID, ok := r["requestId"].(string); ok && requestID != "" {
+			lg.Attributes[string(semconv.FaaSExecutionKey)] = requestID
+		}
+	default:
+		if record != nil {
+			lg.Message = string(event.Record)
+		}
+	}
+
+	if lg.Level == "" {
+		lg.Level = inferLevel(lg.Message, nil)
+	}
+	return lg
+}
+
+// HandleLambdaTelemetry ingests the batches of events that the lambda telemetry api delivers to
+// the subscribed extension, which forwards them with the highlight headers.
+func HandleLambdaTelemetry(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http lambda gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http lambda body")
+		writeBodyError(w, err)
+		return
+	}
+
+	var events []lambdaTelemetryEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http lambda telemetry events")
+		writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not a lambda telemetry batch")
+		return
+	}
+
+	now := time.Now().UTC()
+	var logs []hlog.Log
+	for idx := range events {
+		if skipLambdaPlatformEvents && isLambdaLifecycleEvent(events[idx].Type) {
+			continue
+		}
+		lg := parseLambdaTelemetryEvent(&events[idx], now)
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, lg)
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
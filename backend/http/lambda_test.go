@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const LambdaTelemetryEvents = `[
+	{"time":"2023-10-11T22:14:15.000Z","type":"platform.start","record":{"requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa","version":"$LATEST"}},
+	{"time":"2023-10-11T22:14:15.123Z","type":"function","record":"2023-10-11T22:14:15.123Z\t6d68ca91\tERROR\tcharge declined\n"},
+	{"time":"2023-10-11T22:14:15.200Z","type":"function","record":{"timestamp":"2023-10-11T22:14:15.200Z","level":"WARN","requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa","message":"retrying"}},
+	{"time":"2023-10-11T22:14:15.300Z","type":"platform.logsDropped","record":{"reason":"buffer full","droppedRecords":3,"droppedBytes":512}},
+	{"time":"2023-10-11T22:14:15.400Z","type":"platform.report","record":{"requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa","status":"success","metrics":{"durationMs":301.2}}}
+]`
+
+func TestHandleLambdaTelemetry(t *testing.T) {
+	submitted := captureSubmits(t)
+	defer SetSkipLambdaPlatformEvents(false)
+
+	send := func() {
+		r, _ := http.NewRequest("POST", "/v1/logs/lambda", strings.NewReader(LambdaTelemetryEvents))
+		r.Header.Set(LogDrainProjectHeader, "1")
+		r.Header.Set(LogDrainServiceHeader, "checkout")
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	send()
+	if assert.Equal(t, 5, len(*submitted)) {
+		start := (*submitted)[0].log
+		assert.Equal(t, "platform.start", start.Attributes[LambdaEventTypeAttribute])
+		assert.JSONEq(t, `{"requestId":"6d68ca91-49c9-448d-89b8-7ca3e6dc66aa","version":"$LATEST"}`, start.Message)
+		assert.Equal(t, "6d68ca91-49c9-448d-89b8-7ca3e6dc66aa", start.Attributes["faas.execution"])
+		assert.Equal(t, "2023-10-11T22:14:15Z", start.Timestamp)
+
+		text := (*submitted)[1].log
+		assert.Equal(t, "function", text.Attributes[LambdaEventTypeAttribute])
+		assert.Equal(t, "2023-10-11T22:14:15.123Z\t6d68ca91\tERROR\tcharge declined", text.Message)
+		assert.Equal(t, "error", text.Level)
+		assert.Equal(t, "2023-10-11T22:14:15.123Z", text.Timestamp)
+		assert.Equal(t, "checkout", text.Attributes["service.name"])
+
+		structured := (*submitted)[2].log
+		assert.Contains(t, structured.Message, `"message":"retrying"`)
+		assert.Equal(t, "warn", structured.Level)
+	}
+
+	*submitted = nil
+	SetSkipLambdaPlatformEvents(true)
+	send()
+	if assert.Equal(t, 3, len(*submitted)) {
+		assert.Equal(t, "function", (*submitted)[0].log.Attributes[LambdaEventTypeAttribute])
+		assert.Equal(t, "function", (*submitted)[1].log.Attributes[LambdaEventTypeAttribute])
+		// dropped logs are a problem to report rather than a lifecycle event
+		assert.Equal(t, "platform.logsDropped", (*submitted)[2].log.Attributes[LambdaEventTypeAttribute])
+	}
+}
+
+func TestHandleLambdaTelemetryMalformed(t *testing.T) {
+	captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/lambda", strings.NewReader(`{"type":"function"}`))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), ErrorCodeDecodeFailed)
+}
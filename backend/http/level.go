@@ -0,0 +1,317 @@
+package http
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+)
+
+// normalizeLevel maps the level spellings used by common loggers onto the canonical log levels.
+// Unknown levels are returned as an empty string.
+func normalizeLevel(level string) string {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "trace", "verbose":
+		return model.LogLevelTrace.String()
+	case "debug", "dbg":
+		return model.LogLevelDebug.String()
+	case "info", "information", "informational", "notice", "log":
+		return model.LogLevelInfo.String()
+	case "warn", "warning":
+		return model.LogLevelWarn.String()
+	case "error", "err":
+		return model.LogLevelError.String()
+	case "fatal", "critical", "crit", "alert", "emergency", "emerg", "panic", "dpanic":
+		return model.LogLevelFatal.String()
+	}
+	return ""
+}
+
+var levelRank = map[string]int{
+	model.LogLevelTrace.String(): 0,
+	model.LogLevelDebug.String(): 1,
+	model.LogLevelInfo.String():  2,
+	model.LogLevelWarn.String():  3,
+	model.LogLevelError.String(): 4,
+	model.LogLevelFatal.String(): 5,
+}
+
+var minLevels = struct {
+	sync.RWMutex
+	byProject map[int]int
+}{byProject: make(map[int]int)}
+
+// SetMinLevel drops logs of the project below the level. Passing an empty or unknown level removes the minimum.
+func SetMinLevel(projectID int, level string) {
+	minLevels.Lock()
+	defer minLevels.Unlock()
+	rank, ok := levelRank[normalizeLevel(level)]
+	if !ok {
+		delete(minLevels.byProject, projectID)
+		return
+	}
+	minLevels.byProject[projectID] = rank
+}
+
+// hasMinLevel reports whether a minimum level is set for the project, so that
+// peeking at the level of its logs before parsing them is worthwhile.
+func hasMinLevel(projectID int) bool {
+	minLevels.RLock()
+	defer minLevels.RUnlock()
+	_, ok := minLevels.byProject[projectID]
+	return ok
+}
+
+// belowMinLevel reports whether a log of the level should be dropped. Logs with an unknown level are kept.
+func belowMinLevel(projectID int, level string) bool {
+	minLevels.RLock()
+	minRank, ok := minLevels.byProject[projectID]
+	minLevels.RUnlock()
+	if !ok {
+		return false
+	}
+	rank, ok := levelRank[normalizeLevel(level)]
+	return ok && rank < minRank
+}
+
+// jsonStringEnd returns the index of the quote closing the json string starting at start.
+func jsonStringEnd(b []byte, start int) int {
+	for i := start + 1; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func skipJSONSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// peekJSONLevel finds the top level "level" string of a json object without decoding it,
+// so that logs below the minimum level can be dropped before their attributes are extracted.
+// It returns false when the level can not be determined cheaply.
+func peekJSONLevel(record []byte) (string, bool) {
+	depth := 0
+	for i := 0; i < len(record); i++ {
+		switch record[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case '"':
+			end := jsonStringEnd(record, i)
+			if end < 0 {
+				return "", false
+			}
+			if depth == 1 && string(record[i+1:end]) == "level" {
+				j := skipJSONSpace(record, end+1)
+				// only keys are followed by a colon
+				if j < len(record) && record[j] == ':' {
+					j = skipJSONSpace(record, j+1)
+					if j >= len(record) || record[j] != '"' {
+						return "", false
+					}
+					valueEnd := jsonStringEnd(record, j)
+					if valueEnd < 0 {
+						return "", false
+					}
+					return string(record[j+1 : valueEnd]), true
+				}
+			}
+			i = end
+		}
+	}
+	return "", false
+}
+
+// levelFieldKeys are the fields holding the level of a log, matched case-insensitively.
+var levelFieldKeys = []string{"level", "severity", "loglevel", "log_level"}
+
+// numericLevels are the numeric levels written by pino and bunyan.
+var numericLevels = map[float64]string{
+	10: model.LogLevelTrace.String(),
+	20: model.LogLevelDebug.String(),
+	30: model.LogLevelInfo.String(),
+	40: model.LogLevelWarn.String(),
+	50: model.LogLevelError.String(),
+	60: model.LogLevelFatal.String(),
+}
+
+// fieldLevel returns the level of the first level field found in the fields.
+func fieldLevel[V any](fields map[string]V) string {
+	for _, key := range levelFieldKeys {
+		for k, value := range fields {
+			if !strings.EqualFold(k, key) {
+				continue
+			}
+			switch v := any(value).(type) {
+			case string:
+				if level := normalizeLevel(v); level != "" {
+					return level
+				}
+			case float64:
+				if level, ok := numericLevels[v]; ok {
+					return level
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// messageLevel reads the level field of a json or logfmt message. Only the top level fields
+// of a json message are considered, so a nested object such as a request's `level` is ignored.
+func messageLevel(msg string) string {
+	msg = strings.TrimSpace(msg)
+	var fields map[string]interface{}
+	if strings.HasPrefix(msg, "{") && json.Unmarshal([]byte(msg), &fields) == nil {
+		return fieldLevel(fields)
+	}
+	if level, ok := peekLogfmtLevel(msg); ok {
+		return normalizeLevel(level)
+	}
+	return ""
+}
+
+// inferLevel infers the level of a log from a level field of its message, falling back to a level
+// field of its attributes and then to info. The message takes precedence since attributes such
+// as firehose common attributes are shared by every log of a stream.
+func inferLevel(msg string, attrs map[string]string) string {
+	if level := messageLevel(msg); level != "" {
+		return level
+	}
+	if level := fieldLevel(attrs); level != "" {
+		return level
+	}
+	return model.LogLevelInfo.String()
+}
+
+// logfmtLevelKeys are the logfmt keys holding the level, as written by logrus, go-kit and zap.
+var logfmtLevelKeys = []string{"level=", "lvl="}
+
+// peekLogfmtLevel finds the level of a logfmt line such as `time=... level=debug msg="..."`
+// without parsing the rest of it. It returns false when the line has no level pair.
+func peekLogfmtLevel(line string) (string, bool) {
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case inQuotes && line[i] == '\\':
+			i++
+		case line[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			for _, key := range logfmtLevelKeys {
+				if !strings.HasPrefix(line[i:], key) {
+					continue
+				}
+				value := line[i+len(key):]
+				if strings.HasPrefix(value, `"`) {
+					end := strings.IndexByte(value[1:], '"')
+					if end < 0 {
+						return "", false
+					}
+					return value[1 : end+1], true
+				}
+				if end := strings.IndexAny(value, " \t\r\n"); end >= 0 {
+					value = value[:end]
+				}
+				return value, value != ""
+			}
+		}
+	}
+	return "", false
+}
+
+// StatusLevels configures the level of access logs by their http status code.
+type StatusLevels struct {
+	// ErrorFrom is the lowest status code logged as an error.
+	ErrorFrom int
+	// WarnFrom is the lowest status code logged as a warning.
+	WarnFrom int
+	// Overrides sets the level of specific status codes, such as 404 as info.
+	Overrides map[int]string
+}
+
+var DefaultStatusLevels = StatusLevels{ErrorFrom: 500, WarnFrom: 400}
+
+var statusLevels = DefaultStatusLevels
+
+// SetStatusLevels sets the thresholds used to derive the level of access logs.
+// Unset thresholds fall back to DefaultStatusLevels.
+func SetStatusLevels(cfg StatusLevels) {
+	if cfg.ErrorFrom == 0 {
+		cfg.ErrorFrom = DefaultStatusLevels.ErrorFrom
+	}
+	if cfg.WarnFrom == 0 {
+		cfg.WarnFrom = DefaultStatusLevels.WarnFrom
+	}
+	statusLevels = cfg
+}
+
+// statusCodeAttributes are the attributes holding the status code of an access log, in order of precedence.
+var statusCodeAttributes = []string{string(semconv.HTTPStatusCodeKey), "status_code", "status"}
+
+// genericStatusAttribute is also used for statuses unrelated to http, such as job or order states,
+// so it is only read from logs carrying one of the httpRequestAttributes.
+const genericStatusAttribute = "status"
+
+var httpRequestAttributes = []string{
+	string(semconv.HTTPMethodKey), string(semconv.HTTPURLKey), string(semconv.HTTPTargetKey), string(semconv.HTTPRouteKey),
+	"method", "request_method", "path", "url", "request.method", "request.uri",
+}
+
+// parseHTTPStatus parses a three digit http status code.
+func parseHTTPStatus(v string) (int, bool) {
+	if len(v) != 3 || v[0] < '1' || v[0] > '5' {
+		return 0, false
+	}
+	code, err := strconv.Atoi(v)
+	return code, err == nil
+}
+
+func hasHTTPRequestAttribute(attributes map[string]string) bool {
+	for _, key := range httpRequestAttributes {
+		if attributes[key] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func levelFromStatus(code int, cfg StatusLevels) string {
+	if level, ok := cfg.Overrides[code]; ok {
+		return level
+	}
+	switch {
+	case code >= cfg.ErrorFrom:
+		return model.LogLevelError.String()
+	case code >= cfg.WarnFrom:
+		return model.LogLevelWarn.String()
+	default:
+		return model.LogLevelInfo.String()
+	}
+}
+
+// statusLevel derives the level of an access log without a level from its status code attribute.
+func statusLevel(attributes map[string]string) (string, bool) {
+	for _, key := range statusCodeAttributes {
+		if key == genericStatusAttribute && !hasHTTPRequestAttribute(attributes) {
+			continue
+		}
+		if code, ok := parseHTTPStatus(attributes[key]); ok {
+			return levelFromStatus(code, statusLevels), true
+		}
+	}
+	return "", false
+}
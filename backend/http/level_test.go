@@ -0,0 +1,162 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func TestLevelFromStatus(t *testing.T) {
+	custom := StatusLevels{ErrorFrom: 502, WarnFrom: 400, Overrides: map[int]string{404: "info", 429: "error"}}
+	for _, tc := range []struct {
+		code     int
+		cfg      StatusLevels
+		expected string
+	}{
+		{200, DefaultStatusLevels, "info"},
+		{301, DefaultStatusLevels, "info"},
+		{404, DefaultStatusLevels, "warn"},
+		{499, DefaultStatusLevels, "warn"},
+		{500, DefaultStatusLevels, "error"},
+		{503, DefaultStatusLevels, "error"},
+		{200, custom, "info"},
+		{404, custom, "info"},
+		{403, custom, "warn"},
+		{429, custom, "error"},
+		{500, custom, "warn"},
+		{502, custom, "error"},
+	} {
+		t.Run(fmt.Sprintf("%d/%d", tc.code, tc.cfg.ErrorFrom), func(t *testing.T) {
+			assert.Equal(t, tc.expected, levelFromStatus(tc.code, tc.cfg))
+		})
+	}
+}
+
+func TestSubmitLogStatusLevel(t *testing.T) {
+	submitted := captureSubmits(t)
+	ctx := context.Background()
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "GET /", Attributes: map[string]string{"method": "GET", "status": "503"}}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "GET /", Level: "debug", Attributes: map[string]string{"method": "GET", "status": "503"}}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "GET /", Attributes: map[string]string{"http.status_code": "404"}}))
+	// a status unrelated to http is left alone
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "job done", Level: "info", Attributes: map[string]string{"status": "500"}}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "job done", Attributes: map[string]string{"status": "500"}}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "GET /", Attributes: map[string]string{"status_code": "5000"}}))
+
+	assert.Equal(t, "error", (*submitted)[0].log.Level)
+	assert.Equal(t, "debug", (*submitted)[1].log.Level)
+	assert.Equal(t, "warn", (*submitted)[2].log.Level)
+	assert.Equal(t, "info", (*submitted)[3].log.Level)
+	assert.NotEqual(t, "error", (*submitted)[4].log.Level)
+	assert.NotEqual(t, "error", (*submitted)[5].log.Level)
+}
+
+func TestSetStatusLevelsDefaults(t *testing.T) {
+	defer SetStatusLevels(DefaultStatusLevels)
+
+	SetStatusLevels(StatusLevels{})
+	assert.Equal(t, DefaultStatusLevels.ErrorFrom, statusLevels.ErrorFrom)
+	assert.Equal(t, DefaultStatusLevels.WarnFrom, statusLevels.WarnFrom)
+
+	SetStatusLevels(StatusLevels{Overrides: map[int]string{404: "info"}})
+	assert.Equal(t, "info", levelFromStatus(404, statusLevels))
+	assert.Equal(t, "error", levelFromStatus(500, statusLevels))
+}
+
+func TestPeekLogfmtLevel(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		expected string
+		ok       bool
+	}{
+		{`time="2023-10-11T22:14:15Z" level=debug msg="cache miss"`, "debug", true},
+		{`lvl=warn msg="disk almost full"`, "warn", true},
+		{`level="error" msg=failed`, "error", true},
+		{`msg="retrying level=debug" level=info`, "info", true},
+		{`loglevel=debug msg=hi`, "", false},
+		{`plain text message`, "", false},
+	} {
+		level, ok := peekLogfmtLevel(tc.line)
+		assert.Equal(t, tc.ok, ok, tc.line)
+		assert.Equal(t, tc.expected, level, tc.line)
+	}
+}
+
+func TestRawLogMinLevel(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetMinLevel(1, "info")
+	defer SetMinLevel(1, "")
+	SetRawRecordSeparator("\n")
+	defer SetRawRecordSeparator("")
+
+	body := "level=debug msg=\"dropped\"\nlevel=warn msg=\"kept\"\nno level at all\n"
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader(body))
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var messages []string
+	for _, s := range *submitted {
+		messages = append(messages, s.log.Message)
+	}
+	assert.Equal(t, []string{`level=warn msg="kept"`, "no level at all"}, messages)
+}
+
+func TestInferLevel(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		attrs    map[string]string
+		expected string
+	}{
+		{"user signed in", nil, "info"},
+		// the level is read from fields rather than guessed from the words of the message
+		{"an error occurred while retrying", nil, "info"},
+		{`{"level":"ERROR","msg":"payment failed"}`, nil, "error"},
+		{`{"Severity":"warning","msg":"disk almost full"}`, nil, "warn"},
+		{`{"logLevel":"crit"}`, nil, "fatal"},
+		{`{"level":50,"msg":"pino error"}`, nil, "error"},
+		// a level nested in the json message belongs to another object
+		{`{"msg":"proxied","upstream":{"level":"error"}}`, nil, "info"},
+		// a json message is not read as logfmt
+		{`{"msg":"level=error is only text"}`, nil, "info"},
+		// a truncated json message is not a json message
+		{`{"level":"error","msg":"trunc`, nil, "info"},
+		{`time=2023-08-11T02:52:40Z level=debug msg="cache miss"`, nil, "debug"},
+		{`ts=1 lvl=WARN msg=slow`, nil, "warn"},
+		{"bare message", map[string]string{"LogLevel": "ERR"}, "error"},
+		{"bare message", map[string]string{"severity": "TRACE"}, "trace"},
+		{"bare message", map[string]string{"level": "unknown"}, "info"},
+		// the message takes precedence over the attributes shared by the stream
+		{`{"level":"debug"}`, map[string]string{"level": "error"}, "debug"},
+		{`{"level":"unknown"}`, map[string]string{"level": "error"}, "error"},
+	} {
+		assert.Equal(t, tc.expected, inferLevel(tc.msg, tc.attrs), tc.msg)
+	}
+}
+
+func TestHandleFirehoseLogInferLevel(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	cloudwatch := `{"messageType":"DATA_MESSAGE","owner":"123456789012","logGroup":"/aws/lambda/checkout","logStream":"2023/08/11/[$LATEST]abc","subscriptionFilters":["highlight"],"logEvents":[` +
+		`{"id":"1","timestamp":1691722360000,"message":"{\"level\":\"error\",\"msg\":\"payment failed\"}"},` +
+		`{"id":"2","timestamp":1691722361000,"message":"level=warn msg=\"slow query\""},` +
+		`{"id":"3","timestamp":1691722362000,"message":"START RequestId: 8f5c"}]}`
+	r := newFirehoseRequest(cloudwatch, "plain record")
+	r.Header.Set("X-Amz-Firehose-Common-Attributes", `{"commonAttributes":{"x-highlight-project":"1","Severity":"debug"}}`)
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	var levels []string
+	for _, s := range *submitted {
+		levels = append(levels, s.log.Level)
+	}
+	assert.Equal(t, []string{"error", "warn", "debug", "debug"}, levels)
+}
@@ -1,25 +1,29 @@
 package http
 
 import (
-	"compress/gzip"
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"io"
+	"mime"
 	"net/http"
-	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 
-	model2 "github.com/highlight-run/highlight/backend/model"
 	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
 	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+	hmetric "github.com/highlight/highlight/sdk/highlight-go/metric"
 	highlightChi "github.com/highlight/highlight/sdk/highlight-go/middleware/chi"
 )
 
@@ -30,17 +34,26 @@ const (
 	LogDrainServiceHeader     = "x-highlight-service"
 )
 
-func getBody(r *http.Request) (body io.Reader, err error) {
-	body = r.Body
-	if r.Header.Get("Content-Encoding") == "gzip" {
-		body, err = gzip.NewReader(r.Body)
-		if err != nil {
-			return
-		}
+// getBody returns the decompressed request body. Both the compressed and the decompressed body
+// are limited to the max body size, so that a small compressed body can not inflate without bound.
+func getBody(r *http.Request) (io.Reader, error) {
+	if stats := getIngestStats(r.Context()); stats != nil {
+		stats.markBodyRead(time.Now())
 	}
-	return
+	body, err := decodeBody(r.Header.Get("Content-Encoding"), limitBody(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	// the decompression slot is released once the request is handled even if the body is not read to the end
+	context.AfterFunc(r.Context(), func() {
+		_ = body.Close()
+	})
+	return limitBody(body), nil
 }
 
+// getJSONLogs returns the json documents of a request body. An `application/x-ndjson` body holds
+// one document per line, and other bodies are a single document unless they hold several top-level
+// values, as sent by agents that batch newline delimited json without setting its content type.
 func getJSONLogs(r *http.Request) (logs [][]byte, err error) {
 	var requestBody io.Reader
 	requestBody, err = getBody(r)
@@ -51,59 +64,356 @@ func getJSONLogs(r *http.Request) (logs [][]byte, err error) {
 	if err != nil {
 		return
 	}
+	body = decodeText(body, r.Header.Get("Content-Type"))
 
-	if r.Header.Get("Content-Type") != "application/x-ndjson" {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/x-ndjson" {
+		if values, ok := splitJSONValues(body); ok {
+			return values, nil
+		}
 		return [][]byte{body}, nil
 	}
 
-	jsons := regexp.MustCompile(`\n+`).Split(string(body), -1)
-	for _, j := range jsons {
-		if j == "" {
+	lines := bytes.Split(body, []byte("\n"))
+	for idx, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
 			continue
 		}
-		logs = append(logs, []byte(j))
+		// a client cut off mid-write leaves an unterminated partial line that is dropped
+		// rather than failing the complete lines before it
+		if idx == len(lines)-1 && !json.Valid(line) {
+			log.WithContext(r.Context()).WithField("line", string(line)).Warn("dropping partial ndjson line")
+			continue
+		}
+		logs = append(logs, line)
 	}
 	return
 }
 
+// splitJSONValues splits a body holding several top-level json values, reporting false
+// when it holds a single value or is not valid json.
+func splitJSONValues(body []byte) ([][]byte, bool) {
+	var values [][]byte
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, len(values) > 1
+}
+
 func getQueryStringParams(r *http.Request) (int, string, error) {
 	qs := r.URL.Query()
 	projectVerboseID := qs.Get(LogDrainProjectQueryParam)
 	if projectVerboseID == "" {
+		auditAuthFailure(r, projectVerboseID, "missing project")
 		return 0, "", errors.New("invalid verbose id")
 	}
-	projectID, err := model2.FromVerboseID(projectVerboseID)
+	projectID, err := parseProjectID(projectVerboseID)
 	if err != nil {
+		auditAuthFailure(r, projectVerboseID, "invalid project")
 		log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", projectVerboseID).Error("failed to parse highlight project id from http logs request")
-		return 0, "", nil
+		return 0, "", err
 	}
 	return projectID, qs.Get(LogDrainServiceQueryParam), nil
 }
 
+// getProjectParams reads the project and service from the highlight headers,
+// falling back to the query string for clients that can only configure a url.
+func getProjectParams(r *http.Request) (int, string, error) {
+	projectVerboseID, err := getHeader(r, LogDrainProjectHeader)
+	if err != nil {
+		return 0, "", err
+	}
+	if projectVerboseID == "" {
+		return getQueryStringParams(r)
+	}
+	projectID, err := parseProjectID(projectVerboseID)
+	if err != nil {
+		auditAuthFailure(r, projectVerboseID, "invalid project")
+		log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", projectVerboseID).Error("failed to parse highlight project id from http logs request")
+		return 0, "", err
+	}
+	serviceName, err := getHeader(r, LogDrainServiceHeader)
+	if err != nil {
+		return 0, "", err
+	}
+	return projectID, serviceName, nil
+}
+
+type firehoseRequest struct {
+	RequestId string
+	Timestamp int64
+	Records   []struct {
+		Data string
+	}
+}
+
+// firehoseRecordError reports a record of a firehose request that could not be ingested.
+type firehoseRecordError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+const (
+	// FirehoseRequestIDAttribute holds the id of the firehose delivery a log was ingested from.
+	FirehoseRequestIDAttribute = "firehose_request_id"
+	// CloudWatchEventIDAttribute holds the id of the cloudwatch log event a log was ingested from.
+	CloudWatchEventIDAttribute = "cloudwatch_event_id"
+)
+
+// parseFirehoseRecords decodes the records of a firehose request into logs. The common attributes
+// configured on the delivery stream are used to infer the level of the records. A record may hold many
+// logs, so the index of the record of each log is returned alongside the records that failed to decode.
+// Every log carries the request id under `firehose_request_id`, and the logs of cloudwatch events
+// carry the event id under `cloudwatch_event_id`, so that they can be traced back to their delivery.
+// The trace ids that the logs carry are normalized to link them to their traces.
+// A service name set on the request is the service of every log, otherwise cloudwatch events fall
+// back to their log group.
+func parseFirehoseRecords(ctx context.Context, projectID int, lg *firehoseRequest, commonAttributes map[string]string, serviceName string) ([]hlog.Log, []int, []firehoseRecordError) {
+	var logs []hlog.Log
+	var records []int
+	var failed []firehoseRecordError
+	for idx, l := range lg.Records {
+		recordLogs, err := parseFirehoseRecord(ctx, projectID, lg, l.Data, commonAttributes)
+		if err != nil {
+			failed = append(failed, firehoseRecordError{Index: idx, Error: err.Error()})
+			continue
+		}
+		for i := range recordLogs {
+			if recordLogs[i].Attributes == nil {
+				recordLogs[i].Attributes = make(map[string]string)
+			}
+			recordLogs[i].Attributes[FirehoseRequestIDAttribute] = lg.RequestId
+			applyTraceContext(&recordLogs[i])
+			if serviceName != "" {
+				recordLogs[i].Attributes[string(semconv.ServiceNameKey)] = serviceName
+			}
+			records = append(records, idx)
+		}
+		logs = append(logs, recordLogs...)
+	}
+	return logs, records, failed
+}
+
+func parseFirehoseRecord(ctx context.Context, projectID int, lg *firehoseRequest, recordData string, commonAttributes map[string]string) ([]hlog.Log, error) {
+	data, err := base64.StdEncoding.DecodeString(recordData)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("data", recordData).Error("invalid base64 firehose record")
+		return nil, err
+	}
+
+	msg := data
+	// records are compressed by the producer rather than firehose, so the encoding is detected from the data
+	if encoding := sniffEncoding(data); encoding != "" {
+		record, err := decodeBody(encoding, bytes.NewReader(data))
+		if err == nil {
+			msg, err = io.ReadAll(limitBody(record))
+			_ = record.Close()
+		}
+		if err != nil {
+			log.WithContext(ctx).WithError(err).WithField("encoding", encoding).Error("invalid http firehose record data decompressing")
+			return nil, err
+		}
+	}
+
+	// security hub findings hold a list of findings in the aws security finding format
+	if firehoseDetectorEnabled(projectID, FirehoseDetectorASFF) {
+		if findings, ok := parseASFFLogs(msg); ok {
+			return findings, nil
+		}
+	}
+
+	// embedded metric format documents carry their metadata under an _aws key
+	if firehoseDetectorEnabled(projectID, FirehoseDetectorEMF) {
+		if hl, ok := parseEMFLog(ctx, msg); ok {
+			return []hlog.Log{*hl}, nil
+		}
+	}
+
+	var cloudwatchPayload struct {
+		MessageType         string
+		Owner               string
+		LogGroup            string
+		LogStream           string
+		SubscriptionFilters []string
+		LogEvents           []struct {
+			Id        string
+			Timestamp int64
+			Message   string
+		}
+	}
+	// try to parse the message as a cloudwatch payload
+	// if it is not, send it as a raw log message
+	if !firehoseDetectorEnabled(projectID, FirehoseDetectorCloudWatch) || json.Unmarshal(msg, &cloudwatchPayload) != nil {
+		return []hlog.Log{{
+			Message:   string(msg),
+			Timestamp: time.UnixMilli(lg.Timestamp).UTC().Format(hlog.TimestampFormat),
+			Level:     inferLevel(string(msg), commonAttributes),
+		}}, nil
+	}
+
+	serviceName := cloudwatchPayload.LogGroup
+	if serviceName == "" {
+		serviceName = "firehose"
+	}
+	var logs []hlog.Log
+	for _, event := range cloudwatchPayload.LogEvents {
+		hl := hlog.Log{
+			Message:   event.Message,
+			Timestamp: time.UnixMilli(event.Timestamp).UTC().Format(hlog.TimestampFormat),
+			Level:     inferLevel(event.Message, commonAttributes),
+			Attributes: map[string]string{
+				string(semconv.ServiceNameKey): serviceName,
+				"message_type":                 cloudwatchPayload.MessageType,
+				"owner":                        cloudwatchPayload.Owner,
+				"log_group":                    cloudwatchPayload.LogGroup,
+				"log_stream":                   cloudwatchPayload.LogStream,
+				CloudWatchEventIDAttribute:     event.Id,
+			},
+		}
+		logs = append(logs, hl)
+	}
+	return logs, nil
+}
+
+var firehoseAsync = struct {
+	sync.RWMutex
+	queue chan func()
+}{}
+
+// SetFirehoseAsync acknowledges firehose requests as soon as their records are buffered, decoding
+// and submitting them on the given number of background workers. Failures are then only logged
+// rather than reported to firehose for a retry. Zero workers disables it. Reconfiguring lets the
+// workers of the previous queue drain its buffered requests before they exit.
+func SetFirehoseAsync(workers int, queueSize int) {
+	firehoseAsync.Lock()
+	defer firehoseAsync.Unlock()
+	if firehoseAsync.queue != nil {
+		close(firehoseAsync.queue)
+		firehoseAsync.queue = nil
+	}
+	if workers <= 0 {
+		return
+	}
+	queue := make(chan func(), queueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	firehoseAsync.queue = queue
+}
+
+func firehoseAsyncEnabled() bool {
+	firehoseAsync.RLock()
+	defer firehoseAsync.RUnlock()
+	return firehoseAsync.queue != nil
+}
+
+// enqueueFirehoseJob buffers the job for the background workers. It returns false when the
+// async mode is disabled or the workers are saturated.
+func enqueueFirehoseJob(job func()) bool {
+	firehoseAsync.RLock()
+	defer firehoseAsync.RUnlock()
+	if firehoseAsync.queue == nil {
+		return false
+	}
+	select {
+	case firehoseAsync.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeFirehoseResponse acknowledges a firehose request. When some of its records failed, the
+// response is a 207 listing them so that the rest of the request is not retried. The number of
+// empty logs that were skipped and of duplicate logs that were suppressed are reported too.
+func writeFirehoseResponse(w http.ResponseWriter, requestId string, failed []firehoseRecordError, skipped int, duplicates int) {
+	w.Header().Add("content-type", "application/json")
+	js, _ := json.Marshal(struct {
+		RequestId  string                `json:"requestId"`
+		Timestamp  int64                 `json:"timestamp"`
+		Failed     []firehoseRecordError `json:"failed,omitempty"`
+		Skipped    int                   `json:"skipped,omitempty"`
+		Duplicates int                   `json:"duplicates,omitempty"`
+	}{
+		RequestId:  requestId,
+		Timestamp:  time.Now().UnixMilli(),
+		Failed:     failed,
+		Skipped:    skipped,
+		Duplicates: duplicates,
+	})
+	if len(failed) > 0 {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	_, _ = w.Write(js)
+}
+
+// submitFirehoseLogs submits the logs of a firehose request, returning every record that failed.
+// An error is returned when the whole request should be retried.
+func submitFirehoseLogs(ctx context.Context, projectID int, logs []hlog.Log, records []int, failed []firehoseRecordError) ([]firehoseRecordError, error) {
+	reported := make(map[int]bool, len(failed))
+	for _, f := range failed {
+		reported[f.Index] = true
+	}
+	errs := submitLogs(ctx, projectID, logs)
+	submitErrors := 0
+	for _, err := range errs {
+		if err != nil {
+			submitErrors++
+		}
+	}
+	recordSubmitted(ctx, endpointFirehose, projectID, len(logs)-submitErrors, submitErrors)
+	for idx, err := range errs {
+		if err == nil {
+			continue
+		}
+		// a paused or rate limited project or a submit that did not complete fails the whole request
+		// so that it is retried
+		var paused *IngestPausedError
+		var rateLimited *ProjectRateLimitedError
+		if errors.As(err, &paused) || errors.As(err, &rateLimited) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if !reported[records[idx]] {
+			reported[records[idx]] = true
+			failed = append(failed, firehoseRecordError{Index: records[idx], Error: err.Error()})
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].Index < failed[j].Index
+	})
+	return failed, nil
+}
+
 func HandleFirehoseLog(w http.ResponseWriter, r *http.Request) {
 	requestBody, err := getBody(r)
 	if err != nil {
-		log.WithContext(r.Context()).WithError(err).Error("invalid http firehose gzip")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.WithContext(r.Context()).WithError(err).Error("invalid http firehose content encoding")
+		writeBodyError(w, err)
 		return
 	}
 	body, err := io.ReadAll(requestBody)
 	if err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("invalid http firehose body")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
-	var lg struct {
-		RequestId string
-		Timestamp int64
-		Records   []struct {
-			Data string
-		}
-	}
+	var lg firehoseRequest
 	if err := json.Unmarshal(body, &lg); err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("invalid http firehose json")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordDecodeErrors(r.Context(), endpointFirehose, 0, 1)
+		writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not a firehose request")
 		return
 	}
 
@@ -112,108 +422,98 @@ func HandleFirehoseLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	attributesMap := struct {
-		CommonAttributes struct {
-			ProjectID string `json:"x-highlight-project"`
-		} `json:"commonAttributes"`
+		CommonAttributes map[string]string `json:"commonAttributes"`
 	}{}
 	if err := json.Unmarshal([]byte(r.Header.Get("X-Amz-Firehose-Common-Attributes")), &attributesMap); err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("invalid http firehose attriutes")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrorCodeInvalidHeader, "invalid X-Amz-Firehose-Common-Attributes header")
 		return
 	}
-	projectID, err := model2.FromVerboseID(attributesMap.CommonAttributes.ProjectID)
+	// an api key takes precedence over the project of the common attributes
+	projectID, hasKey, err := resolveAPIKeyProject(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, ErrorCodeInvalidProject, "invalid api key")
+		return
+	}
+	if !hasKey {
+		projectVerboseID := attributesMap.CommonAttributes[LogDrainProjectHeader]
+		if projectID, err = parseProjectID(projectVerboseID); err != nil {
+			auditAuthFailure(r, projectVerboseID, "invalid project")
+			log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", projectVerboseID).Error("invalid highlight project id from http firehose request")
+			writeError(w, http.StatusUnauthorized, ErrorCodeInvalidProject, "invalid project")
+			return
+		}
+	}
+	recordReceived(r.Context(), endpointFirehose, projectID, len(lg.Records), len(body))
+	// firehose only sends the common attributes of the delivery stream, so the service may be set there too
+	serviceName, err := getHeader(r, LogDrainServiceHeader)
 	if err != nil {
-		log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", attributesMap.CommonAttributes.ProjectID).Error("invalid highlight project id from http firehose request")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrorCodeInvalidHeader, err.Error())
 		return
 	}
+	if serviceName == "" {
+		serviceName = attributesMap.CommonAttributes[LogDrainServiceHeader]
+	}
 
-	for _, l := range lg.Records {
-		data, err := base64.StdEncoding.DecodeString(l.Data)
+	if firehoseAsyncEnabled() {
+		// a paused or rate limited project is rejected before acknowledging since the failure can not
+		// be reported later. the budget is charged when the logs are submitted.
+		err := checkIngestGate(r.Context(), projectID)
+		if err == nil {
+			err = checkProjectRateLimit(r.Context(), projectID, len(lg.Records))
+		}
 		if err != nil {
-			log.WithContext(r.Context()).WithError(err).WithField("data", data).Error("invalid base64 firehose record")
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+			writeSubmitError(w, err)
 			return
 		}
 
-		var msg []byte
-		// try to load data as gzip. if it is not, assume it is not compressed
-		gz, err := gzip.NewReader(strings.NewReader(string(data)))
-		if err == nil {
-			msg, err = io.ReadAll(gz)
+		ctx := context.WithoutCancel(r.Context())
+		job := func() {
+			logs, records, failed := parseFirehoseRecords(ctx, projectID, &lg, attributesMap.CommonAttributes, serviceName)
+			recordDecodeErrors(ctx, endpointFirehose, projectID, len(failed))
+			logs, records, _ = dropEmptyLogs(ctx, projectID, logs, records)
+			logs, records, keys, _ := dropDuplicateLogs(ctx, projectID, lg.RequestId, logs, records)
+			failed, err := submitFirehoseLogs(ctx, projectID, logs, records, failed)
 			if err != nil {
-				log.WithContext(r.Context()).WithError(err).WithField("data", data).Error("invalid http firehose record data reading gzip")
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				log.WithContext(ctx).WithError(err).WithField("requestId", lg.RequestId).Error("failed to submit async firehose logs")
 				return
 			}
-		} else {
-			msg = data
-		}
-
-		var cloudwatchPayload struct {
-			MessageType         string
-			Owner               string
-			LogGroup            string
-			LogStream           string
-			SubscriptionFilters []string
-			LogEvents           []struct {
-				Id        string
-				Timestamp int64
-				Message   string
+			markSubmittedLogs(ctx, keys, records, failed)
+			if len(failed) > 0 {
+				log.WithContext(ctx).WithField("requestId", lg.RequestId).WithField("failed", failed).Error("failed to submit async firehose records")
 			}
 		}
-		// try to parse the message as a cloudwatch payload
-		// if it is not, send it as a raw log message
-		if err := json.Unmarshal(msg, &cloudwatchPayload); err != nil {
-			hl := hlog.Log{
-				Message:   string(msg),
-				Timestamp: time.UnixMilli(lg.Timestamp).UTC().Format(hlog.TimestampFormat),
-				Level:     "info",
-			}
-			if err := hlog.SubmitHTTPLog(r.Context(), tracer, projectID, hl); err != nil {
-				log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-		} else {
-			for _, event := range cloudwatchPayload.LogEvents {
-				hl := hlog.Log{
-					Message:   event.Message,
-					Timestamp: time.UnixMilli(event.Timestamp).UTC().Format(hlog.TimestampFormat),
-					Level:     "info",
-					Attributes: map[string]string{
-						string(semconv.ServiceNameKey): "firehose",
-						"message_type":                 cloudwatchPayload.MessageType,
-						"owner":                        cloudwatchPayload.Owner,
-						"log_group":                    cloudwatchPayload.LogGroup,
-						"log_stream":                   cloudwatchPayload.LogStream,
-					},
-				}
-				if err := hlog.SubmitHTTPLog(r.Context(), tracer, projectID, hl); err != nil {
-					log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
-					http.Error(w, err.Error(), http.StatusBadRequest)
-					return
-				}
-			}
+		if enqueueFirehoseJob(job) {
+			writeFirehoseResponse(w, lg.RequestId, nil, 0, 0)
+			return
 		}
+		// the workers are saturated, so the request is processed synchronously to apply backpressure
+	}
 
+	logs, records, failed := parseFirehoseRecords(r.Context(), projectID, &lg, attributesMap.CommonAttributes, serviceName)
+	recordDecodeErrors(r.Context(), endpointFirehose, projectID, len(failed))
+	logs, records, skipped := dropEmptyLogs(r.Context(), projectID, logs, records)
+	logs, records, keys, duplicates := dropDuplicateLogs(r.Context(), projectID, lg.RequestId, logs, records)
+	failed, err = submitFirehoseLogs(r.Context(), projectID, logs, records, failed)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
+	}
+	markSubmittedLogs(r.Context(), keys, records, failed)
+	if len(failed) > 0 {
+		log.WithContext(r.Context()).WithField("requestId", lg.RequestId).WithField("failed", failed).Warn("failed to submit firehose records")
 	}
 
-	w.Header().Add("content-type", "application/json")
-	js, _ := json.Marshal(struct {
-		RequestId string `json:"requestId"`
-		Timestamp int64  `json:"timestamp"`
-	}{
-		RequestId: lg.RequestId,
-		Timestamp: time.Now().UnixMilli(),
-	})
-	_, _ = w.Write(js)
+	writeFirehoseResponse(w, lg.RequestId, failed, skipped, duplicates)
 }
 
 func HandlePinoLogs(w http.ResponseWriter, r *http.Request, lgJson []byte, logs *hlog.PinoLogs) {
 	projectID, serviceName, err := getQueryStringParams(r)
 	if err != nil {
-		http.Error(w, "no project query string parameter provided", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrorCodeInvalidProject, "invalid project")
+		return
 	}
 
 	// parse the logs as a list of maps to get other structured attributes (from the top level)
@@ -222,10 +522,11 @@ func HandlePinoLogs(w http.ResponseWriter, r *http.Request, lgJson []byte, logs
 	}
 	if err := json.Unmarshal(lgJson, &lgAttrs); err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("invalid http logs json")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not valid json")
 		return
 	}
 
+	var pinoLogs []hlog.Log
 	for idx, pinoLog := range logs.Logs {
 		var lg hlog.Log
 		lg.Attributes = make(map[string]string)
@@ -252,27 +553,138 @@ func HandlePinoLogs(w http.ResponseWriter, r *http.Request, lgJson []byte, logs
 			if has := map[string]bool{"level": true, "time": true, "msg": true}[k]; has {
 				continue
 			}
-			for key, value := range hlog.FormatLogAttributes(r.Context(), k, v) {
+			for key, value := range formatAttributes(r.Context(), k, v) {
 				lg.Attributes[key] = value
 			}
 		}
 
-		if err := hlog.SubmitHTTPLog(r.Context(), tracer, projectID, lg); err != nil {
-			log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		pinoLogs = append(pinoLogs, lg)
+	}
+	if err := firstError(submitLogs(r.Context(), projectID, pinoLogs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
+	}
+}
+
+// caddyAccessLogger is the logger name prefix of caddy access logs, e.g. `http.log.access.log0`.
+const caddyAccessLogger = "http.log.access"
+
+// parseJSONLog parses a log in the hlog.Log json shape, keeping the top level fields as attributes.
+func parseJSONLog(ctx context.Context, lgJson []byte) (hlog.Log, error) {
+	var lg hlog.Log
+	lg.Attributes = make(map[string]string)
+	// the remaining fields are still decoded when the message or the level are not strings
+	var typeErr *json.UnmarshalTypeError
+	structErr := json.Unmarshal(lgJson, &lg)
+	if structErr != nil && !(errors.As(structErr, &typeErr) && (typeErr.Field == "message" || typeErr.Field == "level")) {
+		return lg, structErr
+	}
+
+	var lgAttrs map[string]interface{}
+	if err := json.Unmarshal(lgJson, &lgAttrs); err != nil {
+		return lg, err
+	}
+	if isOpenSearchAuditLog(lgAttrs) {
+		return parseOpenSearchAuditLog(ctx, lgAttrs), nil
+	}
+	if _, ok := lgAttrs["message"].(string); structErr != nil && !ok && lgAttrs["message"] != nil {
+		lg.Message = coerceMessage(lgAttrs["message"])
+	}
+	if mergeDecodeField(ctx, lgAttrs) {
+		// the decoded document may hold the fields of the log itself
+		if message, ok := lgAttrs["message"].(string); ok && lg.Message == "" {
+			lg.Message = message
+		}
+		if level, ok := lgAttrs["level"].(string); ok && lg.Level == "" {
+			lg.Level = level
+		}
+		if timestamp, ok := lgAttrs["timestamp"].(string); ok && lg.Timestamp == "" {
+			lg.Timestamp = timestamp
+		}
+	}
+	for k, v := range lgAttrs {
+		// the reserved fields are decoded into the log itself rather than kept as attributes
+		if _, ok := v.(string); jsonReservedFields[k] && (ok || k == "message") {
+			continue
+		}
+		for key, value := range formatAttributes(ctx, k, v) {
+			lg.Attributes[key] = value
+		}
+	}
+
+	// zap based loggers such as caddy write the message to `msg` and a fractional epoch to `ts`
+	if msg, ok := lgAttrs["msg"].(string); ok && lg.Message == "" {
+		lg.Message = msg
+		delete(lg.Attributes, "msg")
+	}
+	if ts, ok := parseTimestamp(lgAttrs["ts"]); ok && lg.Timestamp == "" {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+		delete(lg.Attributes, "ts")
+	}
+	// pino writes numeric levels and the epoch milliseconds to `time`
+	if level, ok := lgAttrs["level"].(float64); ok && lg.Level == "" {
+		if lg.Level, ok = numericLevels[level]; ok {
+			delete(lg.Attributes, "level")
+		}
+		if ts, ok := lgAttrs["time"].(float64); ok && lg.Timestamp == "" {
+			lg.Timestamp = epochTime(ts).Format(hlog.TimestampFormatNano)
+			delete(lg.Attributes, "time")
+		}
+	}
+	if level := normalizeLevel(lg.Level); level != "" {
+		lg.Level = level
+	}
+	// zap's production encoder writes the stack of error logs to `stacktrace`
+	if stacktrace, ok := lgAttrs["stacktrace"].(string); ok && stacktrace != "" {
+		lg.Attributes[string(semconv.ExceptionStacktraceKey)] = stacktrace
+		delete(lg.Attributes, "stacktrace")
+		if rank, ok := levelRank[lg.Level]; !ok || rank < levelRank[model.LogLevelError.String()] {
+			lg.Level = model.LogLevelError.String()
 		}
 	}
+	// caddy writes every access log below a 5xx at info, so the level is derived from the status instead
+	if strings.HasPrefix(lg.Attributes["logger"], caddyAccessLogger) && lg.Level == model.LogLevelInfo.String() {
+		lg.Level = ""
+	}
+	limitAttributes(ctx, &lg)
+	return lg, nil
+}
+
+// jsonReservedFields are the fields of a json log that are decoded into its message, level and timestamp.
+var jsonReservedFields = map[string]bool{
+	"message":   true,
+	"level":     true,
+	"timestamp": true,
+}
+
+var bodyProjectField string
+
+// SetBodyProjectField sets the json field holding the project verbose id of a log,
+// used when the request has no project header. Passing an empty field disables it.
+func SetBodyProjectField(field string) {
+	bodyProjectField = field
 }
 
 func HandleJSONLog(w http.ResponseWriter, r *http.Request) {
 	logs, err := getJSONLogs(r)
 	if err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("invalid http logs json")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordDecodeErrors(r.Context(), endpointJSON, 0, 1)
+		writeBodyError(w, err)
+		return
+	}
+
+	// an api key takes precedence over the project header and the body project field
+	keyProjectID, hasKey, err := resolveAPIKeyProject(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, ErrorCodeInvalidProject, "invalid api key")
 		return
 	}
 
+	batch := newLogBatch()
+	received := make(map[int]int)
+	receivedBytes := make(map[int]int)
 	for _, lgJson := range logs {
 		var pinoLg hlog.PinoLogs
 		if err := json.Unmarshal(lgJson, &pinoLg); err == nil && len(pinoLg.Logs) > 0 {
@@ -280,46 +692,82 @@ func HandleJSONLog(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		var lg hlog.Log
-		lg.Attributes = make(map[string]string)
-		if err := json.Unmarshal(lgJson, &lg); err != nil {
-			log.WithContext(r.Context()).WithError(err).Error("invalid http logs json")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		var lgAttrs map[string]interface{}
-		if err := json.Unmarshal(lgJson, &lgAttrs); err != nil {
-			log.WithContext(r.Context()).WithError(err).Error("invalid http logs json")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		for k, v := range lgAttrs {
-			for key, value := range hlog.FormatLogAttributes(r.Context(), k, v) {
-				lg.Attributes[key] = value
-			}
-		}
-
 		attributes := make(map[string]string)
 		for _, k := range []string{
 			LogDrainProjectHeader,
 			LogDrainServiceHeader,
 		} {
-			value := r.Header.Get(k)
+			value, err := getHeader(r, k)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrorCodeInvalidHeader, err.Error())
+				return
+			}
 			attributes[k] = value
 		}
-		projectID, err := model2.FromVerboseID(attributes[LogDrainProjectHeader])
-		if err != nil {
-			log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", attributes[LogDrainProjectHeader]).Error("failed to parse highlight project id from http logs request")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		// without a project header the log is parsed up front to read the project from its body
+		var lg hlog.Log
+		parsed := false
+		if !hasKey && attributes[LogDrainProjectHeader] == "" && bodyProjectField != "" {
+			if lg, err = parseJSONLog(r.Context(), lgJson); err != nil {
+				log.WithContext(r.Context()).WithError(err).Error("invalid http logs json")
+				recordDecodeErrors(r.Context(), endpointJSON, 0, 1)
+				writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not valid json")
+				return
+			}
+			parsed = true
+			attributes[LogDrainProjectHeader] = lg.Attributes[bodyProjectField]
 		}
-		lg.Attributes[string(semconv.ServiceNameKey)] = attributes[LogDrainServiceHeader]
-		if err := hlog.SubmitHTTPLog(r.Context(), tracer, projectID, lg); err != nil {
-			log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		projectID := keyProjectID
+		if !hasKey {
+			if projectID, err = parseProjectID(attributes[LogDrainProjectHeader]); err != nil {
+				auditAuthFailure(r, attributes[LogDrainProjectHeader], "invalid project")
+				log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", attributes[LogDrainProjectHeader]).Error("failed to parse highlight project id from http logs request")
+				writeError(w, http.StatusUnauthorized, ErrorCodeInvalidProject, "invalid project")
+				return
+			}
+		}
+		received[projectID]++
+		receivedBytes[projectID] += len(lgJson)
+
+		if !parsed {
+			if hasMinLevel(projectID) {
+				if level, ok := peekJSONLevel(lgJson); ok && belowMinLevel(projectID, level) {
+					hmetric.Incr(r.Context(), "http-logs.filtered", []attribute.KeyValue{attribute.Int("project_id", projectID)}, 1)
+					continue
+				}
+			}
+
+			if lg, err = parseJSONLog(r.Context(), lgJson); err != nil {
+				log.WithContext(r.Context()).WithError(err).Error("invalid http logs json")
+				recordDecodeErrors(r.Context(), endpointJSON, projectID, 1)
+				writeError(w, http.StatusBadRequest, ErrorCodeDecodeFailed, "request body is not valid json")
+				return
+			}
+		}
+		if bodyProjectField != "" {
+			delete(lg.Attributes, bodyProjectField)
 		}
+		// the service of the payload takes precedence over the header
+		if lg.Attributes[string(semconv.ServiceNameKey)] == "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = attributes[LogDrainServiceHeader]
+		}
+		if isEmptyLog(lg) {
+			hmetric.Incr(r.Context(), "http-logs.filtered", []attribute.KeyValue{attribute.Int("project_id", projectID)}, 1)
+			continue
+		}
+		applyTraceContext(&lg)
+		batch.add(projectID, lg)
+	}
+
+	for projectID, count := range received {
+		recordReceived(r.Context(), endpointJSON, projectID, count, receivedBytes[projectID])
+	}
+	errs := batch.submit(r.Context())
+	recordBatchSubmitted(r.Context(), endpointJSON, batch, errs)
+	if err := firstError(errs); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		writeSubmitError(w, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -328,51 +776,138 @@ func HandleJSONLog(w http.ResponseWriter, r *http.Request) {
 func HandleRawLog(w http.ResponseWriter, r *http.Request) {
 	projectID, serviceName, err := getQueryStringParams(r)
 	if err != nil {
-		http.Error(w, "no project query string parameter provided", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrorCodeInvalidProject, "invalid project")
 		return
 	}
 
 	requestBody, err := getBody(r)
 	if err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("invalid http firehose gzip")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
 	body, err := io.ReadAll(requestBody)
 	if err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("invalid http logs body")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
+	body = decodeText(body, r.Header.Get("Content-Type"))
+
+	filterLevels := hasMinLevel(projectID)
+	var logs []hlog.Log
+	for _, message := range splitRawRecords(string(body)) {
+		if filterLevels {
+			if level, ok := peekLogfmtLevel(message); ok && belowMinLevel(projectID, level) {
+				hmetric.Incr(r.Context(), "http-logs.filtered", []attribute.KeyValue{attribute.Int("project_id", projectID)}, 1)
+				continue
+			}
+		}
 
-	lg := hlog.Log{
-		Attributes: map[string]string{},
-		Message:    string(body),
-		Timestamp:  time.Now().UTC().Format(hlog.TimestampFormat),
-		Level:      model.LogLevelInfo.String(),
-	}
+		lg := hlog.Log{
+			Attributes: map[string]string{},
+			Message:    message,
+			Timestamp:  time.Now().UTC().Format(hlog.TimestampFormat),
+			Level:      model.LogLevelInfo.String(),
+		}
 
-	if serviceName != "" {
-		lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, lg)
 	}
-	if err := hlog.SubmitHTTPLog(r.Context(), tracer, projectID, lg); err != nil {
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
 		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), submitErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+var rawRecordSeparator string
+
+// SetRawRecordSeparator splits raw log bodies into one log per record delimited by the separator,
+// such as a `---END---` sentinel line after multi-line exceptions. Passing an empty separator
+// ingests every body as a single log.
+func SetRawRecordSeparator(separator string) {
+	rawRecordSeparator = separator
+}
+
+func splitRawRecords(body string) []string {
+	if rawRecordSeparator == "" {
+		return []string{body}
+	}
+	var records []string
+	for _, record := range strings.Split(body, rawRecordSeparator) {
+		record = strings.Trim(record, "\r\n")
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
 var tracer trace.Tracer
 
 func Listen(r *chi.Mux, t trace.Tracer) {
 	tracer = t
+	// the probes are served without the tls requirement of the ingest routes, since orchestrators
+	// probe instances directly. the root /health is the health check of the backend itself.
+	r.Get("/v1/logs/health", HandleHealth)
+	r.Get("/v1/logs/ready", HandleReady)
 	r.Route("/v1", func(r chi.Router) {
 		r.Use(highlightChi.Middleware)
-		r.HandleFunc("/logs/raw", HandleRawLog)
-		r.HandleFunc("/logs/json", HandleJSONLog)
-		r.HandleFunc("/logs/firehose", HandleFirehoseLog)
+		r.Use(RequireTLSMiddleware)
+		r.Get("/logs/errors", HandleIngestErrors)
+		r.Group(func(r chi.Router) {
+			r.Use(RequestLoggingMiddleware)
+			r.Use(IngestErrorsMiddleware)
+			r.Use(IgnoredUserAgentMiddleware)
+			r.Use(IPRateLimitMiddleware)
+			r.Use(QueryParamsMiddleware)
+			r.Use(HeaderAttributesMiddleware)
+			r.Use(TLSAttributesMiddleware)
+			r.Use(IngestStatsMiddleware)
+			r.Use(MetricsMiddleware)
+			r.HandleFunc("/logs/raw", HandleRawLog)
+			r.HandleFunc("/logs/json", HandleJSONLog)
+			r.HandleFunc("/logs/firehose", HandleFirehoseLog)
+			r.HandleFunc("/logs/journald", HandleJournaldLog)
+			r.HandleFunc("/logs/klog", HandleKlog)
+			r.HandleFunc("/logs/syslog", HandleSyslog)
+			r.HandleFunc("/logs/github-actions", HandleActionsLog)
+			r.HandleFunc("/logs/logtail", HandleLogtail)
+			r.HandleFunc("/logs/ws", HandleWebSocketLog)
+			r.HandleFunc("/logs/influx", HandleLineProtocol)
+			r.HandleFunc("/logs/sumo", HandleSumoLogic)
+			r.HandleFunc("/logs/sumo/{token}", HandleSumoLogic)
+			r.HandleFunc("/logs/gcp", HandleGCPLog)
+			r.HandleFunc("/logs/lambda", HandleLambdaTelemetry)
+			r.HandleFunc("/logs/azure", HandleAzureLog)
+			r.HandleFunc("/logs/fluentbit", HandleFluentBit)
+			r.HandleFunc("/logs/cloudflare", HandleCloudflareWorkers)
+			r.HandleFunc("/logs/_bulk", HandleElasticsearchBulk)
+			r.HandleFunc("/logs/{index}/_bulk", HandleElasticsearchBulk)
+			r.HandleFunc("/logs/{index}/_doc", HandleElasticsearchDoc)
+		})
+	})
+	r.Handle("/metrics", MetricsHandler())
+	// loki clients only allow configuring the host, so the push api is served at its usual path
+	r.Route("/loki/api/v1", func(r chi.Router) {
+		r.Use(highlightChi.Middleware)
+		r.Use(RequireTLSMiddleware)
+		r.Use(RequestLoggingMiddleware)
+		r.Use(IngestErrorsMiddleware)
+		r.Use(IgnoredUserAgentMiddleware)
+		r.Use(IPRateLimitMiddleware)
+		r.Use(QueryParamsMiddleware)
+		r.Use(HeaderAttributesMiddleware)
+		r.Use(TLSAttributesMiddleware)
+		r.Use(IngestStatsMiddleware)
+		r.Use(MetricsMiddleware)
+		r.Post("/push", HandleLokiPush)
 	})
 }
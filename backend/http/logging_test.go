@@ -3,13 +3,24 @@ package http
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
 )
 
 const PinoBatchJson = `{"logs":[{"level":30,"time":1691719960798,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","msg":"generating sitemap"},{"level":30,"time":1691719961378,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","msg":"got remote data"},{"level":30,"time":1691719961379,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","numPages":91,"msg":"build pages"},{"level":30,"time":1691719965738,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","msg":"generating sitemap"},{"level":30,"time":1691719966256,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","msg":"got remote data"},{"level":30,"time":1691719966256,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","numPages":91,"msg":"build pages"},{"level":30,"time":1691719967152,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","msg":"generating sitemap"},{"level":30,"time":1691719967401,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","msg":"got remote data"},{"level":30,"time":1691719967402,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","numPages":91,"msg":"build pages"},{"level":30,"time":1691719967927,"pid":47069,"hostname":"Vadims-MacBook-Pro.local","msg":"generating sitemap"}]}`
@@ -61,6 +72,98 @@ func TestHandleFlyJSONLog(t *testing.T) {
 	assert.Equal(t, 200, w.statusCode)
 }
 
+func TestHandleNDJSONLog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	body := "{\"message\":\"first\",\"user\":{\"id\":1}}\r\n\n  \n{\"message\":\"second\",\"level\":\"warn\"}\n{\"message\":\"cut o"
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		assert.Equal(t, "first", (*submitted)[0].log.Message)
+		assert.Equal(t, "1", (*submitted)[0].log.Attributes["user.id"])
+		assert.Equal(t, "second", (*submitted)[1].log.Message)
+		assert.Equal(t, "warn", (*submitted)[1].log.Level)
+	}
+
+	// several top-level values are split even without the ndjson content type
+	*submitted = nil
+	r, _ = http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"a","n":1} {"message":"b","n":2}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w = httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 2, len(*submitted)) {
+		assert.Equal(t, "a", (*submitted)[0].log.Message)
+		assert.Equal(t, "2", (*submitted)[1].log.Attributes["n"])
+	}
+
+	// a single invalid document is still rejected
+	r, _ = http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"a"} {"message":`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w = httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestHandleJSONLogServicePrecedence(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	body := `{"message":"own","service.name":"worker"}` + "\n" + `{"message":"defaulted"}`
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	r.Header.Set(LogDrainServiceHeader, "checkout")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		// the service of the payload takes precedence over the header
+		assert.Equal(t, "worker", (*submitted)[0].log.Attributes["service.name"])
+		assert.Equal(t, "checkout", (*submitted)[1].log.Attributes["service.name"])
+	}
+}
+
+func TestHandleJSONLogDecodeField(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetDecodeField("payload")
+	defer SetDecodeField("")
+
+	payload := base64.StdEncoding.EncodeToString(compress(t, "gzip", `{"message":"order placed","level":"warn","order":{"id":"42"},"tenant":"payload"}`))
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(fmt.Sprintf(`{"payload":"%s","tenant":"acme"}`, payload)))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 1, len(*submitted)) {
+		lg := (*submitted)[0].log
+		assert.Equal(t, "order placed", lg.Message)
+		assert.Equal(t, "warn", lg.Level)
+		assert.Equal(t, "42", lg.Attributes["order.id"])
+		assert.Equal(t, "acme", lg.Attributes["tenant"])
+		assert.NotContains(t, lg.Attributes, "payload")
+	}
+
+	// a field that can not be decoded is kept as is
+	*submitted = nil
+	r, _ = http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello","payload":"not base64!"}`))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w = httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "not base64!", (*submitted)[0].log.Attributes["payload"])
+	}
+}
+
 func TestHandlePinoBatchJson(t *testing.T) {
 	r, _ := http.NewRequest("POST", "/v1/logs/json?project=1", strings.NewReader(PinoBatchJson))
 	r.Header.Set("Content-Type", "application/json")
@@ -69,6 +172,41 @@ func TestHandlePinoBatchJson(t *testing.T) {
 	assert.Equal(t, 200, w.statusCode)
 }
 
+func TestHandleJSONLogPino(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	for _, tc := range []struct {
+		level    int
+		expected string
+	}{
+		{10, "trace"},
+		{20, "debug"},
+		{30, "info"},
+		{40, "warn"},
+		{50, "error"},
+		{60, "fatal"},
+	} {
+		*submitted = nil
+		body := fmt.Sprintf(`{"level":%d,"time":1700000000123,"pid":47069,"hostname":"web-1","msg":"generating sitemap"}`, tc.level)
+		r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+		r.Header.Set(LogDrainProjectHeader, "1")
+		w := httptest.NewRecorder()
+		HandleJSONLog(w, r)
+		assert.Equal(t, 200, w.Code)
+
+		if assert.Equal(t, 1, len(*submitted)) {
+			lg := (*submitted)[0].log
+			assert.Equal(t, tc.expected, lg.Level, tc.level)
+			assert.Equal(t, "generating sitemap", lg.Message)
+			assert.Equal(t, "2023-11-14T22:13:20.123Z", lg.Timestamp)
+			assert.Equal(t, "47069", lg.Attributes["pid"])
+			assert.Equal(t, "web-1", lg.Attributes["hostname"])
+			assert.NotContains(t, lg.Attributes, "level")
+			assert.NotContains(t, lg.Attributes, "time")
+		}
+	}
+}
+
 func TestHandleFlyJSONGZIPLog(t *testing.T) {
 	b := bytes.Buffer{}
 	gz := gzip.NewWriter(&b)
@@ -87,3 +225,460 @@ func TestHandleFlyJSONGZIPLog(t *testing.T) {
 	HandleJSONLog(w, r)
 	assert.Equal(t, 200, w.statusCode)
 }
+
+const EMFDocument = `{"_aws":{"Timestamp":1574109732004,"CloudWatchMetrics":[{"Namespace":"lambda-function-metrics","Dimensions":[["functionVersion"]],"Metrics":[{"Name":"time","Unit":"Milliseconds"}]}]},"functionVersion":"$LATEST","time":100,"requestId":"989ffbf8-9ace-4817-a57c-e4dd734019ee","message":"request handled"}`
+
+func newFirehoseRequest(records ...string) *http.Request {
+	var data []string
+	for _, record := range records {
+		data = append(data, fmt.Sprintf(`{"data":"%s"}`, base64.StdEncoding.EncodeToString([]byte(record))))
+	}
+	body := fmt.Sprintf(`{"requestId":"ed4acda5-034f-9f42-bba1-f29aea6d7d8f","timestamp":1578090901599,"records":[%s]}`, strings.Join(data, ","))
+	r, _ := http.NewRequest("POST", "/v1/logs/firehose", strings.NewReader(body))
+	r.Header.Set("X-Amz-Firehose-Common-Attributes", `{"commonAttributes":{"x-highlight-project":"1"}}`)
+	return r
+}
+
+const ASFFEvent = `{"version":"0","id":"8e5622f9-d81c-4d81-612a-9319e7ee2506","detail-type":"Security Hub Findings - Imported","source":"aws.securityhub","account":"123456789012","time":"2023-08-11T02:52:40Z","region":"us-east-1","resources":["arn:aws:securityhub:us-east-1::product/aws/securityhub/arn:aws:securityhub:us-east-1:123456789012:subscription/aws-foundational-security-best-practices/v/1.0.0/S3.8/finding/0d9d3c1f"],"detail":{"findings":[{"SchemaVersion":"2018-10-08","Id":"arn:aws:securityhub:us-east-1:123456789012:subscription/aws-foundational-security-best-practices/v/1.0.0/S3.8/finding/0d9d3c1f","ProductArn":"arn:aws:securityhub:us-east-1::product/aws/securityhub","GeneratorId":"aws-foundational-security-best-practices/v/1.0.0/S3.8","AwsAccountId":"123456789012","Region":"us-east-1","Types":["Software and Configuration Checks/Industry and Regulatory Standards/AWS-Foundational-Security-Best-Practices"],"FirstObservedAt":"2023-08-10T18:01:44.000Z","CreatedAt":"2023-08-10T18:01:44.127Z","UpdatedAt":"2023-08-11T02:52:20.614Z","Severity":{"Product":70,"Label":"HIGH","Normalized":70,"Original":"HIGH"},"Title":"S3.8 S3 Block Public Access setting should be enabled at the bucket-level","Description":"This control checks whether S3 buckets have bucket-level public access blocks applied.","Resources":[{"Type":"AwsS3Bucket","Id":"arn:aws:s3:::example-logs-bucket","Partition":"aws","Region":"us-east-1","Details":{"AwsS3Bucket":{"Owner":"a1b2c3"}}}],"Compliance":{"Status":"FAILED"},"WorkflowState":"NEW","Workflow":{"Status":"NEW"},"RecordState":"ACTIVE"}]}}`
+
+func TestHandleFirehoseASFFLog(t *testing.T) {
+	submitted := captureSubmits(t)
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(ASFFEvent))
+	assert.Equal(t, 200, w.Code)
+
+	assert.Equal(t, 1, len(*submitted))
+	lg := (*submitted)[0].log
+	assert.Equal(t, "S3.8 S3 Block Public Access setting should be enabled at the bucket-level\nThis control checks whether S3 buckets have bucket-level public access blocks applied.", lg.Message)
+	assert.Equal(t, "error", lg.Level)
+	assert.Equal(t, "2023-08-10T18:01:44.127Z", lg.Timestamp)
+	assert.Equal(t, "security-hub", lg.Attributes["service.name"])
+	assert.Equal(t, "123456789012", lg.Attributes["cloud.account.id"])
+	assert.Equal(t, "us-east-1", lg.Attributes["cloud.region"])
+	assert.Equal(t, "HIGH", lg.Attributes["asff.severity"])
+	assert.Equal(t, "FAILED", lg.Attributes["asff.compliance_status"])
+	assert.Equal(t, "AwsS3Bucket", lg.Attributes["asff.resources.0.type"])
+	assert.Equal(t, "arn:aws:s3:::example-logs-bucket", lg.Attributes["asff.resources.0.id"])
+}
+
+func TestHandleFirehoseLogPartialFailure(t *testing.T) {
+	submitted := captureSubmits(t)
+	submitHTTPLogs = func(_ context.Context, _ trace.Tracer, projectID int, logs []hlog.Log) []error {
+		errs := make([]error, len(logs))
+		for idx, lg := range logs {
+			if lg.Message == "bad" {
+				errs[idx] = errors.New("bad log")
+				continue
+			}
+			*submitted = append(*submitted, submittedLog{projectID: projectID, log: lg})
+		}
+		return errs
+	}
+
+	encode := func(record string) string {
+		return base64.StdEncoding.EncodeToString([]byte(record))
+	}
+	body := fmt.Sprintf(`{"requestId":"ed4acda5-034f-9f42-bba1-f29aea6d7d8f","timestamp":1578090901599,"records":[{"data":"%s"},{"data":"not base64!"},{"data":"%s"},{"data":"%s"}]}`,
+		encode("first"), encode("bad"), encode("last"))
+	r, _ := http.NewRequest("POST", "/v1/logs/firehose", strings.NewReader(body))
+	r.Header.Set("X-Amz-Firehose-Common-Attributes", `{"commonAttributes":{"x-highlight-project":"1"}}`)
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, r)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+
+	var response struct {
+		RequestId string
+		Timestamp int64
+		Failed    []firehoseRecordError
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "ed4acda5-034f-9f42-bba1-f29aea6d7d8f", response.RequestId)
+	assert.NotZero(t, response.Timestamp)
+	if assert.Equal(t, 2, len(response.Failed)) {
+		assert.Equal(t, 1, response.Failed[0].Index)
+		assert.Contains(t, response.Failed[0].Error, "illegal base64")
+		assert.Equal(t, firehoseRecordError{Index: 2, Error: "bad log"}, response.Failed[1])
+	}
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		assert.Equal(t, "first", (*submitted)[0].log.Message)
+		assert.Equal(t, "last", (*submitted)[1].log.Message)
+	}
+}
+
+func TestHandleFirehoseCloudWatchLog(t *testing.T) {
+	submitted := captureSubmits(t)
+	cloudwatch := `{"messageType":"DATA_MESSAGE","owner":"123456789012","logGroup":"/aws/lambda/checkout","logStream":"2023/10/11/[$LATEST]abc","subscriptionFilters":["highlight"],"logEvents":[{"id":"37564929584746398261237654523019763722410087946581917696","timestamp":1697062455123,"message":"order placed"},{"id":"37564929584746398261237654523019763722410087946581917697","timestamp":1697062456000,"message":"order shipped"}]}`
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(cloudwatch, "raw record"))
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 3, len(*submitted)) {
+		first := (*submitted)[0].log
+		assert.Equal(t, "order placed", first.Message)
+		assert.Equal(t, "2023-10-11T22:14:15.123Z", first.Timestamp)
+		assert.Equal(t, "/aws/lambda/checkout", first.Attributes["log_group"])
+		assert.Equal(t, "37564929584746398261237654523019763722410087946581917696", first.Attributes[CloudWatchEventIDAttribute])
+		assert.Equal(t, "37564929584746398261237654523019763722410087946581917697", (*submitted)[1].log.Attributes[CloudWatchEventIDAttribute])
+
+		raw := (*submitted)[2].log
+		assert.Equal(t, "raw record", raw.Message)
+		assert.NotContains(t, raw.Attributes, CloudWatchEventIDAttribute)
+		for _, s := range *submitted {
+			assert.Equal(t, "ed4acda5-034f-9f42-bba1-f29aea6d7d8f", s.log.Attributes[FirehoseRequestIDAttribute])
+		}
+	}
+}
+
+func TestHandleFirehoseLogServiceName(t *testing.T) {
+	submitted := captureSubmits(t)
+	cloudwatch := `{"messageType":"DATA_MESSAGE","logGroup":"/aws/lambda/checkout","logStream":"stream","logEvents":[{"id":"1","timestamp":1697062455123,"message":"order placed"}]}`
+	noGroup := `{"messageType":"DATA_MESSAGE","logEvents":[{"id":"2","timestamp":1697062455123,"message":"no group"}]}`
+
+	// cloudwatch events fall back to their log group, then to firehose
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(cloudwatch, noGroup, "raw record"))
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 3, len(*submitted)) {
+		assert.Equal(t, "/aws/lambda/checkout", (*submitted)[0].log.Attributes["service.name"])
+		assert.Equal(t, "firehose", (*submitted)[1].log.Attributes["service.name"])
+		assert.NotContains(t, (*submitted)[2].log.Attributes, "service.name")
+	}
+
+	// the service header applies to every record
+	*submitted = nil
+	r := newFirehoseRequest(cloudwatch, "raw record")
+	r.Header.Set(LogDrainServiceHeader, "payments")
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, r)
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 2, len(*submitted)) {
+		assert.Equal(t, "payments", (*submitted)[0].log.Attributes["service.name"])
+		assert.Equal(t, "payments", (*submitted)[1].log.Attributes["service.name"])
+	}
+
+	// as do the common attributes of the delivery stream, since firehose can not set other headers
+	*submitted = nil
+	r = newFirehoseRequest(cloudwatch)
+	r.Header.Set("X-Amz-Firehose-Common-Attributes", `{"commonAttributes":{"x-highlight-project":"1","x-highlight-service":"orders"}}`)
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, r)
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "orders", (*submitted)[0].log.Attributes["service.name"])
+	}
+}
+
+func TestHandleFirehoseEMFLog(t *testing.T) {
+	submitted := captureSubmits(t)
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(EMFDocument))
+	assert.Equal(t, 200, w.Code)
+
+	assert.Equal(t, 1, len(*submitted))
+	lg := (*submitted)[0].log
+	assert.Equal(t, "request handled", lg.Message)
+	assert.Equal(t, "2019-11-18T20:42:12.004Z", lg.Timestamp)
+	assert.Equal(t, "lambda-function-metrics", lg.Attributes["emf.namespace"])
+	assert.Equal(t, "$LATEST", lg.Attributes["functionVersion"])
+	assert.Equal(t, "100", lg.Attributes["time"])
+	assert.NotContains(t, lg.Attributes, "_aws")
+}
+
+func TestHandleJSONLogObjectMessage(t *testing.T) {
+	submitted := captureSubmits(t)
+	defer SetObjectMessageMode(ObjectMessageStringify)
+
+	send := func() string {
+		r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":{"text":"user signed in","user":42},"level":"warn"}`))
+		r.Header.Set(LogDrainProjectHeader, "1")
+		w := httptest.NewRecorder()
+		HandleJSONLog(w, r)
+		assert.Equal(t, 200, w.Code)
+		lg := (*submitted)[len(*submitted)-1].log
+		assert.Equal(t, "warn", lg.Level)
+		return lg.Message
+	}
+
+	assert.Equal(t, `{"text":"user signed in","user":42}`, send())
+
+	SetObjectMessageMode(ObjectMessageExtract)
+	assert.Equal(t, "user signed in", send())
+}
+
+const CaddyAccessLogJson = `{"level":"info","ts":1646861401.5241024,"logger":"http.log.access.log0","msg":"handled request","request":{"remote_ip":"127.0.0.1","remote_port":"41342","proto":"HTTP/2.0","method":"GET","host":"localhost","uri":"/missing","headers":{"User-Agent":["curl/7.82.0"],"Accept":["*/*"]},"tls":{"resumed":false,"version":772,"cipher_suite":4865,"proto":"h2","server_name":"example.com"}},"user_id":"","duration":0.000929675,"size":10900,"status":404,"resp_headers":{"Server":["Caddy"],"Content-Type":["text/html; charset=utf-8"]}}`
+
+func TestHandleJSONLogCaddyAccessLog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(CaddyAccessLogJson))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	assert.Equal(t, 1, len(*submitted))
+	lg := (*submitted)[0].log
+	assert.Equal(t, "handled request", lg.Message)
+	assert.True(t, strings.HasPrefix(lg.Timestamp, "2022-03-09T21:30:01.524"), lg.Timestamp)
+	// caddy logs the 404 at info, the level is derived from the status instead
+	assert.Equal(t, "warn", lg.Level)
+	assert.Equal(t, "GET", lg.Attributes["request.method"])
+	assert.Equal(t, "/missing", lg.Attributes["request.uri"])
+	assert.Equal(t, "example.com", lg.Attributes["request.tls.server_name"])
+	assert.Equal(t, "404", lg.Attributes["status"])
+	assert.Equal(t, "0.000929675", lg.Attributes["duration"])
+	assert.NotContains(t, lg.Attributes, "msg")
+	assert.NotContains(t, lg.Attributes, "ts")
+}
+
+func TestHandleJSONLogZapProduction(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	body := `{"level":"info","ts":1700000000.123,"caller":"server/main.go:42","msg":"listening","port":8080}
+{"level":"warn","ts":1700000001.5,"caller":"pkg/file.go:42","msg":"request failed","error":"connection reset","stacktrace":"main.handle\n\t/app/pkg/file.go:42\nmain.main\n\t/app/main.go:12"}`
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		lg := (*submitted)[0].log
+		assert.Equal(t, "listening", lg.Message)
+		assert.Equal(t, "info", lg.Level)
+		assert.True(t, strings.HasPrefix(lg.Timestamp, "2023-11-14T22:13:20.12"), lg.Timestamp)
+		assert.Equal(t, "server/main.go:42", lg.Attributes["caller"])
+		assert.Equal(t, "8080", lg.Attributes["port"])
+		assert.NotContains(t, lg.Attributes, string(semconv.ExceptionStacktraceKey))
+
+		// the stacktrace elevates the log to an error
+		lg = (*submitted)[1].log
+		assert.Equal(t, "request failed", lg.Message)
+		assert.Equal(t, "error", lg.Level)
+		assert.True(t, strings.HasPrefix(lg.Timestamp, "2023-11-14T22:13:21.5"), lg.Timestamp)
+		assert.Equal(t, "pkg/file.go:42", lg.Attributes["caller"])
+		assert.Equal(t, "main.handle\n\t/app/pkg/file.go:42\nmain.main\n\t/app/main.go:12", lg.Attributes[string(semconv.ExceptionStacktraceKey)])
+		assert.NotContains(t, lg.Attributes, "stacktrace")
+		assert.NotContains(t, lg.Attributes, "msg")
+		assert.NotContains(t, lg.Attributes, "ts")
+	}
+}
+
+func TestHandleJSONLogBodyProject(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetBodyProjectField("highlight_project")
+	defer SetBodyProjectField("")
+
+	body := `{"message":"first","highlight_project":"1"}
+{"message":"second","highlight_project":"2"}
+{"message":"third","highlight_project":"1"}
+`
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	projects := map[string]int{}
+	for _, s := range *submitted {
+		projects[s.log.Message] = s.projectID
+		assert.NotContains(t, s.log.Attributes, "highlight_project")
+	}
+	assert.Equal(t, map[string]int{"first": 1, "second": 2, "third": 1}, projects)
+
+	r, _ = http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"no project"}`))
+	w = httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestHandleRawLogRecordSeparator(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetRawRecordSeparator("---END---")
+	defer SetRawRecordSeparator("")
+
+	body := "java.lang.IllegalStateException: boom\n\tat com.example.Main.run(Main.java:42)\n\tat com.example.Main.main(Main.java:7)\n---END---\n" +
+		"request handled\n---END---\n" +
+		"second exception\n\tat com.example.Other.run(Other.java:1)\n---END---\n"
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader(body))
+	w := httptest.NewRecorder()
+	HandleRawLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	assert.Equal(t, 3, len(*submitted))
+	assert.Equal(t, "java.lang.IllegalStateException: boom\n\tat com.example.Main.run(Main.java:42)\n\tat com.example.Main.main(Main.java:7)", (*submitted)[0].log.Message)
+	assert.Equal(t, "request handled", (*submitted)[1].log.Message)
+}
+
+func TestHandleRawLogGzipMultistream(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetRawRecordSeparator("\n")
+	defer SetRawRecordSeparator("")
+
+	// an archive appended to with `gzip -c >> app.log.gz` is a concatenation of gzip members
+	var body bytes.Buffer
+	for _, chunk := range []string{"first line\nsecond line\n", "third line\nfourth line\n"} {
+		gz := gzip.NewWriter(&body)
+		_, err := gz.Write([]byte(chunk))
+		assert.NoError(t, err)
+		assert.NoError(t, gz.Close())
+	}
+
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), &body)
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	HandleRawLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	assert.Equal(t, 4, len(*submitted))
+	for i, msg := range []string{"first line", "second line", "third line", "fourth line"} {
+		assert.Equal(t, msg, (*submitted)[i].log.Message)
+	}
+}
+
+func TestHandleFirehoseAsync(t *testing.T) {
+	release := make(chan struct{})
+	submitted := make(chan hlog.Log, 1)
+	submitHTTPLogs = func(_ context.Context, _ trace.Tracer, _ int, logs []hlog.Log) []error {
+		<-release
+		for _, lg := range logs {
+			submitted <- lg
+		}
+		return nil
+	}
+	defer func() { submitHTTPLogs = submitHTTPLogBatch }()
+	SetFirehoseAsync(1, 1)
+	defer SetFirehoseAsync(0, 0)
+
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(EMFDocument))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "requestId")
+
+	select {
+	case <-submitted:
+		t.Fatal("firehose request was acked after its logs were submitted")
+	default:
+	}
+
+	close(release)
+	select {
+	case lg := <-submitted:
+		assert.Equal(t, "request handled", lg.Message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("firehose logs were not submitted in the background")
+	}
+}
+
+func TestHandleFirehoseAsyncPausedProject(t *testing.T) {
+	submitted := captureSubmits(t)
+	gate := NewMemoryIngestGate()
+	gate.Pause(1, "over quota")
+	SetIngestGate(gate)
+	defer SetIngestGate(nil)
+	SetFirehoseAsync(1, 1)
+	defer SetFirehoseAsync(0, 0)
+
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(EMFDocument))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, *submitted)
+}
+
+func TestHandleFirehoseAsyncReconfigureDrains(t *testing.T) {
+	release := make(chan struct{})
+	submitted := make(chan hlog.Log, 2)
+	submitHTTPLogs = func(_ context.Context, _ trace.Tracer, _ int, logs []hlog.Log) []error {
+		<-release
+		for _, lg := range logs {
+			submitted <- lg
+		}
+		return nil
+	}
+	defer func() { submitHTTPLogs = submitHTTPLogBatch }()
+	SetFirehoseAsync(1, 1)
+	defer SetFirehoseAsync(0, 0)
+
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(EMFDocument))
+	assert.Equal(t, 200, w.Code)
+
+	// the request buffered on the previous queue is still submitted
+	SetFirehoseAsync(1, 1)
+	close(release)
+	select {
+	case lg := <-submitted:
+		assert.Equal(t, "request handled", lg.Message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("firehose logs buffered before reconfiguring were not submitted")
+	}
+}
+
+// BenchmarkHandleFirehoseLog reports the spans exported for a firehose request of 10k cloudwatch
+// events, which are submitted as the events of as few spans as possible rather than a span each.
+func BenchmarkHandleFirehoseLog(b *testing.B) {
+	events := make([]string, 10_000)
+	for idx := range events {
+		events[idx] = fmt.Sprintf(`{"id":"%d","timestamp":1691722360000,"message":"event %d"}`, idx, idx)
+	}
+	cloudwatch := fmt.Sprintf(`{"messageType":"DATA_MESSAGE","logGroup":"/aws/lambda/checkout","logStream":"stream","logEvents":[%s]}`, strings.Join(events, ","))
+	body, _ := io.ReadAll(newFirehoseRequest(cloudwatch).Body)
+
+	recording := &recordingTracer{}
+	previous := tracer
+	tracer = recording
+	defer func() { tracer = previous }()
+
+	var spans int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, _ := http.NewRequest("POST", "/v1/logs/firehose", bytes.NewReader(body))
+		r.Header.Set("X-Amz-Firehose-Common-Attributes", `{"commonAttributes":{"x-highlight-project":"1"}}`)
+		w := httptest.NewRecorder()
+		HandleFirehoseLog(w, r)
+		if w.Code != http.StatusOK {
+			b.Fatal(w.Body.String())
+		}
+		spans += len(recording.spans)
+		recording.spans = nil
+	}
+	b.ReportMetric(float64(spans)/float64(b.N), "spans/op")
+}
+
+func TestDropEmptyMessages(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"  "}
+{"level":"info"}
+{"message":"","user":{"id":42}}`))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+	// an empty message with attributes of its own is kept
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "42", (*submitted)[0].log.Attributes["user.id"])
+	}
+
+	*submitted = nil
+	cloudwatch := `{"messageType":"DATA_MESSAGE","logGroup":"/aws/lambda/checkout","logStream":"stream","logEvents":[{"id":"1","timestamp":1697062455123,"message":" \n"},{"id":"2","timestamp":1697062455124,"message":"order placed"}]}`
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(cloudwatch))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"skipped":1`)
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "order placed", (*submitted)[0].log.Message)
+	}
+
+	SetDropEmptyMessages(false)
+	defer SetDropEmptyMessages(true)
+	*submitted = nil
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(cloudwatch))
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "skipped")
+	assert.Equal(t, 2, len(*submitted))
+}
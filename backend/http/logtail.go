@@ -0,0 +1,147 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// TokenResolver resolves a bearer source token to a highlight project id.
+type TokenResolver interface {
+	ResolveToken(ctx context.Context, token string) (int, error)
+}
+
+// verboseIDTokenResolver treats the source token as the project verbose id.
+type verboseIDTokenResolver struct{}
+
+func (verboseIDTokenResolver) ResolveToken(_ context.Context, token string) (int, error) {
+	return parseProjectID(token)
+}
+
+var tokenResolver TokenResolver = verboseIDTokenResolver{}
+
+func SetTokenResolver(resolver TokenResolver) {
+	tokenResolver = resolver
+}
+
+func getBearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// getLogtailRecords splits a Logtail request body that is either a single json object,
+// a json array of objects, or newline delimited json objects.
+func getLogtailRecords(body []byte) ([]map[string]interface{}, error) {
+	body = bytes.TrimSpace(body)
+	var records []map[string]interface{}
+	if bytes.HasPrefix(body, []byte("[")) {
+		if err := json.Unmarshal(body, &records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parseLogtailRecord(ctx context.Context, record map[string]interface{}) hlog.Log {
+	lg := hlog.Log{
+		Attributes: make(map[string]string),
+		Timestamp:  time.Now().UTC().Format(hlog.TimestampFormat),
+		Level:      model.LogLevelInfo.String(),
+	}
+	if msg, ok := record["message"].(string); ok {
+		lg.Message = msg
+	}
+	if ts, ok := parseTimestamp(record["dt"]); ok {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+	}
+	if level, ok := record["level"].(string); ok {
+		if l := normalizeLevel(level); l != "" {
+			lg.Level = l
+		}
+	}
+	for k, v := range record {
+		if has := map[string]bool{"message": true, "dt": true, "level": true}[k]; has {
+			continue
+		}
+		for key, value := range formatAttributes(ctx, k, v) {
+			lg.Attributes[key] = value
+		}
+	}
+	return lg
+}
+
+// HandleLogtail ingests logs sent by Better Stack / Logtail clients, authenticated by a bearer source token.
+func HandleLogtail(w http.ResponseWriter, r *http.Request) {
+	token := getBearerToken(r)
+	if token == "" {
+		auditAuthFailure(r, token, "missing source token")
+		http.Error(w, "missing bearer source token", http.StatusUnauthorized)
+		return
+	}
+	projectID, err := tokenResolver.ResolveToken(r.Context(), token)
+	if err == nil {
+		projectID, err = validateProjectID(projectID)
+	}
+	if err != nil {
+		auditAuthFailure(r, token, "invalid source token")
+		log.WithContext(r.Context()).WithError(err).Error("failed to resolve highlight project from logtail source token")
+		writeError(w, http.StatusUnauthorized, ErrorCodeInvalidProject, "invalid source token")
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http logtail gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http logtail body")
+		writeBodyError(w, err)
+		return
+	}
+
+	records, err := getLogtailRecords(body)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http logtail json")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logs := make([]hlog.Log, 0, len(records))
+	for _, record := range records {
+		logs = append(logs, parseLogtailRecord(r.Context(), record))
+	}
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
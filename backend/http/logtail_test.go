@@ -0,0 +1,48 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockTokenResolver map[string]int
+
+func (m mockTokenResolver) ResolveToken(_ context.Context, token string) (int, error) {
+	if projectID, ok := m[token]; ok {
+		return projectID, nil
+	}
+	return 0, errors.New("unknown token")
+}
+
+func TestHandleLogtail(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetTokenResolver(mockTokenResolver{"source-token-abc": 7})
+	defer SetTokenResolver(verboseIDTokenResolver{})
+
+	body := `[{"dt":"2023-10-11T22:14:15.123Z","level":"warning","message":"disk almost full","context":{"host":"db-1"}},{"dt":1697062456,"message":"ok"}]`
+	r, _ := http.NewRequest("POST", "/v1/logs/logtail", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer source-token-abc")
+	w := httptest.NewRecorder()
+	HandleLogtail(w, r)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, 2, len(*submitted))
+	assert.Equal(t, 7, (*submitted)[0].projectID)
+	assert.Equal(t, "disk almost full", (*submitted)[0].log.Message)
+	assert.Equal(t, "warn", (*submitted)[0].log.Level)
+	assert.Equal(t, "2023-10-11T22:14:15.123Z", (*submitted)[0].log.Timestamp)
+	assert.Equal(t, "db-1", (*submitted)[0].log.Attributes["context.host"])
+	assert.Equal(t, "2023-10-11T22:14:16Z", (*submitted)[1].log.Timestamp)
+
+	r, _ = http.NewRequest("POST", "/v1/logs/logtail", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer wrong-token")
+	w = httptest.NewRecorder()
+	HandleLogtail(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,381 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// LokiTenantHeader is set by promtail and other loki clients from their `tenant_id`,
+// so it is used as the highlight project when no project header is sent.
+const LokiTenantHeader = "X-Scope-OrgID"
+
+// lokiServiceLabel is the label grafana uses for the service of a stream.
+const lokiServiceLabel = "service_name"
+
+type lokiEntry struct {
+	timestamp time.Time
+	line      string
+	metadata  map[string]string
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+func isLabelNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// parseLokiLabels parses the serialized label set of a stream, e.g. `{app="x", env="prod"}`.
+// Values are go quoted strings, so they may contain escaped quotes, backslashes and newlines.
+func parseLokiLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	rest := strings.TrimSpace(s)
+	if !strings.HasPrefix(rest, "{") {
+		return nil, fmt.Errorf("invalid loki labels %q: missing opening brace", s)
+	}
+	rest = strings.TrimSpace(rest[1:])
+	for !strings.HasPrefix(rest, "}") {
+		end := 0
+		for end < len(rest) && isLabelNameChar(rest[end], end == 0) {
+			end++
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("invalid loki labels %q: expected a label name", s)
+		}
+		name := rest[:end]
+		rest = strings.TrimSpace(rest[end:])
+		if !strings.HasPrefix(rest, "=") {
+			return nil, fmt.Errorf("invalid loki labels %q: expected '=' after %s", s, name)
+		}
+		rest = strings.TrimSpace(rest[1:])
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, fmt.Errorf("invalid loki labels %q: expected a quoted value for %s", s, name)
+		}
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid loki labels %q: %w", s, err)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid loki labels %q: %w", s, err)
+		}
+		labels[name] = value
+		rest = strings.TrimSpace(rest[len(quoted):])
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "}") {
+			return nil, fmt.Errorf("invalid loki labels %q: expected ',' or '}' after %s", s, name)
+		}
+	}
+	if rest != "}" {
+		return nil, fmt.Errorf("invalid loki labels %q: unexpected data after closing brace", s)
+	}
+	return labels, nil
+}
+
+// walkProto calls field for each field of a protobuf message. field returns the length of the
+// field value it consumed.
+func walkProto(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func skipProtoField(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+	return protowire.ConsumeFieldValue(num, typ, b), nil
+}
+
+// decodeLokiTimestamp decodes a google.protobuf.Timestamp.
+func decodeLokiTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos uint64
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.VarintType || (num != 1 && num != 2) {
+			return skipProtoField(num, typ, b)
+		}
+		v, n := protowire.ConsumeVarint(b)
+		if num == 1 {
+			seconds = v
+		} else {
+			nanos = v
+		}
+		return n, nil
+	})
+	return time.Unix(int64(seconds), int64(int32(nanos))).UTC(), err
+}
+
+// decodeLokiLabelPair decodes the name and value of a structured metadata label.
+func decodeLokiLabelPair(b []byte) (string, string, error) {
+	var name, value string
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType || (num != 1 && num != 2) {
+			return skipProtoField(num, typ, b)
+		}
+		v, n := protowire.ConsumeString(b)
+		if num == 1 {
+			name = v
+		} else {
+			value = v
+		}
+		return n, nil
+	})
+	return name, value, err
+}
+
+func decodeLokiEntry(b []byte) (lokiEntry, error) {
+	entry := lokiEntry{metadata: make(map[string]string)}
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType {
+			return skipProtoField(num, typ, b)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+		var err error
+		switch num {
+		case 1:
+			entry.timestamp, err = decodeLokiTimestamp(v)
+		case 2:
+			entry.line = string(v)
+		case 3:
+			var name, value string
+			if name, value, err = decodeLokiLabelPair(v); err == nil && name != "" {
+				entry.metadata[name] = value
+			}
+		}
+		return n, err
+	})
+	return entry, err
+}
+
+func decodeLokiStream(b []byte) (lokiStream, error) {
+	var stream lokiStream
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType || (num != 1 && num != 2) {
+			return skipProtoField(num, typ, b)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+		var err error
+		if num == 1 {
+			stream.labels, err = parseLokiLabels(string(v))
+		} else {
+			var entry lokiEntry
+			if entry, err = decodeLokiEntry(v); err == nil {
+				stream.entries = append(stream.entries, entry)
+			}
+		}
+		return n, err
+	})
+	return stream, err
+}
+
+// decodeLokiPushRequest decodes a snappy compressed logproto.PushRequest. The decoded length of
+// the snappy block is checked against the max body size before it is allocated.
+func decodeLokiPushRequest(body []byte) ([]lokiStream, error) {
+	length, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(length) > maxBodyBytes {
+		return nil, &http.MaxBytesError{Limit: maxBodyBytes}
+	}
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var streams []lokiStream
+	err = walkProto(decoded, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 || typ != protowire.BytesType {
+			return skipProtoField(num, typ, b)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+		stream, err := decodeLokiStream(v)
+		if err == nil {
+			streams = append(streams, stream)
+		}
+		return n, err
+	})
+	return streams, err
+}
+
+// decodeLokiJSONPush decodes the json form of a push request, where each value is a
+// [timestamp in nanoseconds, line] tuple optionally followed by structured metadata.
+func decodeLokiJSONPush(body []byte) ([]lokiStream, error) {
+	var push struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, err
+	}
+	var streams []lokiStream
+	for _, s := range push.Streams {
+		stream := lokiStream{labels: s.Stream}
+		for _, value := range s.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("invalid loki value: expected a timestamp and a line")
+			}
+			var ts string
+			entry := lokiEntry{metadata: make(map[string]string)}
+			if err := json.Unmarshal(value[0], &ts); err != nil {
+				return nil, err
+			}
+			ns, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			entry.timestamp = time.Unix(0, ns).UTC()
+			if err := json.Unmarshal(value[1], &entry.line); err != nil {
+				return nil, err
+			}
+			if len(value) > 2 {
+				if err := json.Unmarshal(value[2], &entry.metadata); err != nil {
+					return nil, err
+				}
+			}
+			stream.entries = append(stream.entries, entry)
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+func lokiLogs(streams []lokiStream, serviceName string) []hlog.Log {
+	var logs []hlog.Log
+	for _, stream := range streams {
+		for _, entry := range stream.entries {
+			lg := hlog.Log{
+				Attributes: make(map[string]string),
+				Timestamp:  entry.timestamp.Format(hlog.TimestampFormatNano),
+				Message:    entry.line,
+			}
+			for k, v := range stream.labels {
+				lg.Attributes[k] = v
+			}
+			for k, v := range entry.metadata {
+				lg.Attributes[k] = v
+			}
+			if service := lg.Attributes[lokiServiceLabel]; service != "" {
+				lg.Attributes[string(semconv.ServiceNameKey)] = service
+				delete(lg.Attributes, lokiServiceLabel)
+			}
+			// the service_name label takes precedence over the service header
+			if serviceName != "" && lg.Attributes[string(semconv.ServiceNameKey)] == "" {
+				lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+			}
+			for _, key := range []string{"level", "detected_level", "severity"} {
+				if level := normalizeLevel(lg.Attributes[key]); level != "" {
+					lg.Level = level
+					break
+				}
+			}
+			logs = append(logs, lg)
+		}
+	}
+	return logs
+}
+
+func getLokiProjectParams(r *http.Request) (int, string, error) {
+	tenant, err := getHeader(r, LokiTenantHeader)
+	if err != nil {
+		return 0, "", err
+	}
+	if r.Header.Get(LogDrainProjectHeader) != "" || tenant == "" {
+		return getProjectParams(r)
+	}
+	projectID, err := parseProjectID(tenant)
+	if err != nil {
+		auditAuthFailure(r, tenant, "invalid project")
+		log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", tenant).Error("failed to parse highlight project id from loki tenant")
+		return 0, "", err
+	}
+	serviceName, err := getHeader(r, LogDrainServiceHeader)
+	if err != nil {
+		return 0, "", err
+	}
+	return projectID, serviceName, nil
+}
+
+// HandleLokiPush ingests the push requests of promtail, grafana agent and other loki clients,
+// either as snappy compressed protobuf or as json.
+func HandleLokiPush(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getLokiProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http loki gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http loki body")
+		writeBodyError(w, err)
+		return
+	}
+
+	var streams []lokiStream
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		streams, err = decodeLokiJSONPush(body)
+	} else {
+		streams, err = decodeLokiPushRequest(body)
+	}
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http loki push request")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeBodyError(w, err)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, lokiLogs(streams, serviceName))); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestParseLokiLabels(t *testing.T) {
+	for labels, expected := range map[string]map[string]string{
+		`{}`:                      {},
+		`{app="x"}`:               {"app": "x"},
+		`{app="x", env="prod"}`:   {"app": "x", "env": "prod"},
+		` { app = "x" ,env="" } `: {"app": "x", "env": ""},
+		`{msg="say \"hi\"\n"}`:    {"msg": "say \"hi\"\n"},
+		`{path="C:\\logs, {a}"}`:  {"path": `C:\logs, {a}`},
+		`{_private="1",job9="j"}`: {"_private": "1", "job9": "j"},
+		`{unicode="caf\u00e9 ☕"}`: {"unicode": "café ☕"},
+	} {
+		parsed, err := parseLokiLabels(labels)
+		assert.NoError(t, err, labels)
+		assert.Equal(t, expected, parsed, labels)
+	}
+
+	for _, labels := range []string{
+		``,
+		`app="x"`,
+		`{app="x"`,
+		`{app=x}`,
+		`{app="x" env="y"}`,
+		`{9app="x"}`,
+		`{app="unterminated}`,
+		`{app="x"} trailing`,
+	} {
+		_, err := parseLokiLabels(labels)
+		assert.Error(t, err, labels)
+	}
+}
+
+func appendProtoMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func lokiProtoEntry(seconds, nanos uint64, line string, metadata ...[2]string) []byte {
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, seconds)
+	ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, nanos)
+
+	var entry []byte
+	entry = appendProtoMessage(entry, 1, ts)
+	entry = appendProtoMessage(entry, 2, []byte(line))
+	for _, pair := range metadata {
+		var label []byte
+		label = appendProtoMessage(label, 1, []byte(pair[0]))
+		label = appendProtoMessage(label, 2, []byte(pair[1]))
+		entry = appendProtoMessage(entry, 3, label)
+	}
+	return entry
+}
+
+func lokiProtoStream(labels string, entries ...[]byte) []byte {
+	var stream []byte
+	stream = appendProtoMessage(stream, 1, []byte(labels))
+	for _, entry := range entries {
+		stream = appendProtoMessage(stream, 2, entry)
+	}
+	// the stream hash is ignored
+	stream = protowire.AppendTag(stream, 3, protowire.VarintType)
+	return protowire.AppendVarint(stream, 42)
+}
+
+func TestHandleLokiPushProtobuf(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	var push []byte
+	push = appendProtoMessage(push, 1, lokiProtoStream(`{app="checkout", env="prod", service_name="api", note="say \"hi\""}`,
+		lokiProtoEntry(1697062455, 123000000, "order placed"),
+		lokiProtoEntry(1697062456, 0, "payment failed", [2]string{"level", "error"}, [2]string{"trace_id", "abc"}),
+	))
+	push = appendProtoMessage(push, 1, lokiProtoStream(`{job="cron"}`, lokiProtoEntry(1697062457, 0, "job done")))
+
+	r, _ := http.NewRequest("POST", "/loki/api/v1/push", bytes.NewReader(snappy.Encode(nil, push)))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	r.Header.Set(LokiTenantHeader, "1")
+	w := httptest.NewRecorder()
+	HandleLokiPush(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Equal(t, 3, len(*submitted))
+	first := (*submitted)[0]
+	assert.Equal(t, 1, first.projectID)
+	assert.Equal(t, "order placed", first.log.Message)
+	assert.Equal(t, "2023-10-11T22:14:15.123Z", first.log.Timestamp)
+	assert.Equal(t, "checkout", first.log.Attributes["app"])
+	assert.Equal(t, "prod", first.log.Attributes["env"])
+	assert.Equal(t, `say "hi"`, first.log.Attributes["note"])
+	assert.Equal(t, "api", first.log.Attributes["service.name"])
+	assert.NotContains(t, first.log.Attributes, "service_name")
+
+	second := (*submitted)[1].log
+	assert.Equal(t, "payment failed", second.Message)
+	assert.Equal(t, "error", second.Level)
+	assert.Equal(t, "abc", second.Attributes["trace_id"])
+	assert.Equal(t, "checkout", second.Attributes["app"])
+
+	third := (*submitted)[2].log
+	assert.Equal(t, "job done", third.Message)
+	assert.Equal(t, "cron", third.Attributes["job"])
+	assert.NotContains(t, third.Attributes, "app")
+}
+
+func TestHandleLokiPushJSON(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	body := `{"streams":[{"stream":{"app":"x"},"values":[["1697062455123000000","hello"],["1697062456000000000","bye",{"level":"warn"}]]}]}`
+	r, _ := http.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleLokiPush(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Equal(t, 2, len(*submitted))
+	assert.Equal(t, "hello", (*submitted)[0].log.Message)
+	assert.Equal(t, "2023-10-11T22:14:15.123Z", (*submitted)[0].log.Timestamp)
+	assert.Equal(t, "x", (*submitted)[0].log.Attributes["app"])
+	assert.Equal(t, "warn", (*submitted)[1].log.Level)
+}
+
+func TestHandleLokiPushServicePrecedence(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	body := `{"streams":[{"stream":{"service_name":"worker"},"values":[["1697062455123000000","own"]]},{"stream":{"app":"x"},"values":[["1697062456000000000","defaulted"]]}]}`
+	r, _ := http.NewRequest("POST", "/loki/api/v1/push", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	r.Header.Set(LogDrainServiceHeader, "checkout")
+	w := httptest.NewRecorder()
+	HandleLokiPush(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		// the service_name label takes precedence over the header
+		assert.Equal(t, "worker", (*submitted)[0].log.Attributes["service.name"])
+		assert.Equal(t, "checkout", (*submitted)[1].log.Attributes["service.name"])
+	}
+}
+
+func TestHandleLokiPushInvalidLabels(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	push := appendProtoMessage(nil, 1, lokiProtoStream(`{app="x"`, lokiProtoEntry(1697062455, 0, "hello")))
+	r, _ := http.NewRequest("POST", "/loki/api/v1/push", bytes.NewReader(snappy.Encode(nil, push)))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleLokiPush(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, *submitted)
+}
+
+func TestHandleLokiPushDecodedTooLarge(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	send := func(body []byte) int {
+		r, _ := http.NewRequest("POST", "/loki/api/v1/push", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-protobuf")
+		r.Header.Set(LokiTenantHeader, "1")
+		w := httptest.NewRecorder()
+		HandleLokiPush(w, r)
+		return w.Code
+	}
+
+	// a snappy block is prefixed by its decoded length, which is checked before it is allocated
+	header := protowire.AppendVarint(nil, 0xfffffff0)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(header))
+
+	// a small body can still decode past the limit
+	SetMaxBodyBytes(1024)
+	defer SetMaxBodyBytes(0)
+	var push []byte
+	push = appendProtoMessage(push, 1, lokiProtoStream(`{job="cron"}`, lokiProtoEntry(1697062457, 0, strings.Repeat("a", 2048))))
+	encoded := snappy.Encode(nil, push)
+	assert.Less(t, len(encoded), 1024)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(encoded))
+	assert.Empty(t, *submitted)
+}
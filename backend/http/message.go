@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	hmetric "github.com/highlight/highlight/sdk/highlight-go/metric"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// ObjectMessageMode controls how a json log whose message is not a string is ingested.
+type ObjectMessageMode int
+
+const (
+	// ObjectMessageStringify uses the json encoding of the message.
+	ObjectMessageStringify ObjectMessageMode = iota
+	// ObjectMessageExtract uses the nested `message` or `text` string of the object,
+	// falling back to the json encoding when neither is set.
+	ObjectMessageExtract
+)
+
+var objectMessageMode = ObjectMessageStringify
+
+// SetObjectMessageMode sets how object valued json messages are coerced to a string.
+func SetObjectMessageMode(mode ObjectMessageMode) {
+	objectMessageMode = mode
+}
+
+func coerceMessage(message interface{}) string {
+	if obj, ok := message.(map[string]interface{}); ok && objectMessageMode == ObjectMessageExtract {
+		for _, key := range []string{"message", "text"} {
+			if s, ok := obj[key].(string); ok {
+				return s
+			}
+		}
+	}
+	b, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Sprint(message)
+	}
+	return string(b)
+}
+
+var dropEmptyMessages = true
+
+// SetDropEmptyMessages skips logs whose message is blank unless they carry attributes of their own.
+// It is enabled by default.
+func SetDropEmptyMessages(drop bool) {
+	dropEmptyMessages = drop
+}
+
+// ingestMetadataAttributes are the fields of the log itself and the attributes set by the handlers
+// on every log, so they do not make an empty log meaningful.
+var ingestMetadataAttributes = map[string]bool{
+	"message":                      true,
+	"level":                        true,
+	"timestamp":                    true,
+	string(semconv.ServiceNameKey): true,
+	FirehoseRequestIDAttribute:     true,
+	CloudWatchEventIDAttribute:     true,
+	"message_type":                 true,
+	"owner":                        true,
+	"log_group":                    true,
+	"log_stream":                   true,
+}
+
+// isEmptyLog reports whether a log should be skipped for having neither a message nor attributes.
+func isEmptyLog(lg hlog.Log) bool {
+	if !dropEmptyMessages || strings.TrimSpace(lg.Message) != "" {
+		return false
+	}
+	for k, v := range lg.Attributes {
+		if v != "" && !ingestMetadataAttributes[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// dropEmptyLogs removes the empty logs of a firehose request along with the index of their record,
+// returning the number of logs that were skipped.
+func dropEmptyLogs(ctx context.Context, projectID int, logs []hlog.Log, records []int) ([]hlog.Log, []int, int) {
+	var kept []hlog.Log
+	var keptRecords []int
+	for idx, lg := range logs {
+		if isEmptyLog(lg) {
+			continue
+		}
+		kept = append(kept, lg)
+		keptRecords = append(keptRecords, records[idx])
+	}
+	skipped := len(logs) - len(kept)
+	if skipped > 0 {
+		hmetric.Incr(ctx, "http-logs.filtered", []attribute.KeyValue{attribute.Int("project_id", projectID)}, float64(skipped))
+	}
+	return kept, keptRecords, skipped
+}
@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	hmetric "github.com/highlight/highlight/sdk/highlight-go/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	metricLogsReceived  = "http-logs.received"
+	metricLogsSubmitted = "http-logs.submitted"
+	metricSubmitErrors  = "http-logs.submit-errors"
+	metricDecodeErrors  = "http-logs.decode-errors"
+	metricBytesIngested = "http-logs.bytes"
+	metricLatency       = "http-logs.latency"
+)
+
+const (
+	endpointFirehose = "firehose"
+	endpointJSON     = "json"
+	endpointBulk     = "bulk"
+)
+
+// metricsRegistry holds the prometheus metrics served at /metrics. A dedicated registry keeps the
+// ingestion metrics apart from those that other packages register on the default one.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	promLogsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_logs_received_total",
+		Help: "Logs received by the http logs endpoints.",
+	}, []string{"endpoint", "project_id"})
+	promLogsSubmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_logs_submitted_total",
+		Help: "Logs submitted for ingestion by the http logs endpoints.",
+	}, []string{"endpoint", "project_id"})
+	promSubmitErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_logs_submit_errors_total",
+		Help: "Logs that failed to be submitted for ingestion.",
+	}, []string{"endpoint", "project_id"})
+	promDecodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_logs_decode_errors_total",
+		Help: "Logs that failed to decode.",
+	}, []string{"endpoint", "project_id"})
+	promBytesIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_logs_bytes_total",
+		Help: "Bytes of the logs received by the http logs endpoints.",
+	}, []string{"endpoint", "project_id"})
+	promLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_logs_handler_duration_seconds",
+		Help:    "Latency of the http logs handlers.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(promLogsReceived, promLogsSubmitted, promSubmitErrors, promDecodeErrors, promBytesIngested, promLatency)
+}
+
+// MetricsHandler serves the ingestion metrics in the prometheus exposition format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+var metricsProjectLabel = true
+
+// SetMetricsProjectLabel sets whether the ingestion metrics are labeled by project, which deployments
+// with many projects may disable to bound the cardinality of the metrics. It is enabled by default.
+func SetMetricsProjectLabel(enabled bool) {
+	metricsProjectLabel = enabled
+}
+
+// metricTags labels a metric by endpoint and project. A zero project is one that is not known yet,
+// such as that of a body that failed to decode.
+func metricTags(endpoint string, projectID int) []attribute.KeyValue {
+	tags := []attribute.KeyValue{attribute.String("endpoint", endpoint)}
+	if metricsProjectLabel && projectID != 0 {
+		tags = append(tags, attribute.Int("project_id", projectID))
+	}
+	return tags
+}
+
+// promLabels are the prometheus labels of metricTags. The project label is left empty, which
+// prometheus treats as unset, when it is disabled or the project is not known.
+func promLabels(endpoint string, projectID int) prometheus.Labels {
+	project := ""
+	if metricsProjectLabel && projectID != 0 {
+		project = strconv.Itoa(projectID)
+	}
+	return prometheus.Labels{"endpoint": endpoint, "project_id": project}
+}
+
+func recordReceived(ctx context.Context, endpoint string, projectID int, logs int, bytes int) {
+	tags := metricTags(endpoint, projectID)
+	hmetric.Incr(ctx, metricLogsReceived, tags, float64(logs))
+	hmetric.Incr(ctx, metricBytesIngested, tags, float64(bytes))
+	labels := promLabels(endpoint, projectID)
+	promLogsReceived.With(labels).Add(float64(logs))
+	promBytesIngested.With(labels).Add(float64(bytes))
+}
+
+func recordSubmitted(ctx context.Context, endpoint string, projectID int, submitted int, failed int) {
+	tags := metricTags(endpoint, projectID)
+	labels := promLabels(endpoint, projectID)
+	if submitted > 0 {
+		hmetric.Incr(ctx, metricLogsSubmitted, tags, float64(submitted))
+		promLogsSubmitted.With(labels).Add(float64(submitted))
+	}
+	if failed > 0 {
+		hmetric.Incr(ctx, metricSubmitErrors, tags, float64(failed))
+		promSubmitErrors.With(labels).Add(float64(failed))
+	}
+}
+
+func recordDecodeErrors(ctx context.Context, endpoint string, projectID int, count int) {
+	if count > 0 {
+		hmetric.Incr(ctx, metricDecodeErrors, metricTags(endpoint, projectID), float64(count))
+		promDecodeErrors.With(promLabels(endpoint, projectID)).Add(float64(count))
+	}
+}
+
+// recordBatchSubmitted records the submission of every project of a batch, given the errors
+// returned by its submit.
+func recordBatchSubmitted(ctx context.Context, endpoint string, batch *logBatch, errs []error) {
+	for _, projectID := range batch.projects {
+		failed := 0
+		for _, idx := range batch.indices[projectID] {
+			if errs != nil && errs[idx] != nil {
+				failed++
+			}
+		}
+		recordSubmitted(ctx, endpoint, projectID, len(batch.indices[projectID])-failed, failed)
+	}
+}
+
+// MetricsMiddleware records the latency of the ingestion handlers, labeled by their route so that
+// url parameters such as sumo logic tokens do not add to the cardinality.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		endpoint := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			endpoint = rctx.RoutePattern()
+		}
+		latency := time.Since(start)
+		hmetric.Timing(r.Context(), metricLatency, latency, []attribute.KeyValue{attribute.String("endpoint", endpoint)}, 1)
+		promLatency.WithLabelValues(endpoint).Observe(latency.Seconds())
+	})
+}
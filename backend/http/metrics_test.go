@@ -0,0 +1,43 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestMetricTags(t *testing.T) {
+	defer SetMetricsProjectLabel(true)
+
+	assert.Equal(t, []attribute.KeyValue{attribute.String("endpoint", "json"), attribute.Int("project_id", 1)}, metricTags(endpointJSON, 1))
+	// the project of a body that failed to decode is not known
+	assert.Equal(t, []attribute.KeyValue{attribute.String("endpoint", "firehose")}, metricTags(endpointFirehose, 0))
+
+	SetMetricsProjectLabel(false)
+	assert.Equal(t, []attribute.KeyValue{attribute.String("endpoint", "json")}, metricTags(endpointJSON, 1))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	captureSubmits(t)
+	router := newTestRouter()
+
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello"}`))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r, _ = http.NewRequest("GET", "/metrics", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `http_logs_received_total{endpoint="json",project_id="1"}`)
+	assert.Contains(t, body, `http_logs_submitted_total{endpoint="json",project_id="1"}`)
+	assert.Contains(t, body, `http_logs_bytes_total{endpoint="json",project_id="1"}`)
+	assert.Contains(t, body, `http_logs_handler_duration_seconds_count{endpoint="/v1/logs/json"}`)
+}
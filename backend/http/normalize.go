@@ -0,0 +1,48 @@
+package http
+
+import (
+	"strings"
+	"sync"
+)
+
+var valueNormalization = struct {
+	sync.RWMutex
+	byKey map[string]map[string]string
+}{}
+
+// SetAttributeValueNormalization configures canonical values for attribute keys, for example
+// {"environment": {"prod": "production", "production": "production"}}. Values are matched
+// case-insensitively. The "level" key also applies to the log level.
+func SetAttributeValueNormalization(normalization map[string]map[string]string) {
+	byKey := make(map[string]map[string]string, len(normalization))
+	for key, values := range normalization {
+		byKey[key] = make(map[string]string, len(values))
+		for value, canonical := range values {
+			byKey[key][strings.ToLower(value)] = canonical
+		}
+	}
+	valueNormalization.Lock()
+	defer valueNormalization.Unlock()
+	valueNormalization.byKey = byKey
+}
+
+func normalizeValue(key, value string) string {
+	valueNormalization.RLock()
+	defer valueNormalization.RUnlock()
+	if canonical, ok := valueNormalization.byKey[key][strings.ToLower(strings.TrimSpace(value))]; ok {
+		return canonical
+	}
+	return value
+}
+
+func normalizeAttributeValues(attributes map[string]string) {
+	valueNormalization.RLock()
+	empty := len(valueNormalization.byKey) == 0
+	valueNormalization.RUnlock()
+	if empty {
+		return
+	}
+	for k, v := range attributes {
+		attributes[k] = normalizeValue(k, v)
+	}
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const openSearchAuditTimestampField = "@timestamp"
+
+// openSearchAuditWarnCategories are the audit categories of rejected requests, which are ingested at
+// warn rather than info.
+var openSearchAuditWarnCategories = map[string]bool{
+	"FAILED_LOGIN":       true,
+	"MISSING_PRIVILEGES": true,
+	"BAD_HEADERS":        true,
+	"SSL_EXCEPTION":      true,
+}
+
+// isOpenSearchAuditLog reports whether a json log is an opensearch security audit log, as written
+// by the webhook and log4j sinks of the audit log.
+func isOpenSearchAuditLog(fields map[string]interface{}) bool {
+	_, hasCategory := fields["audit_category"].(string)
+	_, hasLayer := fields["audit_request_layer"].(string)
+	return hasCategory && hasLayer
+}
+
+// openSearchAuditMessage synthesizes the message of an audit log from its category, the user it
+// was made by, and the rest request or transport action it audits.
+func openSearchAuditMessage(fields map[string]interface{}) string {
+	message := fields["audit_category"].(string)
+	if user, ok := fields["audit_request_effective_user"].(string); ok && user != "" {
+		message += " by " + user
+	}
+	method, _ := fields["audit_rest_request_method"].(string)
+	path, _ := fields["audit_rest_request_path"].(string)
+	action, _ := fields["audit_transport_request_type"].(string)
+	if path != "" {
+		message += ": " + strings.TrimSpace(method+" "+path)
+	} else if action != "" {
+		message += ": " + action
+	}
+	return message
+}
+
+// parseOpenSearchAuditLog converts an opensearch security audit log into a log. The audit fields are
+// kept as attributes so that they can be searched on.
+func parseOpenSearchAuditLog(ctx context.Context, fields map[string]interface{}) hlog.Log {
+	lg := hlog.Log{
+		Attributes: make(map[string]string),
+		Message:    openSearchAuditMessage(fields),
+		Level:      model.LogLevelInfo.String(),
+	}
+	if openSearchAuditWarnCategories[fields["audit_category"].(string)] {
+		lg.Level = model.LogLevelWarn.String()
+	}
+	if ts, ok := parseTimestamp(fields[openSearchAuditTimestampField]); ok {
+		lg.Timestamp = ts.Format(hlog.TimestampFormatNano)
+	}
+	for k, v := range fields {
+		if k == openSearchAuditTimestampField {
+			continue
+		}
+		for key, value := range formatAttributes(ctx, k, v) {
+			lg.Attributes[key] = value
+		}
+	}
+	if host, ok := fields["audit_node_host_name"].(string); ok && host != "" {
+		lg.Attributes[string(semconv.HostNameKey)] = host
+	}
+	limitAttributes(ctx, &lg)
+	return lg
+}
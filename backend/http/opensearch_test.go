@@ -0,0 +1,46 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const OpenSearchAuditLog = `{"audit_cluster_name":"docker-cluster","audit_node_name":"opensearch-node1","audit_rest_request_method":"GET","audit_category":"FAILED_LOGIN","audit_request_origin":"REST","audit_node_id":"Dlq1n5ZxRw6cPEQXNqYl7A","audit_request_layer":"REST","audit_rest_request_path":"/_plugins/_security/authinfo","@timestamp":"2023-10-11T22:14:15.123+00:00","audit_request_effective_user_is_admin":false,"audit_format_version":4,"audit_request_remote_address":"172.18.0.1","audit_node_host_address":"172.18.0.3","audit_rest_request_headers":{"Host":["localhost:9200"]},"audit_node_host_name":"172.18.0.3","audit_request_effective_user":"admin"}`
+
+func TestHandleOpenSearchAuditLog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	body := strings.Join([]string{
+		OpenSearchAuditLog,
+		`{"audit_category":"TRANSPORT","audit_request_layer":"TRANSPORT","audit_transport_request_type":"SearchRequest","@timestamp":"2023-10-11T22:14:16.000+00:00"}`,
+	}, "\n")
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		lg := (*submitted)[0].log
+		assert.Equal(t, "FAILED_LOGIN by admin: GET /_plugins/_security/authinfo", lg.Message)
+		assert.Equal(t, "warn", lg.Level)
+		assert.Equal(t, "2023-10-11T22:14:15.123Z", lg.Timestamp)
+		assert.Equal(t, "FAILED_LOGIN", lg.Attributes["audit_category"])
+		assert.Equal(t, "REST", lg.Attributes["audit_request_layer"])
+		assert.Equal(t, "opensearch-node1", lg.Attributes["audit_node_name"])
+		assert.Equal(t, "172.18.0.1", lg.Attributes["audit_request_remote_address"])
+		assert.Equal(t, "localhost:9200", lg.Attributes["audit_rest_request_headers.Host.0"])
+		assert.Equal(t, "172.18.0.3", lg.Attributes["host.name"])
+		assert.NotContains(t, lg.Attributes, "@timestamp")
+
+		lg = (*submitted)[1].log
+		assert.Equal(t, "TRANSPORT: SearchRequest", lg.Message)
+		assert.Equal(t, "info", lg.Level)
+		assert.Equal(t, "2023-10-11T22:14:16Z", lg.Timestamp)
+	}
+}
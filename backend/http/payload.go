@@ -0,0 +1,71 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var decodeField string
+
+// SetDecodeField sets a json log field holding the base64 of a gzipped json document, such as the
+// `payload` of clients that double encode their logs. The decoded document is merged into the log
+// in place of the field. Passing an empty field disables it.
+func SetDecodeField(field string) {
+	decodeField = field
+}
+
+// decodePayload decodes the base64 encoded and gzipped json document of a field.
+func decodePayload(value string) (map[string]interface{}, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	encoding := sniffEncoding(data)
+	if encoding == "" {
+		return nil, errors.New("payload is not compressed")
+	}
+	payload, err := decodeBody(encoding, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer payload.Close()
+	decoded, err := io.ReadAll(limitBody(payload))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(decoded, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// mergeDecodeField replaces the decode field of a json log with the fields of its decoded document.
+// The fields already set on the log take precedence, and a field that can not be decoded is kept as is.
+func mergeDecodeField(ctx context.Context, lgAttrs map[string]interface{}) bool {
+	if decodeField == "" {
+		return false
+	}
+	value, ok := lgAttrs[decodeField].(string)
+	if !ok {
+		return false
+	}
+	fields, err := decodePayload(value)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("field", decodeField).Warn("failed to decode http log payload field")
+		return false
+	}
+	delete(lgAttrs, decodeField)
+	for k, v := range fields {
+		if _, ok := lgAttrs[k]; !ok {
+			lgAttrs[k] = v
+		}
+	}
+	return true
+}
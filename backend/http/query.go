@@ -0,0 +1,88 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// QueryAttributePrefix marks the query parameters holding log attributes, such as `attr.env=prod`.
+const QueryAttributePrefix = "attr."
+
+// maxQueryAttributes bounds the attributes read from the query of a request.
+const maxQueryAttributes = 32
+
+// reservedQueryAttributes may not be set from the query, since they identify the project and
+// service of a log or are decoded into the log itself.
+var reservedQueryAttributes = map[string]bool{
+	LogDrainProjectHeader:          true,
+	LogDrainServiceHeader:          true,
+	"project_id":                   true,
+	string(semconv.ServiceNameKey): true,
+	"message":                      true,
+	"level":                        true,
+	"timestamp":                    true,
+}
+
+var queryParams bool
+
+// SetQueryParams sets whether the project, service and attributes of a request may be read from its
+// query, for clients behind proxies that can add query parameters but not headers. The headers take
+// precedence over the query.
+func SetQueryParams(enabled bool) {
+	queryParams = enabled
+}
+
+// isReservedQueryAttribute reports whether the attribute may not be set from the query, including
+// the internal `highlight` attributes and the body project field.
+func isReservedQueryAttribute(key string) bool {
+	lower := strings.ToLower(key)
+	return reservedQueryAttributes[lower] ||
+		strings.HasPrefix(lower, "highlight") ||
+		(bodyProjectField != "" && key == bodyProjectField)
+}
+
+// QueryParamsMiddleware reads the project, service and attributes of a request from its query
+// when enabled with SetQueryParams. The project and service fill in missing highlight headers so
+// that every endpoint reads them the same way.
+func QueryParamsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !queryParams || r.URL.RawQuery == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		qs := r.URL.Query()
+		// the headers are copied so that the request of the caller is left as is
+		r = r.WithContext(r.Context())
+		r.Header = r.Header.Clone()
+		for param, header := range map[string]string{
+			LogDrainProjectQueryParam: LogDrainProjectHeader,
+			LogDrainServiceQueryParam: LogDrainServiceHeader,
+		} {
+			if value := qs.Get(param); value != "" && r.Header.Get(header) == "" {
+				r.Header.Set(header, value)
+			}
+		}
+
+		attributes := make(map[string]string)
+		for param, values := range qs {
+			key, ok := strings.CutPrefix(param, QueryAttributePrefix)
+			if !ok || key == "" || len(values) == 0 {
+				continue
+			}
+			if isReservedQueryAttribute(key) {
+				log.WithContext(r.Context()).WithField("attribute", key).Warn("ignoring reserved http logs query attribute")
+				continue
+			}
+			if len(attributes) == maxQueryAttributes {
+				log.WithContext(r.Context()).WithField("limit", maxQueryAttributes).Warn("ignoring http logs query attributes beyond the limit")
+				break
+			}
+			attributes[key] = values[0]
+		}
+		next.ServeHTTP(w, r.WithContext(withRequestAttributes(r.Context(), attributes)))
+	})
+}
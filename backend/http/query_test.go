@@ -0,0 +1,47 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryParams(t *testing.T) {
+	submitted := captureSubmits(t)
+	defer SetQueryParams(false)
+
+	send := func(url string, headers map[string]string) int {
+		r, _ := http.NewRequest("POST", url, strings.NewReader(`{"message":"hello"}`))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		return w.Code
+	}
+	const url = "/v1/logs/json?project=1&service=checkout&attr.env=prod&attr.highlight.project_id=2&attr.service.name=other"
+
+	// the query is ignored unless enabled
+	assert.Equal(t, http.StatusUnauthorized, send(url, nil))
+
+	SetQueryParams(true)
+	assert.Equal(t, http.StatusOK, send(url, nil))
+	if assert.Equal(t, 1, len(*submitted)) {
+		lg := (*submitted)[0]
+		assert.Equal(t, 1, lg.projectID)
+		assert.Equal(t, "checkout", lg.log.Attributes["service.name"])
+		assert.Equal(t, "prod", lg.log.Attributes["env"])
+		// reserved attributes can not be injected from the query
+		assert.NotContains(t, lg.log.Attributes, "highlight.project_id")
+	}
+
+	// the headers take precedence over the query
+	*submitted = nil
+	assert.Equal(t, http.StatusOK, send(url, map[string]string{LogDrainServiceHeader: "api"}))
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "api", (*submitted)[0].log.Attributes["service.name"])
+	}
+}
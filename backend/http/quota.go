@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	hmetric "github.com/highlight/highlight/sdk/highlight-go/metric"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// QuotaTracker counts the logs ingested per project over daily windows.
+type QuotaTracker interface {
+	// Consume adds n logs to the usage of the project in the day and returns the usage including them.
+	Consume(ctx context.Context, projectID int, day time.Time, n int64) (int64, error)
+}
+
+// quotaDay returns the utc day that a quota window is keyed by.
+func quotaDay(day time.Time) string {
+	return day.UTC().Format("2006-01-02")
+}
+
+type quotaWindow struct {
+	projectID int
+	day       string
+}
+
+// MemoryQuotaTracker is a QuotaTracker that only applies to a single instance.
+type MemoryQuotaTracker struct {
+	mu    sync.Mutex
+	usage map[quotaWindow]int64
+}
+
+func NewMemoryQuotaTracker() *MemoryQuotaTracker {
+	return &MemoryQuotaTracker{usage: make(map[quotaWindow]int64)}
+}
+
+func (t *MemoryQuotaTracker) Consume(_ context.Context, projectID int, day time.Time, n int64) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	window := quotaWindow{projectID: projectID, day: quotaDay(day)}
+	// only the current window is kept
+	for w := range t.usage {
+		if w.day != window.day {
+			delete(t.usage, w)
+		}
+	}
+	t.usage[window] += n
+	return t.usage[window], nil
+}
+
+// RedisQuotaTracker is a QuotaTracker shared by every instance using the same redis.
+type RedisQuotaTracker struct {
+	client redis.Cmdable
+}
+
+func NewRedisQuotaTracker(client redis.Cmdable) *RedisQuotaTracker {
+	return &RedisQuotaTracker{client: client}
+}
+
+func (t *RedisQuotaTracker) Consume(ctx context.Context, projectID int, day time.Time, n int64) (int64, error) {
+	key := fmt.Sprintf("http-logs-quota-%d-%s", projectID, quotaDay(day))
+	var incr *redis.IntCmd
+	if _, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, key, n)
+		pipe.Expire(ctx, key, 48*time.Hour)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+type dailyQuota struct {
+	tracker QuotaTracker
+	limit   int64
+}
+
+var quota *dailyQuota
+
+// SetDailyQuota drops the logs of a project once it ingested more than the limit in a utc day,
+// until the next day. Passing a nil tracker or a non-positive limit disables it.
+func SetDailyQuota(tracker QuotaTracker, limit int64) {
+	if tracker == nil || limit <= 0 {
+		quota = nil
+		return
+	}
+	quota = &dailyQuota{tracker: tracker, limit: limit}
+}
+
+// applyQuota charges the logs to the daily quota of the project and returns those within it,
+// along with their indices. The remaining budget is reported in the stats of the request.
+// Failures of the tracker are logged and do not drop logs.
+func applyQuota(ctx context.Context, projectID int, logs []hlog.Log, indices []int) ([]hlog.Log, []int) {
+	q := quota
+	if q == nil || len(logs) == 0 {
+		return logs, indices
+	}
+	used, err := q.tracker.Consume(ctx, projectID, time.Now(), int64(len(logs)))
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("project_id", projectID).Warn("failed to check http logs daily quota")
+		return logs, indices
+	}
+
+	if stats := getIngestStats(ctx); stats != nil {
+		stats.quotaRemaining.Store(max(q.limit-used, 0))
+		stats.quotaTracked.Store(true)
+	}
+	allowed := min(max(q.limit-(used-int64(len(logs))), 0), int64(len(logs)))
+	if dropped := int64(len(logs)) - allowed; dropped > 0 {
+		hmetric.Incr(ctx, "http-logs.quota-exceeded", []attribute.KeyValue{attribute.Int("project_id", projectID)}, float64(dropped))
+	}
+	return logs[:allowed], indices[:allowed]
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailyQuota(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetDailyQuota(NewMemoryQuotaTracker(), 3)
+	defer SetDailyQuota(nil, 0)
+
+	router := newTestRouter()
+	send := func(project string, messages ...string) *httptest.ResponseRecorder {
+		var lines []string
+		for _, message := range messages {
+			lines = append(lines, fmt.Sprintf(`{"message":%q}`, message))
+		}
+		r := httptest.NewRequest("POST", "/v1/logs/json", strings.NewReader(strings.Join(lines, "\n")))
+		r.Header.Set("Content-Type", "application/x-ndjson")
+		r.Header.Set(LogDrainProjectHeader, project)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send("1", "one", "two")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(QuotaRemainingHeader))
+	assert.Equal(t, 2, len(*submitted))
+
+	// the logs past the quota are dropped
+	w = send("1", "three", "four")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get(QuotaRemainingHeader))
+	assert.Equal(t, 3, len(*submitted))
+	assert.Equal(t, "three", (*submitted)[2].log.Message)
+
+	w = send("1", "five")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get(QuotaRemainingHeader))
+	assert.Equal(t, 3, len(*submitted))
+
+	// other projects have a quota of their own
+	w = send("2", "six")
+	assert.Equal(t, "2", w.Header().Get(QuotaRemainingHeader))
+	assert.Equal(t, 4, len(*submitted))
+}
+
+func TestMemoryQuotaTrackerWindow(t *testing.T) {
+	tracker := NewMemoryQuotaTracker()
+	day := time.Date(2023, 10, 11, 23, 59, 0, 0, time.UTC)
+	used, err := tracker.Consume(context.Background(), 1, day, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), used)
+
+	// the usage resets with the next utc day
+	used, _ = tracker.Consume(context.Background(), 1, day.Add(2*time.Minute), 1)
+	assert.Equal(t, int64(1), used)
+}
@@ -0,0 +1,290 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	hmetric "github.com/highlight/highlight/sdk/highlight-go/metric"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const ipRateLimitCacheSize = 100_000
+
+// IPRateLimit throttles the logs ingested from a single source ip.
+type IPRateLimit struct {
+	// LogsPerSecond is the rate at which an ip's budget is refilled.
+	LogsPerSecond float64
+	// Burst is the maximum budget an ip may accumulate.
+	Burst int
+	// TrustedProxies are the networks whose X-Forwarded-For header is honored.
+	TrustedProxies []*net.IPNet
+}
+
+// tokenBucket allows the budget to go into debt so that a single large request is
+// accepted but blocks the following requests until the debt is refilled.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// allow reports whether a request may start and otherwise how long until it may.
+func (b *tokenBucket) allow(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens >= 1 {
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(now time.Time, n float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens -= n
+}
+
+type ipRateLimiter struct {
+	limit   IPRateLimit
+	buckets *lru.Cache[string, *tokenBucket]
+}
+
+var ipLimiter *ipRateLimiter
+
+// SetIPRateLimit enables throttling the logs ingested per source ip. Passing nil, or a limit
+// without a positive rate and burst, disables it.
+func SetIPRateLimit(limit *IPRateLimit) {
+	if limit == nil {
+		ipLimiter = nil
+		return
+	}
+	if limit.LogsPerSecond <= 0 || limit.Burst <= 0 {
+		log.WithField("logs_per_second", limit.LogsPerSecond).WithField("burst", limit.Burst).
+			Warn("disabling http logs ip rate limit without a positive rate and burst")
+		ipLimiter = nil
+		return
+	}
+	buckets, err := lru.New[string, *tokenBucket](ipRateLimitCacheSize)
+	if err != nil {
+		log.WithError(err).Error("failed to create http logs ip rate limit cache")
+		return
+	}
+	ipLimiter = &ipRateLimiter{limit: *limit, buckets: buckets}
+}
+
+func (l *ipRateLimiter) bucket(ip string, now time.Time) *tokenBucket {
+	bucket := &tokenBucket{
+		rate:   l.limit.LogsPerSecond,
+		burst:  float64(l.limit.Burst),
+		tokens: float64(l.limit.Burst),
+		last:   now,
+	}
+	if previous, ok, _ := l.buckets.PeekOrAdd(ip, bucket); ok {
+		return previous
+	}
+	return bucket
+}
+
+func isTrustedProxy(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the ip of the client, walking the X-Forwarded-For chain from the right
+// for as long as the hops are trusted proxies.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := remoteIP(r)
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !isTrustedProxy(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+type ipRateLimitKey struct{}
+
+// takeIPRateLimit charges the submitted logs to the budget of the request's source ip.
+func takeIPRateLimit(ctx context.Context, n int) {
+	if bucket, ok := ctx.Value(ipRateLimitKey{}).(*tokenBucket); ok {
+		bucket.take(time.Now(), float64(n))
+	}
+}
+
+// IPRateLimitMiddleware rejects requests from ips that exceeded their budget with a 429.
+// It does nothing unless enabled with SetIPRateLimit.
+func IPRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := ipLimiter
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		ip := clientIP(r, limiter.limit.TrustedProxies)
+		bucket := limiter.bucket(ip, now)
+		if ok, retryAfter := bucket.allow(now); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "too many logs from "+ip, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ipRateLimitKey{}, bucket)))
+	})
+}
+
+// projectRateLimitMinIdle is the least time a project bucket is kept after its last use.
+const projectRateLimitMinIdle = time.Minute
+
+// projectRateLimiter throttles the logs ingested per project. Buckets that have been idle for
+// long enough to refill completely are evicted, since a new bucket starts with the same budget.
+type projectRateLimiter struct {
+	mu        sync.RWMutex
+	rate      float64
+	burst     float64
+	idle      time.Duration
+	lastSweep time.Time
+	buckets   map[int]*tokenBucket
+}
+
+var projectLimiter *projectRateLimiter
+
+// SetProjectRateLimit enables throttling the logs ingested per project. Passing a non-positive rate
+// or burst disables it.
+func SetProjectRateLimit(perSecond, burst int) {
+	if perSecond <= 0 || burst <= 0 {
+		projectLimiter = nil
+		return
+	}
+	idle := time.Duration(float64(burst) / float64(perSecond) * float64(time.Second))
+	if idle < projectRateLimitMinIdle {
+		idle = projectRateLimitMinIdle
+	}
+	projectLimiter = &projectRateLimiter{
+		rate:      float64(perSecond),
+		burst:     float64(burst),
+		idle:      idle,
+		lastSweep: time.Now(),
+		buckets:   make(map[int]*tokenBucket),
+	}
+}
+
+// sweep evicts the buckets that have not been used within the idle period.
+func (l *projectRateLimiter) sweep(now time.Time) {
+	l.mu.RLock()
+	due := now.Sub(l.lastSweep) >= l.idle
+	l.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) < l.idle {
+		return
+	}
+	l.lastSweep = now
+	for projectID, bucket := range l.buckets {
+		bucket.mu.Lock()
+		last := bucket.last
+		bucket.mu.Unlock()
+		if now.Sub(last) >= l.idle {
+			delete(l.buckets, projectID)
+		}
+	}
+}
+
+func (l *projectRateLimiter) bucket(projectID int, now time.Time) *tokenBucket {
+	l.sweep(now)
+
+	l.mu.RLock()
+	bucket, ok := l.buckets[projectID]
+	l.mu.RUnlock()
+	if ok {
+		return bucket
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bucket, ok := l.buckets[projectID]; ok {
+		return bucket
+	}
+	bucket = &tokenBucket{rate: l.rate, burst: l.burst, tokens: l.burst, last: now}
+	l.buckets[projectID] = bucket
+	return bucket
+}
+
+// ProjectRateLimitedError is returned when the logs of a project are rejected because the project
+// exceeded its budget.
+type ProjectRateLimitedError struct {
+	ProjectID  int
+	RetryAfter time.Duration
+}
+
+func (e *ProjectRateLimitedError) Error() string {
+	return fmt.Sprintf("too many logs for project %d", e.ProjectID)
+}
+
+// checkProjectRateLimit returns a *ProjectRateLimitedError when the project exceeded its budget,
+// counting the logs as dropped.
+func checkProjectRateLimit(ctx context.Context, projectID int, logs int) error {
+	limiter := projectLimiter
+	if limiter == nil {
+		return nil
+	}
+	now := time.Now()
+	if ok, retryAfter := limiter.bucket(projectID, now).allow(now); !ok {
+		hmetric.Incr(ctx, "http-logs.rate-limited", []attribute.KeyValue{attribute.Int("project_id", projectID)}, float64(logs))
+		log.WithContext(ctx).WithField("project_id", projectID).WithField("logs", logs).Warn("rejected http logs of rate limited project")
+		return &ProjectRateLimitedError{ProjectID: projectID, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// takeProjectRateLimit checks the budget of the project and charges the logs to it when it allows
+// them, returning a *ProjectRateLimitedError otherwise.
+func takeProjectRateLimit(ctx context.Context, projectID int, logs int) error {
+	if err := checkProjectRateLimit(ctx, projectID, logs); err != nil {
+		return err
+	}
+	if limiter := projectLimiter; limiter != nil {
+		now := time.Now()
+		limiter.bucket(projectID, now).take(now, float64(logs))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPRateLimit(t *testing.T) {
+	submitted := captureSubmits(t)
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	SetIPRateLimit(&IPRateLimit{LogsPerSecond: 0.01, Burst: 2, TrustedProxies: []*net.IPNet{proxies}})
+	defer SetIPRateLimit(nil)
+
+	router := newTestRouter()
+	send := func(remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("hello"))
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("192.0.2.1:1234", "").Code)
+	assert.Equal(t, http.StatusOK, send("192.0.2.1:1234", "").Code)
+	w := send("192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, 2, len(*submitted))
+
+	// another host is not affected
+	assert.Equal(t, http.StatusOK, send("192.0.2.2:1234", "").Code)
+
+	// forwarded headers are only honored from trusted proxies
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", "192.0.2.1, 203.0.113.5").Code)
+	assert.Equal(t, http.StatusOK, send("192.0.2.3:1234", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.2:1234", "192.0.2.1").Code)
+}
+
+func TestIPRateLimitRequiresPositiveRate(t *testing.T) {
+	defer SetIPRateLimit(nil)
+	for _, limit := range []IPRateLimit{{LogsPerSecond: 0, Burst: 2}, {LogsPerSecond: -1, Burst: 2}, {LogsPerSecond: 1, Burst: 0}} {
+		SetIPRateLimit(&IPRateLimit{LogsPerSecond: 1, Burst: 1})
+		SetIPRateLimit(&limit)
+		assert.Nil(t, ipLimiter)
+	}
+}
+
+func TestProjectRateLimit(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetProjectRateLimit(1, 2)
+	defer SetProjectRateLimit(0, 0)
+
+	send := func(project string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello"}`))
+		r.Header.Set(LogDrainProjectHeader, project)
+		w := httptest.NewRecorder()
+		HandleJSONLog(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("1").Code)
+	assert.Equal(t, http.StatusOK, send("1").Code)
+	w := send("1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":{"code":"rate_limited","message":"too many logs for project 1"}}`, w.Body.String())
+	assert.Equal(t, 2, len(*submitted))
+
+	// another project is not affected
+	assert.Equal(t, http.StatusOK, send("2").Code)
+
+	// the budget is shared with the firehose endpoint
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest("hello"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, 3, len(*submitted))
+}
+
+func TestProjectRateLimitEvictsIdleBuckets(t *testing.T) {
+	SetProjectRateLimit(1, 2)
+	defer SetProjectRateLimit(0, 0)
+
+	now := time.Now()
+	projectLimiter.bucket(1, now).take(now, 2)
+	projectLimiter.bucket(2, now.Add(30*time.Second))
+	projectLimiter.bucket(3, now.Add(time.Minute))
+	assert.Equal(t, 2, len(projectLimiter.buckets))
+	assert.NotContains(t, projectLimiter.buckets, 1)
+
+	// a bucket used within the idle period is kept
+	projectLimiter.bucket(3, now.Add(90*time.Second))
+	assert.Equal(t, 2, len(projectLimiter.buckets))
+}
+
+func TestProjectRateLimitSharedSubmit(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetProjectRateLimit(1, 2)
+	defer SetProjectRateLimit(0, 0)
+	router := newTestRouter()
+
+	// the budget applies to every endpoint, as it is taken when the logs are submitted
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("hello"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Equal(t, http.StatusTooManyRequests, send().Code)
+	assert.Equal(t, 2, len(*submitted))
+
+	// the logs of a json request are charged to their own project once
+	*submitted = nil
+	body := `{"message":"a","project":"2"}` + "\n" + `{"message":"b","project":"2"}` + "\n" + `{"message":"c","project":"2"}` + "\n" + `{"message":"d","project":"3"}`
+	SetBodyProjectField("project")
+	defer SetBodyProjectField("")
+	r := httptest.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 4, len(*submitted))
+
+	// project 2 went into debt while project 3 still has budget
+	r = httptest.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"e"}`))
+	r.Header.Set(LogDrainProjectHeader, "2")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	r = httptest.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"f"}`))
+	r.Header.Set(LogDrainProjectHeader, "3")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
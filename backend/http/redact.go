@@ -0,0 +1,65 @@
+package http
+
+import (
+	"regexp"
+)
+
+const RedactedMarker = "[REDACTED]"
+
+// RedactionPattern masks every match of Pattern in a log message. When set, Validate
+// must accept a match before it is redacted.
+type RedactionPattern struct {
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+}
+
+var DefaultRedactionPatterns = []RedactionPattern{
+	// 13 to 19 digit card numbers, optionally grouped by spaces or dashes
+	{Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), Validate: luhnValid},
+	{Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	// bearer tokens, stripe secret keys, aws access key ids and github tokens
+	{Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)},
+	{Pattern: regexp.MustCompile(`\b[sr]k_(?:live|test)_[A-Za-z0-9]{10,}\b`)},
+	{Pattern: regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`)},
+	{Pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)},
+}
+
+var redactionPatterns []RedactionPattern
+
+// SetRedactionPatterns enables masking of sensitive data in log messages. Passing nil disables it.
+func SetRedactionPatterns(patterns []RedactionPattern) {
+	redactionPatterns = patterns
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum used by card numbers.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+func redactMessage(message string) string {
+	for _, p := range redactionPatterns {
+		message = p.Pattern.ReplaceAllStringFunc(message, func(match string) string {
+			if p.Validate != nil && !p.Validate(match) {
+				return match
+			}
+			return RedactedMarker
+		})
+	}
+	return message
+}
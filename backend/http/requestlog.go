@@ -0,0 +1,139 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestLogging configures logging the requests of an endpoint.
+type RequestLogging struct {
+	// SampleRate is the fraction of successful requests that are logged. Failed requests are always logged.
+	SampleRate float64
+}
+
+var requestLogging = struct {
+	sync.RWMutex
+	byEndpoint map[string]RequestLogging
+}{byEndpoint: make(map[string]RequestLogging)}
+
+// SetRequestLogging enables logging the requests of an endpoint, such as "/v1/logs/json".
+// Passing nil disables it.
+func SetRequestLogging(endpoint string, cfg *RequestLogging) {
+	requestLogging.Lock()
+	defer requestLogging.Unlock()
+	if cfg == nil {
+		delete(requestLogging.byEndpoint, endpoint)
+		return
+	}
+	requestLogging.byEndpoint[endpoint] = *cfg
+}
+
+func getRequestLogging(endpoint string) (RequestLogging, bool) {
+	requestLogging.RLock()
+	defer requestLogging.RUnlock()
+	cfg, ok := requestLogging.byEndpoint[endpoint]
+	return cfg, ok
+}
+
+// sampleRequest is replaced in tests to make the sampling deterministic.
+var sampleRequest = rand.Float64
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// requestLogResponseWriter captures the status of the response.
+type requestLogResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *requestLogResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *requestLogResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *requestLogResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *requestLogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// RequestLoggingMiddleware logs the method, path, status, duration, body size and project of the
+// requests to the endpoints enabled with SetRequestLogging.
+func RequestLoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg, ok := getRequestLogging(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		body := &countingReadCloser{ReadCloser: http.NoBody}
+		if r.Body != nil {
+			body.ReadCloser = r.Body
+		}
+		r.Body = body
+		rw := &requestLogResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		failed := rw.status >= 400
+		if !failed && sampleRequest() >= cfg.SampleRate {
+			return
+		}
+		project := r.Header.Get(LogDrainProjectHeader)
+		if project == "" {
+			project = r.URL.Query().Get(LogDrainProjectQueryParam)
+		}
+		entry := log.WithContext(r.Context()).WithFields(log.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rw.status,
+			"duration_ms": time.Since(start).Milliseconds(),
+			"bytes":       body.n.Load(),
+			"project":     project,
+		})
+		if failed {
+			entry.Warn("http logs request failed")
+		} else {
+			entry.Info("http logs request")
+		}
+	})
+}
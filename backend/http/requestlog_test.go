@@ -0,0 +1,72 @@
+package http
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogging(t *testing.T) {
+	captureSubmits(t)
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	SetRequestLogging("/v1/logs/raw", &RequestLogging{SampleRate: 0.01})
+	defer SetRequestLogging("/v1/logs/raw", nil)
+	samples := []float64{0.5, 0.005, 0.9}
+	sampleRequest = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+	defer func() { sampleRequest = rand.Float64 }()
+
+	router := newTestRouter()
+	send := func(path string, project string) {
+		r, _ := http.NewRequest("POST", fmt.Sprintf("%s?%s=%s", path, LogDrainProjectQueryParam, project), strings.NewReader("hello"))
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	requestLogs := func() []*log.Entry {
+		var entries []*log.Entry
+		for _, entry := range hook.AllEntries() {
+			if strings.HasPrefix(entry.Message, "http logs request") {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	// the first success is not sampled, the second is
+	send("/v1/logs/raw", "1")
+	send("/v1/logs/raw", "1")
+	entries := requestLogs()
+	if assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, log.InfoLevel, entries[0].Level)
+		assert.Equal(t, "POST", entries[0].Data["method"])
+		assert.Equal(t, "/v1/logs/raw", entries[0].Data["path"])
+		assert.Equal(t, http.StatusOK, entries[0].Data["status"])
+		assert.Equal(t, int64(5), entries[0].Data["bytes"])
+		assert.Equal(t, "1", entries[0].Data["project"])
+		assert.Contains(t, entries[0].Data, "duration_ms")
+	}
+
+	// failed requests are always logged, without consuming a sample
+	send("/v1/logs/raw", "")
+	entries = requestLogs()
+	if assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, log.WarnLevel, entries[1].Level)
+		assert.Equal(t, http.StatusBadRequest, entries[1].Data["status"])
+	}
+	assert.Equal(t, 1, len(samples))
+
+	// endpoints without request logging are not logged
+	send("/v1/logs/json", "")
+	assert.Equal(t, 2, len(requestLogs()))
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	model2 "github.com/highlight-run/highlight/backend/model"
+)
+
+// ProjectResolver resolves the project that an api key grants access to.
+type ProjectResolver interface {
+	ResolveProject(ctx context.Context, key string) (int, error)
+}
+
+// VerboseIDProjectResolver is the default resolver, which accepts project verbose ids as api keys.
+type VerboseIDProjectResolver struct{}
+
+func (VerboseIDProjectResolver) ResolveProject(_ context.Context, key string) (int, error) {
+	return parseProjectID(key)
+}
+
+var errNonPositiveProject = errors.New("project id is not positive")
+
+// validateProjectID rejects the non-positive project ids that no project has, such as those of
+// verbose ids that are plain integers or malformed but decodable hash ids.
+func validateProjectID(projectID int) (int, error) {
+	if projectID <= 0 {
+		return 0, fmt.Errorf("%w: %d", errNonPositiveProject, projectID)
+	}
+	return projectID, nil
+}
+
+// parseProjectID decodes a project verbose id, rejecting the ids that decode to a non-positive project.
+func parseProjectID(verboseID string) (int, error) {
+	projectID, err := model2.FromVerboseID(verboseID)
+	if err != nil {
+		return 0, err
+	}
+	return validateProjectID(projectID)
+}
+
+var projectResolver ProjectResolver = VerboseIDProjectResolver{}
+
+// SetProjectResolver replaces the resolver of api keys, such as with a cached lookup of the keys
+// of a deployment. Passing nil restores the VerboseIDProjectResolver.
+func SetProjectResolver(resolver ProjectResolver) {
+	if resolver == nil {
+		resolver = VerboseIDProjectResolver{}
+	}
+	projectResolver = resolver
+}
+
+// apiKeyHeader is empty by default, since the bearer tokens that proxies and other integrations
+// send in the authorization header are not highlight api keys.
+var apiKeyHeader string
+
+// SetAPIKeyHeader sets the header holding the api key of a request, such as Authorization. The
+// bearer scheme of an authorization header is stripped, while other headers hold the bare key.
+// Passing an empty header disables api keys.
+func SetAPIKeyHeader(header string) {
+	apiKeyHeader = header
+}
+
+// apiKey returns the api key of a request, or an empty key when it has none.
+func apiKey(r *http.Request) string {
+	if apiKeyHeader == "" {
+		return ""
+	}
+	value := strings.TrimSpace(r.Header.Get(apiKeyHeader))
+	if http.CanonicalHeaderKey(apiKeyHeader) != "Authorization" {
+		return value
+	}
+	// other authorization schemes, such as the basic auth of a proxy, do not carry an api key
+	if scheme, token, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// resolveAPIKeyProject returns the project of the api key of a request, reporting false when the
+// request has no api key.
+func resolveAPIKeyProject(r *http.Request) (int, bool, error) {
+	key := apiKey(r)
+	if key == "" {
+		return 0, false, nil
+	}
+	projectID, err := projectResolver.ResolveProject(r.Context(), key)
+	if err == nil {
+		projectID, err = validateProjectID(projectID)
+	}
+	if err != nil {
+		auditAuthFailure(r, key, "invalid api key")
+		log.WithContext(r.Context()).WithError(err).WithField("keyPrefix", redactKey(key)).Warn("failed to resolve highlight project of http logs api key")
+		return 0, true, err
+	}
+	return projectID, true, nil
+}
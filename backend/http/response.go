@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// The machine readable codes of error responses, which clients may branch on.
+const (
+	ErrorCodeInvalidProject      = "invalid_project"
+	ErrorCodeInvalidHeader       = "invalid_header"
+	ErrorCodeDecodeFailed        = "decode_failed"
+	ErrorCodeUnsupportedEncoding = "unsupported_encoding"
+	ErrorCodeBodyTooLarge        = "body_too_large"
+	ErrorCodeOverloaded          = "overloaded"
+	ErrorCodeRateLimited         = "rate_limited"
+	ErrorCodeIngestPaused        = "ingest_paused"
+	ErrorCodeSubmitFailed        = "submit_failed"
+	ErrorCodeSubmitTimeout       = "submit_timeout"
+)
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+// writeError responds with a json error of the form `{"error":{"code":"...","message":"..."}}`.
+// The message is returned to the client, so it must not hold internal error details.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: errorDetail{Code: code, Message: message}})
+}
+
+// writeProjectError responds with the error of reading the project of a request. A header with
+// conflicting values is reported as such, while an invalid project is not detailed.
+func writeProjectError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errConflictingHeader) {
+		writeError(w, http.StatusBadRequest, ErrorCodeInvalidHeader, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, ErrorCodeInvalidProject, "invalid project")
+}
+
+// writeSubmitError responds with the error of a failed submission. Only the reason a project
+// is paused is reported, since other failures are internal.
+func writeSubmitError(w http.ResponseWriter, err error) {
+	var paused *IngestPausedError
+	if errors.As(err, &paused) {
+		writeError(w, submitErrorStatus(err), ErrorCodeIngestPaused, paused.Error())
+		return
+	}
+	var rateLimited *ProjectRateLimitedError
+	if errors.As(err, &rateLimited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateLimited.RetryAfter.Seconds()))))
+		writeError(w, submitErrorStatus(err), ErrorCodeRateLimited, rateLimited.Error())
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, submitErrorStatus(err), ErrorCodeSubmitTimeout, "timed out submitting logs")
+		return
+	}
+	writeError(w, submitErrorStatus(err), ErrorCodeSubmitFailed, "failed to submit logs")
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponses(t *testing.T) {
+	captureSubmits(t)
+	router := newTestRouter()
+
+	for _, tc := range []struct {
+		name    string
+		path    string
+		headers map[string]string
+		body    string
+		status  int
+		code    string
+		message string
+	}{
+		{
+			name:    "json invalid project",
+			path:    "/v1/logs/json",
+			headers: map[string]string{LogDrainProjectHeader: "not a project"},
+			body:    `{"message":"hello"}`,
+			status:  http.StatusUnauthorized,
+			code:    ErrorCodeInvalidProject,
+			message: "invalid project",
+		},
+		{
+			name:    "json malformed body",
+			path:    "/v1/logs/json",
+			headers: map[string]string{LogDrainProjectHeader: "1"},
+			body:    `{"message":`,
+			status:  http.StatusBadRequest,
+			code:    ErrorCodeDecodeFailed,
+			message: "request body is not valid json",
+		},
+		{
+			name:    "firehose invalid project",
+			path:    "/v1/logs/firehose",
+			headers: map[string]string{"X-Amz-Firehose-Common-Attributes": `{"commonAttributes":{"x-highlight-project":"not a project"}}`},
+			body:    `{"requestId":"ed4acda5-034f-9f42-bba1-f29aea6d7d8f","timestamp":1578090901599,"records":[]}`,
+			status:  http.StatusUnauthorized,
+			code:    ErrorCodeInvalidProject,
+			message: "invalid project",
+		},
+		{
+			name:    "firehose malformed body",
+			path:    "/v1/logs/firehose",
+			headers: map[string]string{"X-Amz-Firehose-Common-Attributes": `{"commonAttributes":{"x-highlight-project":"1"}}`},
+			body:    `{"records":`,
+			status:  http.StatusBadRequest,
+			code:    ErrorCodeDecodeFailed,
+			message: "request body is not a firehose request",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := http.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var response errorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.code, response.Error.Code)
+			// the internal decode errors are not leaked to the client
+			assert.Equal(t, tc.message, response.Error.Message)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+// SequenceCounter hands out monotonically increasing ingestion sequence numbers per project.
+type SequenceCounter interface {
+	// Next reserves the next n sequence numbers of the project and returns the last of them.
+	Next(ctx context.Context, projectID int, n int64) (int64, error)
+}
+
+// MemorySequenceCounter is a SequenceCounter that is only consistent within a single instance.
+type MemorySequenceCounter struct {
+	mu  sync.Mutex
+	seq map[int]int64
+}
+
+func NewMemorySequenceCounter() *MemorySequenceCounter {
+	return &MemorySequenceCounter{seq: make(map[int]int64)}
+}
+
+func (c *MemorySequenceCounter) Next(_ context.Context, projectID int, n int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq[projectID] += n
+	return c.seq[projectID], nil
+}
+
+// RedisSequenceCounter is a SequenceCounter shared by every instance using the same redis.
+type RedisSequenceCounter struct {
+	client redis.Cmdable
+}
+
+func NewRedisSequenceCounter(client redis.Cmdable) *RedisSequenceCounter {
+	return &RedisSequenceCounter{client: client}
+}
+
+func (c *RedisSequenceCounter) Next(ctx context.Context, projectID int, n int64) (int64, error) {
+	return c.client.IncrBy(ctx, fmt.Sprintf("http-logs-ingest-seq-%d", projectID), n).Result()
+}
+
+var sequenceCounter SequenceCounter
+
+// SetSequenceCounter enables stamping logs with the IngestSequenceAttribute. Passing nil disables it.
+func SetSequenceCounter(counter SequenceCounter) {
+	sequenceCounter = counter
+}
+
+// stampSequence stamps the logs with consecutive sequence numbers that are reserved at once.
+func stampSequence(ctx context.Context, projectID int, logs []hlog.Log) error {
+	if sequenceCounter == nil || len(logs) == 0 {
+		return nil
+	}
+	last, err := sequenceCounter.Next(ctx, projectID, int64(len(logs)))
+	if err != nil {
+		return err
+	}
+	first := last - int64(len(logs)) + 1
+	for idx := range logs {
+		logs[idx].Attributes[IngestSequenceAttribute] = strconv.FormatInt(first+int64(idx), 10)
+	}
+	return nil
+}
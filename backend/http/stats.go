@@ -0,0 +1,123 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MessagesTruncatedHeader   = "X-Highlight-Messages-Truncated"
+	AttributesTruncatedHeader = "X-Highlight-Attributes-Truncated"
+	QuotaRemainingHeader      = "X-Highlight-Quota-Remaining"
+	ServerTimingHeader        = "Server-Timing"
+)
+
+// serverTimingMetric is the name of the Server-Timing metric reporting the ingestion latency.
+const serverTimingMetric = "ingest"
+
+var serverTiming = false
+
+// SetServerTiming sets whether responses report the ingestion latency of the request, from reading
+// its body to the completion of its submit, as a `Server-Timing: ingest;dur=<ms>` header that
+// browser and sdk clients can surface in their own telemetry. It is disabled by default.
+func SetServerTiming(enabled bool) {
+	serverTiming = enabled
+}
+
+// ingestStats accumulates the per request ingestion accounting that is reported back to the client.
+type ingestStats struct {
+	messagesTruncated   atomic.Int64
+	attributesTruncated atomic.Int64
+	quotaRemaining      atomic.Int64
+	quotaTracked        atomic.Bool
+	// start is when the request started, and bodyRead when its body started being read in unix nanoseconds
+	start    time.Time
+	bodyRead atomic.Int64
+}
+
+// markBodyRead records when the handler of the request started reading its body.
+func (s *ingestStats) markBodyRead(now time.Time) {
+	s.bodyRead.CompareAndSwap(0, now.UnixNano())
+}
+
+// ingestDuration returns the time since the body of the request started being read, or since the
+// request started for handlers that did not read a body.
+func (s *ingestStats) ingestDuration(now time.Time) time.Duration {
+	if bodyRead := s.bodyRead.Load(); bodyRead != 0 {
+		return now.Sub(time.Unix(0, bodyRead))
+	}
+	return now.Sub(s.start)
+}
+
+func (s *ingestStats) writeHeaders(h http.Header) {
+	h.Set(MessagesTruncatedHeader, strconv.FormatInt(s.messagesTruncated.Load(), 10))
+	h.Set(AttributesTruncatedHeader, strconv.FormatInt(s.attributesTruncated.Load(), 10))
+	if s.quotaTracked.Load() {
+		h.Set(QuotaRemainingHeader, strconv.FormatInt(s.quotaRemaining.Load(), 10))
+	}
+	if serverTiming {
+		// the handlers write their status once the logs are submitted
+		ms := float64(s.ingestDuration(time.Now())) / float64(time.Millisecond)
+		h.Set(ServerTimingHeader, fmt.Sprintf("%s;dur=%.3f", serverTimingMetric, ms))
+	}
+}
+
+type ingestStatsKey struct{}
+
+// getIngestStats returns the stats of the request, or nil when the request is not tracked.
+func getIngestStats(ctx context.Context) *ingestStats {
+	stats, _ := ctx.Value(ingestStatsKey{}).(*ingestStats)
+	return stats
+}
+
+// ingestStatsResponseWriter adds the ingestion accounting headers before the response is written.
+type ingestStatsResponseWriter struct {
+	http.ResponseWriter
+	stats       *ingestStats
+	wroteHeader bool
+}
+
+func (w *ingestStatsResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.stats.writeHeaders(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *ingestStatsResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *ingestStatsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *ingestStatsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// IngestStatsMiddleware tracks ingestion accounting for the request and reports it in the response headers.
+func IngestStatsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := &ingestStats{start: time.Now()}
+		ctx := context.WithValue(r.Context(), ingestStatsKey{}, stats)
+		next.ServeHTTP(&ingestStatsResponseWriter{ResponseWriter: w, stats: stats}, r.WithContext(ctx))
+	})
+}
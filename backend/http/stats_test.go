@@ -0,0 +1,47 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serverTimingPattern matches a Server-Timing metric with a duration, as defined by the w3c spec.
+var serverTimingPattern = regexp.MustCompile(`^([!#$%&'*+\-.^_|~0-9A-Za-z]+);dur=(\d+(?:\.\d+)?)$`)
+
+func TestServerTiming(t *testing.T) {
+	submitted := captureSubmits(t)
+	router := newTestRouter()
+
+	newRequest := func() *http.Request {
+		r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello","level":"info"}`))
+		r.Header.Set(LogDrainProjectHeader, "1")
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(ServerTimingHeader))
+
+	SetServerTiming(true)
+	defer SetServerTiming(false)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, len(*submitted))
+
+	match := serverTimingPattern.FindStringSubmatch(w.Header().Get(ServerTimingHeader))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, "ingest", match[1])
+		dur, err := strconv.ParseFloat(match[2], 64)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, dur, 0.)
+	}
+}
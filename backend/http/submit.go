@@ -0,0 +1,356 @@
+package http
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/highlight/highlight/sdk/highlight-go"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+	hmetric "github.com/highlight/highlight/sdk/highlight-go/metric"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+)
+
+const IngestSequenceAttribute = "highlight.ingest_seq"
+
+// maxSpanEvents is the number of events the otel sdk keeps per span by default.
+// Larger batches are split across several spans so that no log is dropped.
+const maxSpanEvents = 128
+
+// DefaultSubmitTimeout bounds how long a request waits for the submit of its logs.
+const DefaultSubmitTimeout = 30 * time.Second
+
+var submitTimeout = DefaultSubmitTimeout
+
+// SetSubmitTimeout sets how long a request waits for each submit of its logs before it fails with a
+// 504, so that a hanging downstream does not hold clients such as firehose deliveries open.
+// Zero disables the timeout, leaving submits bounded by the cancellation of the request only.
+func SetSubmitTimeout(d time.Duration) {
+	submitTimeout = d
+}
+
+// runSubmit runs a submit bounded by the submit timeout and the cancellation of ctx, returning the
+// error of the context when it is done first. The submit is passed a context that is cancelled once
+// runSubmit returns so that in-flight exports are aborted rather than leaked.
+func runSubmit[T any](ctx context.Context, submit func(ctx context.Context) T) (T, error) {
+	var cancel context.CancelFunc
+	if submitTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, submitTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	done := make(chan T, 1)
+	go func() {
+		done <- submit(ctx)
+	}()
+	select {
+	case result := <-done:
+		return result, nil
+	case <-ctx.Done():
+		// a submit that completed as the context ended is not failed
+		select {
+		case result := <-done:
+			return result, nil
+		default:
+		}
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// submitHTTPLog and submitHTTPLogs are replaced in tests to capture submitted logs.
+var submitHTTPLog = hlog.SubmitHTTPLog
+var submitHTTPLogs = submitHTTPLogBatch
+
+// prepareLog applies the configured ingestion options to a log before it is submitted.
+// It returns false when the log should be dropped.
+func prepareLog(ctx context.Context, projectID int, lg *hlog.Log) (bool, error) {
+	if isDenylisted(projectID, lg.Message) {
+		hmetric.Incr(ctx, "http-logs.filtered", []attribute.KeyValue{attribute.Int("project_id", projectID)}, 1)
+		return false, nil
+	}
+
+	lg.Message = redactMessage(lg.Message)
+
+	if lg.Attributes == nil {
+		lg.Attributes = make(map[string]string)
+	}
+	for k, v := range requestAttributes(ctx) {
+		if _, ok := lg.Attributes[k]; !ok {
+			lg.Attributes[k] = v
+		}
+	}
+	applyFallbackAttributes(lg.Attributes)
+	enrichHostMetadata(lg.Attributes)
+
+	serviceName, ok := allowedServiceName(projectID, lg.Attributes[string(semconv.ServiceNameKey)])
+	if !ok {
+		hmetric.Incr(ctx, "http-logs.filtered", []attribute.KeyValue{attribute.Int("project_id", projectID)}, 1)
+		return false, nil
+	}
+	if serviceName != "" {
+		lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+	}
+
+	normalizeAttributeValues(lg.Attributes)
+	if lg.Level == "" {
+		if level, ok := statusLevel(lg.Attributes); ok {
+			lg.Level = level
+		}
+	}
+	lg.Level = normalizeValue("level", lg.Level)
+	if belowMinLevel(projectID, lg.Level) {
+		hmetric.Incr(ctx, "http-logs.filtered", []attribute.KeyValue{attribute.Int("project_id", projectID)}, 1)
+		return false, nil
+	}
+	truncateLog(ctx, projectID, lg)
+	correctTimestamp(lg, time.Now())
+	normalizeTimestamp(lg)
+	flagClockRegression(projectID, lg)
+
+	if len(fingerprintRules) > 0 {
+		lg.Attributes[MessageTemplateAttribute] = messageTemplate(lg.Message)
+	}
+	return true, nil
+}
+
+// submitLog is the shared submit path for all http log handlers. It applies the configured
+// ingestion options to the log before forwarding it to hlog.
+func submitLog(ctx context.Context, projectID int, lg hlog.Log) error {
+	if err := checkIngestGate(ctx, projectID); err != nil {
+		return err
+	}
+	if ok, err := prepareLog(ctx, projectID, &lg); !ok {
+		return err
+	}
+	if logs, _ := applyQuota(ctx, projectID, []hlog.Log{lg}, []int{0}); len(logs) == 0 {
+		return nil
+	}
+	if err := takeProjectRateLimit(ctx, projectID, 1); err != nil {
+		return err
+	}
+	if err := stampSequence(ctx, projectID, []hlog.Log{lg}); err != nil {
+		return err
+	}
+	takeIPRateLimit(ctx, 1)
+	archiveLogs(projectID, []hlog.Log{lg})
+	submitCtx := ctx
+	if spanCtx, ok := logSpanContext(lg); ok {
+		submitCtx = trace.ContextWithSpanContext(ctx, spanCtx)
+	}
+	err, ctxErr := runSubmit(submitCtx, func(ctx context.Context) error {
+		return submitHTTPLog(ctx, tracer, projectID, lg)
+	})
+	if ctxErr != nil {
+		// the log may still be exported, so it is not dead lettered
+		return ctxErr
+	}
+	if err != nil {
+		deadLetter(ctx, projectID, lg, err)
+		return err
+	}
+	recordSubmit(time.Now())
+	return nil
+}
+
+// submitLogs submits the logs of a single project at once. The returned slice holds the
+// error of each log by index and is nil when every log was submitted.
+func submitLogs(ctx context.Context, projectID int, logs []hlog.Log) []error {
+	var errs []error
+	setErr := func(idx int, err error) {
+		if errs == nil {
+			errs = make([]error, len(logs))
+		}
+		errs[idx] = err
+	}
+
+	if err := checkIngestGate(ctx, projectID); err != nil {
+		for idx := range logs {
+			setErr(idx, err)
+		}
+		return errs
+	}
+
+	var prepared []hlog.Log
+	var indices []int
+	for idx := range logs {
+		lg := logs[idx]
+		ok, err := prepareLog(ctx, projectID, &lg)
+		if err != nil {
+			setErr(idx, err)
+		}
+		if !ok {
+			continue
+		}
+		prepared = append(prepared, lg)
+		indices = append(indices, idx)
+	}
+
+	prepared, indices = applyQuota(ctx, projectID, prepared, indices)
+	if len(prepared) > 0 {
+		if err := takeProjectRateLimit(ctx, projectID, len(prepared)); err != nil {
+			for _, idx := range indices {
+				setErr(idx, err)
+			}
+			return errs
+		}
+	}
+	if err := stampSequence(ctx, projectID, prepared); err != nil {
+		for _, idx := range indices {
+			setErr(idx, err)
+		}
+		return errs
+	}
+
+	takeIPRateLimit(ctx, len(prepared))
+	archiveLogs(projectID, prepared)
+	submitErrs, ctxErr := runSubmit(ctx, func(ctx context.Context) []error {
+		return submitHTTPLogs(ctx, tracer, projectID, prepared)
+	})
+	if ctxErr != nil {
+		// the logs may still be exported, so they are not dead lettered
+		for _, idx := range indices {
+			setErr(idx, ctxErr)
+		}
+		return errs
+	}
+	failed := 0
+	for idx, err := range submitErrs {
+		if err != nil {
+			deadLetter(ctx, projectID, prepared[idx], err)
+			setErr(indices[idx], err)
+			failed++
+		}
+	}
+	if failed < len(prepared) {
+		recordSubmit(time.Now())
+	}
+	return errs
+}
+
+// logBatch groups the logs of a request by project so that each project is submitted at once.
+type logBatch struct {
+	projects []int
+	logs     map[int][]hlog.Log
+	indices  map[int][]int
+	size     int
+}
+
+func newLogBatch() *logBatch {
+	return &logBatch{
+		logs:    make(map[int][]hlog.Log),
+		indices: make(map[int][]int),
+	}
+}
+
+func (b *logBatch) add(projectID int, lg hlog.Log) {
+	if _, ok := b.logs[projectID]; !ok {
+		b.projects = append(b.projects, projectID)
+	}
+	b.logs[projectID] = append(b.logs[projectID], lg)
+	b.indices[projectID] = append(b.indices[projectID], b.size)
+	b.size++
+}
+
+// submit submits every project's logs. The returned slice holds the error of each log
+// in the order it was added and is nil when every log was submitted.
+func (b *logBatch) submit(ctx context.Context) []error {
+	var errs []error
+	for _, projectID := range b.projects {
+		for idx, err := range submitLogs(ctx, projectID, b.logs[projectID]) {
+			if err == nil {
+				continue
+			}
+			if errs == nil {
+				errs = make([]error, b.size)
+			}
+			errs[b.indices[projectID][idx]] = err
+		}
+	}
+	return errs
+}
+
+// submitHTTPLogBatch submits the logs of a project as the events of as few spans as possible.
+// Error logs mark their span as failed and logs with a trace id belong to their trace, so each
+// of those is submitted in a span of its own.
+// The returned slice holds the error of each log by index and is nil when every log was submitted.
+func submitHTTPLogBatch(ctx context.Context, tracer trace.Tracer, projectID int, logs []hlog.Log) []error {
+	var errs []error
+	setErr := func(idx int, err error) {
+		if errs == nil {
+			errs = make([]error, len(logs))
+		}
+		errs[idx] = err
+	}
+
+	var span trace.Span
+	var events int
+	endSpan := func() {
+		if span != nil {
+			highlight.EndTrace(span)
+			span = nil
+		}
+	}
+	defer endSpan()
+
+	for idx, lg := range logs {
+		// a log of a trace is submitted in a span of that trace so that it is linked to it
+		if spanCtx, ok := logSpanContext(lg); ok {
+			if err := hlog.SubmitHTTPLog(trace.ContextWithSpanContext(ctx, spanCtx), tracer, projectID, lg); err != nil {
+				setErr(idx, err)
+			}
+			continue
+		}
+		if lg.Level == model.LogLevelError.String() {
+			if err := hlog.SubmitHTTPLog(ctx, tracer, projectID, lg); err != nil {
+				setErr(idx, err)
+			}
+			continue
+		}
+
+		t, err := time.Parse(hlog.TimestampFormat, lg.Timestamp)
+		if err != nil {
+			t, err = time.Parse(hlog.TimestampFormatNano, lg.Timestamp)
+			if err != nil {
+				setErr(idx, err)
+				continue
+			}
+		}
+
+		attrs := []attribute.KeyValue{
+			hlog.LogSeverityKey.String(lg.Level),
+			hlog.LogMessageKey.String(lg.Message),
+		}
+		for k, v := range lg.Attributes {
+			attrs = append(attrs, attribute.String(k, v))
+		}
+
+		if span == nil || events == maxSpanEvents {
+			endSpan()
+			span, _ = highlight.StartTraceWithoutResourceAttributes(
+				ctx, tracer, highlight.UtilitySpanName, []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindClient)},
+				attribute.String(highlight.ProjectIDAttribute, strconv.Itoa(projectID)),
+			)
+			events = 0
+		}
+		span.AddEvent(highlight.LogEvent, trace.WithAttributes(attrs...), trace.WithTimestamp(t))
+		events++
+	}
+	return errs
+}
+
+// firstError returns the first non-nil error of a batch submission.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,506 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+type submittedLog struct {
+	projectID int
+	log       hlog.Log
+}
+
+// captureSubmits records every log passed to the shared submit path until the test finishes.
+func captureSubmits(t testing.TB) *[]submittedLog {
+	var mu sync.Mutex
+	var submitted []submittedLog
+	submitHTTPLog = func(_ context.Context, _ trace.Tracer, projectID int, lg hlog.Log) error {
+		mu.Lock()
+		defer mu.Unlock()
+		submitted = append(submitted, submittedLog{projectID: projectID, log: lg})
+		return nil
+	}
+	submitHTTPLogs = func(_ context.Context, _ trace.Tracer, projectID int, logs []hlog.Log) []error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, lg := range logs {
+			submitted = append(submitted, submittedLog{projectID: projectID, log: lg})
+		}
+		return nil
+	}
+	// the fixtures are timestamped well in the past
+	SetTimestampWindow(TimestampWindow{})
+	t.Cleanup(func() {
+		submitHTTPLog = hlog.SubmitHTTPLog
+		submitHTTPLogs = submitHTTPLogBatch
+		SetTimestampWindow(DefaultTimestampWindow)
+	})
+	return &submitted
+}
+
+func TestSubmitLogIngestSequence(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetSequenceCounter(NewMemorySequenceCounter())
+	defer SetSequenceCounter(nil)
+
+	ctx := context.Background()
+	for _, projectID := range []int{1, 1, 2, 1, 2} {
+		assert.NoError(t, submitLog(ctx, projectID, hlog.Log{Message: "hello"}))
+	}
+
+	var seqs []string
+	for _, s := range *submitted {
+		seqs = append(seqs, s.log.Attributes[IngestSequenceAttribute])
+	}
+	assert.Equal(t, []string{"1", "2", "1", "3", "2"}, seqs)
+}
+
+type countingSequenceCounter struct {
+	SequenceCounter
+	calls []int64
+}
+
+func (c *countingSequenceCounter) Next(ctx context.Context, projectID int, n int64) (int64, error) {
+	c.calls = append(c.calls, n)
+	return c.SequenceCounter.Next(ctx, projectID, n)
+}
+
+func TestSubmitLogsIngestSequenceReservedOnce(t *testing.T) {
+	submitted := captureSubmits(t)
+	counter := &countingSequenceCounter{SequenceCounter: NewMemorySequenceCounter()}
+	SetSequenceCounter(counter)
+	defer SetSequenceCounter(nil)
+
+	ctx := context.Background()
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "first"}))
+	assert.Nil(t, submitLogs(ctx, 1, []hlog.Log{{Message: "a"}, {Message: "b"}, {Message: "c"}}))
+
+	var seqs []string
+	for _, s := range *submitted {
+		seqs = append(seqs, s.log.Attributes[IngestSequenceAttribute])
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4"}, seqs)
+	assert.Equal(t, []int64{1, 3}, counter.calls)
+}
+
+func TestSubmitLogDenylist(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetDenylist(1, &Denylist{
+		Substrings: []string{"GET /healthz"},
+		Patterns:   []*regexp.Regexp{regexp.MustCompile(`^ping \d+$`)},
+	})
+	defer SetDenylist(1, nil)
+
+	ctx := context.Background()
+	for _, msg := range []string{"GET /healthz 200 1ms", "ping 42", "user 42 logged in"} {
+		assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: msg}))
+	}
+	assert.NoError(t, submitLog(ctx, 2, hlog.Log{Message: "GET /healthz 200 1ms"}))
+
+	assert.Equal(t, 2, len(*submitted))
+	assert.Equal(t, "user 42 logged in", (*submitted)[0].log.Message)
+	assert.Equal(t, 2, (*submitted)[1].projectID)
+}
+
+func TestSubmitLogNormalizesAttributeValues(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetAttributeValueNormalization(map[string]map[string]string{
+		"environment": {"prod": "production", "production": "production", "prd": "production"},
+	})
+	defer SetAttributeValueNormalization(nil)
+
+	ctx := context.Background()
+	for _, env := range []string{"prod", "PROD", "Production", " prd ", "staging"} {
+		assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "hello", Attributes: map[string]string{"environment": env}}))
+	}
+
+	var envs []string
+	for _, s := range *submitted {
+		envs = append(envs, s.log.Attributes["environment"])
+	}
+	assert.Equal(t, []string{"production", "production", "production", "production", "staging"}, envs)
+}
+
+func TestSubmitLogServiceAllowlist(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetServiceAllowlist(1, &ServiceAllowlist{Services: []string{"api", "worker"}})
+	SetServiceAllowlist(2, &ServiceAllowlist{Services: []string{"api"}, Fallback: "unknown"})
+	defer SetServiceAllowlist(1, nil)
+	defer SetServiceAllowlist(2, nil)
+
+	ctx := context.Background()
+	for _, projectID := range []int{1, 2} {
+		for _, service := range []string{"api", "bogus"} {
+			assert.NoError(t, submitLog(ctx, projectID, hlog.Log{Message: "hello", Attributes: map[string]string{"service.name": service}}))
+		}
+	}
+
+	var services []string
+	for _, s := range *submitted {
+		services = append(services, fmt.Sprintf("%d:%s", s.projectID, s.log.Attributes["service.name"]))
+	}
+	assert.Equal(t, []string{"1:api", "2:api", "2:unknown"}, services)
+}
+
+func TestLogBatchGroupsByProject(t *testing.T) {
+	var calls []int
+	submitHTTPLogs = func(_ context.Context, _ trace.Tracer, projectID int, logs []hlog.Log) []error {
+		calls = append(calls, projectID)
+		errs := make([]error, len(logs))
+		for idx, lg := range logs {
+			if lg.Message == "bad" {
+				errs[idx] = errors.New("bad log")
+			}
+		}
+		return errs
+	}
+	defer func() { submitHTTPLogs = submitHTTPLogBatch }()
+
+	batch := newLogBatch()
+	for _, l := range []struct {
+		projectID int
+		message   string
+	}{{1, "a"}, {2, "b"}, {1, "bad"}, {2, "c"}, {1, "d"}} {
+		batch.add(l.projectID, hlog.Log{Message: l.message})
+	}
+	errs := batch.submit(context.Background())
+
+	assert.Equal(t, []int{1, 2}, calls)
+	assert.Equal(t, 5, len(errs))
+	for idx, err := range errs {
+		if idx == 2 {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+type recordingSpan struct {
+	noop.Span
+	events int
+	status codes.Code
+}
+
+func (s *recordingSpan) AddEvent(string, ...trace.EventOption) {
+	s.events++
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) {
+	s.status = code
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, _ string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordingSpan{}
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func TestSubmitHTTPLogBatch(t *testing.T) {
+	logs := make([]hlog.Log, 300)
+	for idx := range logs {
+		logs[idx] = hlog.Log{Message: "hello", Timestamp: "2023-10-11T22:14:15.000Z", Level: "info"}
+	}
+	logs[10].Level = "error"
+	logs[20].Timestamp = "yesterday"
+
+	tracer := &recordingTracer{}
+	errs := submitHTTPLogBatch(context.Background(), tracer, 1, logs)
+	assert.Equal(t, 300, len(errs))
+	assert.Error(t, errs[20])
+	assert.NoError(t, firstError(append(errs[:20:20], errs[21:]...)))
+
+	var events, failed int
+	for _, span := range tracer.spans {
+		assert.LessOrEqual(t, span.events, maxSpanEvents)
+		events += span.events
+		if span.status == codes.Error {
+			failed++
+			assert.Equal(t, 1, span.events)
+		}
+	}
+	assert.Equal(t, 299, events)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, 4, len(tracer.spans))
+
+	assert.Nil(t, submitHTTPLogBatch(context.Background(), tracer, 1, nil))
+}
+
+func BenchmarkSubmitLogs(b *testing.B) {
+	logs := make([]hlog.Log, 1000)
+	for idx := range logs {
+		logs[idx] = hlog.Log{Message: "hello", Timestamp: "2023-10-11T22:14:15.000Z", Level: "info"}
+	}
+	ctx := context.Background()
+
+	b.Run("per log", func(b *testing.B) {
+		var calls int
+		submitHTTPLog = func(context.Context, trace.Tracer, int, hlog.Log) error {
+			calls++
+			return nil
+		}
+		defer func() { submitHTTPLog = hlog.SubmitHTTPLog }()
+		for i := 0; i < b.N; i++ {
+			for _, lg := range logs {
+				_ = submitLog(ctx, 1, lg)
+			}
+		}
+		b.ReportMetric(float64(calls)/float64(b.N), "submits/op")
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		var calls int
+		submitHTTPLogs = func(context.Context, trace.Tracer, int, []hlog.Log) []error {
+			calls++
+			return nil
+		}
+		defer func() { submitHTTPLogs = submitHTTPLogBatch }()
+		for i := 0; i < b.N; i++ {
+			_ = submitLogs(ctx, 1, logs)
+		}
+		b.ReportMetric(float64(calls)/float64(b.N), "submits/op")
+	})
+}
+
+func TestSubmitLogRedaction(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetRedactionPatterns(DefaultRedactionPatterns)
+	defer SetRedactionPatterns(nil)
+
+	ctx := context.Background()
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "charged 4111 1111 1111 1111 for jane.doe@example.com"}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "order 1234567890123 shipped"}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "auth header Bearer eyJhbGciOiJIUzI1NiJ9.e30.abc"}))
+
+	assert.Equal(t, "charged [REDACTED] for [REDACTED]", (*submitted)[0].log.Message)
+	// not a valid luhn checksum, so it is not treated as a card number
+	assert.Equal(t, "order 1234567890123 shipped", (*submitted)[1].log.Message)
+	assert.Equal(t, "auth header [REDACTED]", (*submitted)[2].log.Message)
+}
+
+func TestSubmitLogMessageTemplate(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetFingerprintRules(DefaultFingerprintRules)
+	defer SetFingerprintRules(nil)
+
+	ctx := context.Background()
+	for _, msg := range []string{
+		"user 42 failed to load 'settings' in 1.5s",
+		"user 99 failed to load 'billing' in 12.25s",
+		"request 0b9e5c2a-0f3e-4bf7-9f0c-3c1a2f3d4e5f took 0x1f ticks",
+	} {
+		assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: msg}))
+	}
+
+	assert.Equal(t, "user <num> failed to load <str> in <num>s", (*submitted)[0].log.Attributes[MessageTemplateAttribute])
+	assert.Equal(t, (*submitted)[0].log.Attributes[MessageTemplateAttribute], (*submitted)[1].log.Attributes[MessageTemplateAttribute])
+	assert.Equal(t, "request <uuid> took <hex> ticks", (*submitted)[2].log.Attributes[MessageTemplateAttribute])
+}
+
+func TestMinLevel(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetMinLevel(1, "info")
+	defer SetMinLevel(1, "")
+
+	level, ok := peekJSONLevel([]byte(`{"message":"hi","nested":{"level":"error"},"level" : "debug"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "debug", level)
+	_, ok = peekJSONLevel([]byte(`{"message":"level","nested":{"level":"error"}}`))
+	assert.False(t, ok)
+
+	body := `{"message":"dropped","level":"debug"}
+{"message":"kept","level":"warn"}
+{"message":"no level"}
+`
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	var messages []string
+	for _, s := range *submitted {
+		messages = append(messages, s.log.Message)
+	}
+	assert.Equal(t, []string{"kept", "no level"}, messages)
+
+	assert.NoError(t, submitLog(context.Background(), 1, hlog.Log{Message: "trace", Level: "trace"}))
+	assert.NoError(t, submitLog(context.Background(), 2, hlog.Log{Message: "other project", Level: "trace"}))
+	assert.Equal(t, "other project", (*submitted)[len(*submitted)-1].log.Message)
+	assert.Equal(t, 3, len(*submitted))
+}
+
+var debugLog = []byte(`{"message":"cache miss for key user:42","level":"debug","timestamp":"2023-10-11T22:14:15.123Z","service":"api","request":{"id":"abc","path":"/users/42","duration_ms":12.5},"tags":["cache","users"]}`)
+
+// BenchmarkDropDebugLog compares dropping a debug log by peeking at its level to extracting it first.
+func BenchmarkDropDebugLog(b *testing.B) {
+	SetMinLevel(1, "info")
+	defer SetMinLevel(1, "")
+	ctx := context.Background()
+
+	b.Run("peek", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if level, ok := peekJSONLevel(debugLog); !ok || !belowMinLevel(1, level) {
+				b.Fatal("expected the debug log to be dropped")
+			}
+		}
+	})
+	b.Run("parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			lg, err := parseJSONLog(ctx, debugLog)
+			if err != nil || !belowMinLevel(1, lg.Level) {
+				b.Fatal("expected the debug log to be dropped")
+			}
+		}
+	})
+}
+
+func TestSubmitLogHostMetadata(t *testing.T) {
+	submitted := captureSubmits(t)
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"web-1":{"datacenter":"us-east","team":"payments"}}`), 0600))
+	assert.NoError(t, LoadHostMetadataFile(path))
+	defer SetHostMetadata(nil)
+
+	ctx := context.Background()
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "a", Attributes: map[string]string{"host.name": "web-1", "team": "search"}}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "b", Attributes: map[string]string{"hostname": "web-1"}}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "c", Attributes: map[string]string{"host": "web-2"}}))
+
+	assert.Equal(t, "us-east", (*submitted)[0].log.Attributes["datacenter"])
+	assert.Equal(t, "search", (*submitted)[0].log.Attributes["team"])
+	assert.Equal(t, "us-east", (*submitted)[1].log.Attributes["datacenter"])
+	assert.NotContains(t, (*submitted)[2].log.Attributes, "datacenter")
+}
+
+func TestSubmitLogClockRegression(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetClockRegressionCheck(&ClockRegressionCheck{Threshold: time.Second})
+	defer SetClockRegressionCheck(nil)
+
+	ctx := context.Background()
+	for _, lg := range []struct {
+		service   string
+		timestamp string
+	}{
+		{"api", "2023-08-11T02:52:40.000Z"},
+		// within the threshold of the last timestamp
+		{"api", "2023-08-11T02:52:39.500Z"},
+		// a minute before the last timestamp
+		{"api", "2023-08-11T02:51:40.000Z"},
+		// other services are tracked separately
+		{"worker", "2023-08-11T02:50:00.000Z"},
+		{"api", "2023-08-11T02:52:41.000Z"},
+	} {
+		assert.NoError(t, submitLog(ctx, 1, hlog.Log{
+			Message:    "hello",
+			Timestamp:  lg.timestamp,
+			Attributes: map[string]string{"service.name": lg.service},
+		}))
+	}
+
+	assert.Equal(t, 5, len(*submitted))
+	var flagged []bool
+	for _, s := range *submitted {
+		flagged = append(flagged, s.log.Attributes[ClockRegressionAttribute] == "true")
+	}
+	assert.Equal(t, []bool{false, false, true, false, false}, flagged)
+}
+
+func TestSubmitLogFallbackAttributes(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetFallbackAttributes(map[string]string{"service.name": "unknown-firehose", "deployment.environment": "production"})
+	defer SetFallbackAttributes(nil)
+
+	ctx := context.Background()
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "bare message"}))
+	// handlers set the service name even when the request did not specify one
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "bare json", Attributes: map[string]string{"service.name": ""}}))
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "rich", Attributes: map[string]string{"service.name": "api", "user": "42"}}))
+
+	assert.Equal(t, 3, len(*submitted))
+	for _, s := range (*submitted)[:2] {
+		assert.Equal(t, "unknown-firehose", s.log.Attributes["service.name"], s.log.Message)
+		assert.Equal(t, "production", s.log.Attributes["deployment.environment"], s.log.Message)
+	}
+	assert.Equal(t, map[string]string{"service.name": "api", "user": "42"}, (*submitted)[2].log.Attributes)
+}
+
+func TestSubmitTimeout(t *testing.T) {
+	captureSubmits(t)
+	SetSubmitTimeout(20 * time.Millisecond)
+	defer SetSubmitTimeout(DefaultSubmitTimeout)
+
+	// a hanging downstream returns once its submit is aborted
+	aborted := make(chan error, 2)
+	submitHTTPLogs = func(ctx context.Context, _ trace.Tracer, _ int, logs []hlog.Log) []error {
+		<-ctx.Done()
+		aborted <- ctx.Err()
+		return nil
+	}
+
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"hello"}`))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"submit_timeout"`)
+	assert.ErrorIs(t, <-aborted, context.DeadlineExceeded)
+
+	w = httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest("hello"))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.ErrorIs(t, <-aborted, context.DeadlineExceeded)
+}
+
+func TestSubmitCancelled(t *testing.T) {
+	captureSubmits(t)
+	SetSubmitTimeout(0)
+	defer SetSubmitTimeout(DefaultSubmitTimeout)
+
+	started := make(chan struct{})
+	aborted := make(chan error, 1)
+	submitHTTPLogs = func(ctx context.Context, _ trace.Tracer, _ int, logs []hlog.Log) []error {
+		close(started)
+		<-ctx.Done()
+		aborted <- ctx.Err()
+		return nil
+	}
+
+	// a client that disconnects aborts its in-flight submit
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	errs := submitLogs(ctx, 1, []hlog.Log{{Message: "hello", Timestamp: time.Now().Format(hlog.TimestampFormat)}})
+	if assert.Equal(t, 1, len(errs)) {
+		assert.ErrorIs(t, errs[0], context.Canceled)
+	}
+	assert.ErrorIs(t, <-aborted, context.Canceled)
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const (
+	SumoCategoryHeader = "X-Sumo-Category"
+	SumoHostHeader     = "X-Sumo-Host"
+	SumoNameHeader     = "X-Sumo-Name"
+	SumoFieldsHeader   = "X-Sumo-Fields"
+)
+
+// sumoHeaderAttributes maps the sumo logic metadata headers to log attributes.
+var sumoHeaderAttributes = map[string]string{
+	SumoCategoryHeader: "source.category",
+	SumoHostHeader:     "source.host",
+	SumoNameHeader:     "source.name",
+}
+
+// getSumoProjectParams reads the project from the token of a sumo logic http source url,
+// `/v1/logs/sumo/<project>`, which is the only part of the source that collectors let users configure.
+func getSumoProjectParams(r *http.Request) (int, string, error) {
+	token := chi.URLParam(r, "token")
+	if r.Header.Get(LogDrainProjectHeader) != "" || token == "" {
+		return getProjectParams(r)
+	}
+	projectID, err := parseProjectID(token)
+	if err != nil {
+		auditAuthFailure(r, token, "invalid project")
+		log.WithContext(r.Context()).WithError(err).WithField("projectVerboseID", token).Error("failed to parse highlight project id from sumo logic source token")
+		return 0, "", err
+	}
+	serviceName, err := getHeader(r, LogDrainServiceHeader)
+	if err != nil {
+		return 0, "", err
+	}
+	return projectID, serviceName, nil
+}
+
+// sumoAttributes returns the attributes set by the metadata headers of a sumo logic request.
+// X-Sumo-Fields holds comma separated `key=value` pairs.
+func sumoAttributes(r *http.Request) (map[string]string, error) {
+	attributes := make(map[string]string)
+	for header, attribute := range sumoHeaderAttributes {
+		value, err := getHeader(r, header)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			attributes[attribute] = value
+		}
+	}
+	for _, field := range strings.Split(r.Header.Get(SumoFieldsHeader), ",") {
+		if k, v, ok := strings.Cut(field, "="); ok && strings.TrimSpace(k) != "" {
+			attributes[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return attributes, nil
+}
+
+// parseSumoLine parses a line of a sumo logic request, which is either a json object or raw text.
+func parseSumoLine(ctx context.Context, line string, now time.Time) hlog.Log {
+	if strings.HasPrefix(line, "{") && json.Valid([]byte(line)) {
+		if lg, err := parseJSONLog(ctx, []byte(line)); err == nil {
+			if lg.Timestamp == "" {
+				lg.Timestamp = now.Format(hlog.TimestampFormat)
+			}
+			return lg
+		}
+	}
+	return hlog.Log{
+		Attributes: map[string]string{},
+		Message:    line,
+		Timestamp:  now.Format(hlog.TimestampFormat),
+		Level:      inferLevel(line, nil),
+	}
+}
+
+// HandleSumoLogic ingests the requests of sumo logic http source clients, whose bodies hold one
+// raw or json log per line, stamping the sumo metadata headers as attributes.
+func HandleSumoLogic(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getSumoProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+	attributes, err := sumoAttributes(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http sumo logic gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http sumo logic body")
+		writeBodyError(w, err)
+		return
+	}
+	body = decodeText(body, r.Header.Get("Content-Type"))
+
+	now := time.Now().UTC()
+	var logs []hlog.Log
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lg := parseSumoLine(r.Context(), line, now)
+		for k, v := range attributes {
+			lg.Attributes[k] = v
+		}
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, lg)
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
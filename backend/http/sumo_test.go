@@ -0,0 +1,67 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const SumoLines = `{"message":"user signed in","level":"info","user":{"id":42}}
+level=error msg="payment failed" order=7
+
+{"message":"cache miss","level":"debug"}
+`
+
+func TestHandleSumoLogic(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/sumo/1", bytes.NewReader(compress(t, "gzip", SumoLines)))
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set(SumoCategoryHeader, "prod/checkout")
+	r.Header.Set(SumoHostHeader, "web-1")
+	r.Header.Set(SumoNameHeader, "app.log")
+	r.Header.Set(SumoFieldsHeader, "team=payments, region=eu")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	if assert.Equal(t, 3, len(*submitted)) {
+		first := (*submitted)[0]
+		assert.Equal(t, 1, first.projectID)
+		assert.Equal(t, "user signed in", first.log.Message)
+		assert.Equal(t, "42", first.log.Attributes["user.id"])
+		for _, s := range *submitted {
+			assert.Equal(t, "prod/checkout", s.log.Attributes["source.category"])
+			assert.Equal(t, "web-1", s.log.Attributes["source.host"])
+			assert.Equal(t, "app.log", s.log.Attributes["source.name"])
+			assert.Equal(t, "payments", s.log.Attributes["team"])
+			assert.Equal(t, "eu", s.log.Attributes["region"])
+		}
+
+		raw := (*submitted)[1].log
+		assert.Equal(t, `level=error msg="payment failed" order=7`, raw.Message)
+		assert.Equal(t, "error", raw.Level)
+		assert.Equal(t, "debug", (*submitted)[2].log.Level)
+	}
+}
+
+func TestHandleSumoLogicProject(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	// the project header takes precedence over the source token
+	r, _ := http.NewRequest("POST", "/v1/logs/sumo/not-a-project", strings.NewReader("hello"))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r, _ = http.NewRequest("POST", "/v1/logs/sumo", strings.NewReader("hello"))
+	w = httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 1, len(*submitted))
+}
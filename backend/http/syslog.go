@@ -0,0 +1,112 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/highlight-run/highlight/backend/otel"
+	"github.com/highlight-run/highlight/backend/private-graph/graph/model"
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func syslogLevel(severity uint8) string {
+	switch {
+	case severity <= 2:
+		// emergency, alert and critical
+		return model.LogLevelFatal.String()
+	case severity == 3:
+		return model.LogLevelError.String()
+	case severity == 4:
+		return model.LogLevelWarn.String()
+	case severity == 7:
+		return model.LogLevelDebug.String()
+	default:
+		// notice and informational
+		return model.LogLevelInfo.String()
+	}
+}
+
+// parseSyslogLine parses an RFC5424 or RFC3164 line with the syslog parsing of the otel log handler.
+// It returns false if the line is not syslog.
+func parseSyslogLine(line string, now time.Time) (*hlog.Log, bool) {
+	msg, ok := otel.ParseSyslog(line, now)
+	if !ok {
+		return nil, false
+	}
+	lg := hlog.Log{
+		Attributes: msg.Attributes,
+		Message:    msg.Message,
+		Timestamp:  now.UTC().Format(hlog.TimestampFormatNano),
+		Level:      model.LogLevelInfo.String(),
+	}
+	if msg.Severity != nil {
+		lg.Level = syslogLevel(*msg.Severity)
+	}
+	if !msg.Timestamp.IsZero() {
+		lg.Timestamp = msg.Timestamp.UTC().Format(hlog.TimestampFormatNano)
+	}
+	return &lg, true
+}
+
+// HandleSyslog ingests syslog lines, one per line of the body, in the RFC5424 format or the
+// BSD format of RFC3164. Lines that are not syslog are ingested as is.
+func HandleSyslog(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	requestBody, err := getBody(r)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http syslog gzip")
+		writeBodyError(w, err)
+		return
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("invalid http syslog body")
+		writeBodyError(w, err)
+		return
+	}
+	body = decodeText(body, r.Header.Get("Content-Type"))
+
+	now := time.Now().UTC()
+	var logs []hlog.Log
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lg, ok := parseSyslogLine(line, now)
+		if !ok {
+			lg = &hlog.Log{
+				Attributes: map[string]string{},
+				Message:    line,
+				Timestamp:  now.Format(hlog.TimestampFormat),
+				Level:      model.LogLevelInfo.String(),
+			}
+		}
+		if serviceName != "" {
+			lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+		}
+		logs = append(logs, *lg)
+	}
+
+	if err := firstError(submitLogs(r.Context(), projectID, logs)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to submit log")
+		http.Error(w, err.Error(), submitErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/highlight-run/highlight/backend/otel"
+)
+
+const SyslogLines = `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event log entry
+<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8
+
+<187>1 2003-10-11T22:14:16Z router - - - - link down
+not a syslog line
+`
+
+func TestParseSyslogLine(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	lg, ok := parseSyslogLine(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3"] An application event log entry`, now)
+	assert.True(t, ok)
+	assert.Equal(t, "An application event log entry", lg.Message)
+	assert.Equal(t, "info", lg.Level)
+	assert.Equal(t, "2003-10-11T22:14:15.003Z", lg.Timestamp)
+	assert.Equal(t, "mymachine.example.com", lg.Attributes["hostname"])
+	assert.Equal(t, "evntslog", lg.Attributes["app_name"])
+	assert.Equal(t, "1234", lg.Attributes["proc_id"])
+	assert.Equal(t, "ID47", lg.Attributes["msg_id"])
+	assert.Equal(t, "20", lg.Attributes["facility"])
+	assert.Equal(t, "165", lg.Attributes["priority"])
+	assert.Equal(t, "3", lg.Attributes["exampleSDID@32473.iut"])
+
+	// the standard structured data elements are mapped as by the otel log handler
+	lg, ok = parseSyslogLine(`<165>1 2003-10-11T22:14:15.003Z host app - - [timeQuality tzKnown="1" isSynced="0"][origin ip="192.0.2.1"] synced`, now)
+	assert.True(t, ok)
+	assert.Equal(t, "true", lg.Attributes["timeQuality.tzKnown"])
+	assert.Equal(t, "false", lg.Attributes["timeQuality.isSynced"])
+	assert.Equal(t, "192.0.2.1", lg.Attributes["origin.ip"])
+
+	// a bsd syslog line has no version or year, which is the one closest to now
+	lg, ok = parseSyslogLine("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8", now)
+	assert.True(t, ok)
+	assert.Equal(t, "'su root' failed for lonvick on /dev/pts/8", lg.Message)
+	assert.Equal(t, "fatal", lg.Level)
+	assert.Equal(t, "2024-10-11T22:14:15Z", lg.Timestamp)
+	assert.Equal(t, "mymachine", lg.Attributes["hostname"])
+	assert.Equal(t, "su", lg.Attributes["app_name"])
+	assert.Equal(t, "123", lg.Attributes["proc_id"])
+
+	for pri, level := range map[int]string{8: "fatal", 11: "error", 12: "warn", 13: "info", 14: "info", 15: "debug"} {
+		lg, ok := parseSyslogLine(fmt.Sprintf("<%d>1 2003-10-11T22:14:15Z host app - - - message", pri), now)
+		assert.True(t, ok)
+		assert.Equal(t, level, lg.Level, pri)
+	}
+
+	_, ok = parseSyslogLine("not a syslog line", now)
+	assert.False(t, ok)
+
+	// bsd timestamps are in the configured syslog timezone
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	otel.SetSyslogTimezone(loc)
+	defer otel.SetSyslogTimezone(nil)
+	lg, ok = parseSyslogLine("<34>Oct 11 22:14:15 mymachine su[123]: failed", now)
+	assert.True(t, ok)
+	assert.Equal(t, "2024-10-11T20:14:15Z", lg.Timestamp)
+}
+
+func TestHandleSyslog(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/syslog?%s=1&%s=appliance", LogDrainProjectQueryParam, LogDrainServiceQueryParam), strings.NewReader(SyslogLines))
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	if assert.Equal(t, 4, len(*submitted)) {
+		assert.Equal(t, "An application event log entry", (*submitted)[0].log.Message)
+		assert.Equal(t, "appliance", (*submitted)[0].log.Attributes["service.name"])
+		assert.Equal(t, "mymachine", (*submitted)[1].log.Attributes["hostname"])
+		assert.Equal(t, "link down", (*submitted)[2].log.Message)
+		assert.Equal(t, "error", (*submitted)[2].log.Level)
+		assert.Equal(t, "not a syslog line", (*submitted)[3].log.Message)
+	}
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+var normalizeText = true
+
+// SetNormalizeText sets whether the bodies of the text based endpoints are normalized from the
+// encodings written by windows agents, decoding utf-16 bodies, stripping byte order marks and
+// converting crlf line endings. It is enabled by default.
+func SetNormalizeText(enabled bool) {
+	normalizeText = enabled
+}
+
+// decodeUTF16 decodes a utf-16 body into utf-8, dropping a trailing odd byte.
+func decodeUTF16(body []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, len(body)/2)
+	for idx := range units {
+		units[idx] = order.Uint16(body[2*idx:])
+	}
+	decoded := make([]byte, 0, len(units))
+	for _, r := range utf16.Decode(units) {
+		decoded = utf8.AppendRune(decoded, r)
+	}
+	return decoded
+}
+
+// utf16Order returns the byte order of a utf-16 charset of the content type. A charset without
+// an order is big endian unless the body starts with a byte order mark.
+func utf16Order(contentType string) (binary.ByteOrder, bool) {
+	_, params, _ := mime.ParseMediaType(contentType)
+	switch strings.ToLower(params["charset"]) {
+	case "utf-16le":
+		return binary.LittleEndian, true
+	case "utf-16be", "utf-16":
+		return binary.BigEndian, true
+	}
+	return nil, false
+}
+
+// decodeText normalizes a text body to utf-8 with lf line endings, decoding utf-16 bodies that start
+// with a byte order mark or declare their charset, and stripping the utf-8 byte order marks that
+// start the body or any of its lines.
+func decodeText(body []byte, contentType string) []byte {
+	if !normalizeText {
+		return body
+	}
+	switch {
+	case bytes.HasPrefix(body, utf16LEBOM):
+		body = decodeUTF16(body[len(utf16LEBOM):], binary.LittleEndian)
+	case bytes.HasPrefix(body, utf16BEBOM):
+		body = decodeUTF16(body[len(utf16BEBOM):], binary.BigEndian)
+	default:
+		if order, ok := utf16Order(contentType); ok {
+			body = decodeUTF16(body, order)
+		}
+	}
+	body = bytes.TrimPrefix(body, utf8BOM)
+	body = bytes.ReplaceAll(body, append([]byte("\n"), utf8BOM...), []byte("\n"))
+	return bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeUTF16(s string, order binary.ByteOrder, bom bool) []byte {
+	var b bytes.Buffer
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xfeff}, units...)
+	}
+	for _, unit := range units {
+		_ = binary.Write(&b, order, unit)
+	}
+	return b.Bytes()
+}
+
+func TestDecodeText(t *testing.T) {
+	defer SetNormalizeText(true)
+
+	for _, tc := range []struct {
+		name        string
+		body        []byte
+		contentType string
+		expected    string
+	}{
+		{"crlf", []byte("first\r\nsecond\r\n"), "", "first\nsecond\n"},
+		{"utf-8 bom", []byte("\xef\xbb\xbfhello"), "", "hello"},
+		{"utf-8 bom per line", []byte("\xef\xbb\xbffirst\r\n\xef\xbb\xbfsecond"), "", "first\nsecond"},
+		{"utf-16 le", encodeUTF16("héllo\r\nwörld", binary.LittleEndian, true), "", "héllo\nwörld"},
+		{"utf-16 be", encodeUTF16("héllo", binary.BigEndian, true), "", "héllo"},
+		{"utf-16 le charset", encodeUTF16("héllo", binary.LittleEndian, false), "text/plain; charset=UTF-16LE", "héllo"},
+		{"lone carriage return", []byte("progress\r100%"), "", "progress\r100%"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(decodeText(tc.body, tc.contentType)))
+		})
+	}
+
+	SetNormalizeText(false)
+	assert.Equal(t, "\xef\xbb\xbffirst\r\n", string(decodeText([]byte("\xef\xbb\xbffirst\r\n"), "")))
+}
+
+func TestHandleWindowsText(t *testing.T) {
+	submitted := captureSubmits(t)
+	router := newTestRouter()
+	send := func(path string, contentType string, body []byte) {
+		r, _ := http.NewRequest("POST", path, bytes.NewReader(body))
+		r.Header.Set(LogDrainProjectHeader, "1")
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	send("/v1/logs/json", "application/x-ndjson", []byte("\xef\xbb\xbf{\"message\":\"first\"}\r\n{\"message\":\"second\"}\r\n"))
+	if assert.Equal(t, 2, len(*submitted)) {
+		assert.Equal(t, "first", (*submitted)[0].log.Message)
+		assert.Equal(t, "second", (*submitted)[1].log.Message)
+	}
+
+	*submitted = nil
+	send(fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), "", encodeUTF16("Exception in worker\r\n   at Worker.Run()", binary.LittleEndian, true))
+	if assert.Equal(t, 1, len(*submitted)) {
+		assert.Equal(t, "Exception in worker\n   at Worker.Run()", (*submitted)[0].log.Message)
+	}
+}
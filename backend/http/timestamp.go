@@ -0,0 +1,139 @@
+package http
+
+import (
+	"strconv"
+	"time"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 MST",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// epochTime interprets a numeric timestamp as seconds, milliseconds, microseconds or
+// nanoseconds since the epoch depending on its magnitude.
+func epochTime(v float64) time.Time {
+	switch {
+	case v > 1e17:
+		return time.Unix(0, int64(v)).UTC()
+	case v > 1e14:
+		return time.UnixMicro(int64(v)).UTC()
+	case v > 1e11:
+		return time.UnixMilli(int64(v)).UTC()
+	default:
+		sec := int64(v)
+		return time.Unix(sec, int64((v-float64(sec))*1e9)).UTC()
+	}
+}
+
+// parseTimestamp parses the string and numeric timestamp representations used by common log shippers.
+func parseTimestamp(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case float64:
+		return epochTime(t), true
+	case int64:
+		if t > 1e17 {
+			return time.Unix(0, t).UTC(), true
+		}
+		return epochTime(float64(t)), true
+	case string:
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts.UTC(), true
+			}
+		}
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return epochTime(f), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// TimestampPrecision controls the precision that log timestamps are formatted with before they are submitted.
+type TimestampPrecision int
+
+const (
+	// TimestampPrecisionNone submits timestamps as the handlers parsed them.
+	TimestampPrecisionNone TimestampPrecision = iota
+	// TimestampPrecisionMillisecond formats timestamps with hlog.TimestampFormat, truncating them to milliseconds.
+	TimestampPrecisionMillisecond
+	// TimestampPrecisionNanosecond formats timestamps with hlog.TimestampFormatNano, keeping up to nanoseconds.
+	TimestampPrecisionNanosecond
+)
+
+var timestampPrecision = TimestampPrecisionNone
+
+// SetTimestampPrecision formats every log timestamp in utc with the precision, so that downstream
+// storage receives a single canonical format whatever the source sent.
+func SetTimestampPrecision(precision TimestampPrecision) {
+	timestampPrecision = precision
+}
+
+// normalizeTimestamp reformats the timestamp of a log with the configured precision.
+// A timestamp that can not be parsed is left as is.
+func normalizeTimestamp(lg *hlog.Log) {
+	var layout string
+	switch timestampPrecision {
+	case TimestampPrecisionMillisecond:
+		layout = hlog.TimestampFormat
+	case TimestampPrecisionNanosecond:
+		layout = hlog.TimestampFormatNano
+	default:
+		return
+	}
+	if ts, ok := parseTimestamp(lg.Timestamp); ok {
+		lg.Timestamp = ts.Format(layout)
+	}
+}
+
+// TimestampCorrectedAttribute flags a log whose timestamp was outside the accepted window and was
+// replaced with the time it was received.
+const TimestampCorrectedAttribute = "highlight_timestamp_corrected"
+
+// TimestampWindow bounds how far the timestamp of a log may be from the time it is received.
+// A zero bound is not enforced.
+type TimestampWindow struct {
+	Future time.Duration
+	Past   time.Duration
+}
+
+var DefaultTimestampWindow = TimestampWindow{Future: time.Hour, Past: 30 * 24 * time.Hour}
+
+var timestampWindow = DefaultTimestampWindow
+
+// SetTimestampWindow replaces timestamps outside the window with the time the log is received,
+// so that clients with broken clocks do not write logs far into the future or past.
+// Passing a zero window disables it.
+func SetTimestampWindow(window TimestampWindow) {
+	timestampWindow = window
+}
+
+// clampTimestamp returns the receive time in place of a timestamp outside the window,
+// reporting whether it was clamped.
+func clampTimestamp(ts time.Time, now time.Time, window TimestampWindow) (time.Time, bool) {
+	if window.Future > 0 && ts.After(now.Add(window.Future)) {
+		return now, true
+	}
+	if window.Past > 0 && ts.Before(now.Add(-window.Past)) {
+		return now, true
+	}
+	return ts, false
+}
+
+// correctTimestamp replaces the timestamp of a log outside the configured window, marking it with
+// the TimestampCorrectedAttribute. A timestamp that can not be parsed is left as is.
+func correctTimestamp(lg *hlog.Log, now time.Time) {
+	ts, ok := parseTimestamp(lg.Timestamp)
+	if !ok {
+		return
+	}
+	if ts, clamped := clampTimestamp(ts, now, timestampWindow); clamped {
+		lg.Timestamp = ts.UTC().Format(hlog.TimestampFormatNano)
+		lg.Attributes[TimestampCorrectedAttribute] = "true"
+	}
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func TestNormalizeTimestamp(t *testing.T) {
+	defer SetTimestampPrecision(TimestampPrecisionNone)
+	expected := time.Date(2023, 10, 11, 22, 14, 15, 123456789, time.UTC)
+	inputs := []string{
+		"2023-10-11T22:14:15.123456789Z",
+		"2023-10-11T23:14:15.123456789+01:00",
+		"2023-10-11 22:14:15.123456789",
+	}
+
+	SetTimestampPrecision(TimestampPrecisionNone)
+	lg := hlog.Log{Timestamp: inputs[1]}
+	normalizeTimestamp(&lg)
+	assert.Equal(t, inputs[1], lg.Timestamp)
+
+	SetTimestampPrecision(TimestampPrecisionNanosecond)
+	for _, input := range inputs {
+		lg := hlog.Log{Timestamp: input}
+		normalizeTimestamp(&lg)
+		assert.Equal(t, "2023-10-11T22:14:15.123456789Z", lg.Timestamp, input)
+		ts, err := time.Parse(hlog.TimestampFormatNano, lg.Timestamp)
+		assert.NoError(t, err)
+		assert.True(t, expected.Equal(ts), input)
+	}
+
+	SetTimestampPrecision(TimestampPrecisionMillisecond)
+	for _, input := range inputs {
+		lg := hlog.Log{Timestamp: input}
+		normalizeTimestamp(&lg)
+		assert.Equal(t, "2023-10-11T22:14:15.123Z", lg.Timestamp, input)
+		// the millisecond format keeps the sub-second precision it has room for
+		ts, err := time.Parse(hlog.TimestampFormat, lg.Timestamp)
+		assert.NoError(t, err)
+		assert.True(t, expected.Truncate(time.Millisecond).Equal(ts), input)
+	}
+
+	// whole seconds keep the fixed millisecond width
+	lg = hlog.Log{Timestamp: "2023-10-11T22:14:15Z"}
+	normalizeTimestamp(&lg)
+	assert.Equal(t, "2023-10-11T22:14:15.000Z", lg.Timestamp)
+
+	lg = hlog.Log{Timestamp: "yesterday"}
+	normalizeTimestamp(&lg)
+	assert.Equal(t, "yesterday", lg.Timestamp)
+}
+
+func TestSubmitLogTimestampPrecision(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetTimestampPrecision(TimestampPrecisionMillisecond)
+	defer SetTimestampPrecision(TimestampPrecisionNone)
+
+	assert.NoError(t, submitLog(context.Background(), 1, hlog.Log{Message: "hello", Timestamp: "2023-10-11T22:14:15.123456789Z"}))
+	assert.Equal(t, "2023-10-11T22:14:15.123Z", (*submitted)[0].log.Timestamp)
+}
+
+func TestClampTimestamp(t *testing.T) {
+	now := time.Date(2023, 10, 11, 22, 14, 15, 0, time.UTC)
+	for _, tc := range []struct {
+		ts      time.Time
+		window  TimestampWindow
+		clamped bool
+	}{
+		{now, DefaultTimestampWindow, false},
+		{now.Add(59 * time.Minute), DefaultTimestampWindow, false},
+		{now.Add(61 * time.Minute), DefaultTimestampWindow, true},
+		{now.AddDate(3, 0, 0), DefaultTimestampWindow, true},
+		{now.AddDate(0, 0, -29), DefaultTimestampWindow, false},
+		{now.AddDate(0, 0, -31), DefaultTimestampWindow, true},
+		{now.AddDate(3, 0, 0), TimestampWindow{Past: time.Hour}, false},
+		{now.AddDate(-3, 0, 0), TimestampWindow{Future: time.Hour}, false},
+		{now.AddDate(-3, 0, 0), TimestampWindow{}, false},
+	} {
+		ts, clamped := clampTimestamp(tc.ts, now, tc.window)
+		assert.Equal(t, tc.clamped, clamped, tc.ts)
+		if clamped {
+			assert.Equal(t, now, ts)
+		} else {
+			assert.Equal(t, tc.ts, ts)
+		}
+	}
+}
+
+func TestSubmitLogTimestampWindow(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetTimestampWindow(DefaultTimestampWindow)
+
+	now := time.Now().UTC()
+	future := now.AddDate(2, 0, 0).Format(hlog.TimestampFormat)
+	recent := now.Add(-time.Minute).Format(hlog.TimestampFormat)
+	assert.NoError(t, submitLog(context.Background(), 1, hlog.Log{Message: "skewed", Timestamp: future}))
+	assert.NoError(t, submitLog(context.Background(), 1, hlog.Log{Message: "ok", Timestamp: recent}))
+
+	lg := (*submitted)[0].log
+	assert.Equal(t, "true", lg.Attributes[TimestampCorrectedAttribute])
+	ts, ok := parseTimestamp(lg.Timestamp)
+	assert.True(t, ok)
+	assert.WithinDuration(t, now, ts, time.Minute)
+
+	lg = (*submitted)[1].log
+	assert.Equal(t, recent, lg.Timestamp)
+	assert.NotContains(t, lg.Attributes, TimestampCorrectedAttribute)
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var requireTLS = struct {
+	enabled        bool
+	trustedProxies []*net.IPNet
+}{}
+
+// SetRequireTLS rejects logs sent over plaintext http when enabled. Requests from the trusted
+// proxies are accepted when their X-Forwarded-Proto is https, for setups terminating tls at a load balancer.
+func SetRequireTLS(enabled bool, trustedProxies []*net.IPNet) {
+	requireTLS.enabled = enabled
+	requireTLS.trustedProxies = trustedProxies
+}
+
+func isTLSRequest(r *http.Request, trustedProxies []*net.IPNet) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return isTrustedProxy(remoteIP(r), trustedProxies) &&
+		strings.EqualFold(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")), "https")
+}
+
+// RequireTLSMiddleware rejects plaintext requests with a 403. It does nothing unless enabled with SetRequireTLS.
+func RequireTLSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requireTLS.enabled && !isTLSRequest(r, requireTLS.trustedProxies) {
+			http.Error(w, "logs must be sent over https", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+const (
+	TLSVersionAttribute = "tls.version"
+	TLSCipherAttribute  = "tls.cipher"
+)
+
+var tlsAttributes bool
+
+// SetTLSAttributes stamps logs with the tls version and cipher suite negotiated by their request,
+// so that operators can audit the clients using weak tls.
+func SetTLSAttributes(enabled bool) {
+	tlsAttributes = enabled
+}
+
+// TLSAttributesMiddleware adds the TLSVersionAttribute and TLSCipherAttribute to every log of a tls request.
+// It does nothing unless enabled with SetTLSAttributes.
+func TLSAttributesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tlsAttributes && r.TLS != nil {
+			r = r.WithContext(withRequestAttributes(r.Context(), map[string]string{
+				TLSVersionAttribute: tls.VersionName(r.TLS.Version),
+				TLSCipherAttribute:  tls.CipherSuiteName(r.TLS.CipherSuite),
+			}))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
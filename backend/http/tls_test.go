@@ -0,0 +1,77 @@
+package http
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireTLS(t *testing.T) {
+	captureSubmits(t)
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	SetRequireTLS(true, []*net.IPNet{proxies})
+	defer SetRequireTLS(false, nil)
+
+	router := newTestRouter()
+	send := func(remoteAddr string, secure bool, forwardedProto string) int {
+		r := httptest.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("hello"))
+		r.RemoteAddr = remoteAddr
+		if secure {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if forwardedProto != "" {
+			r.Header.Set("X-Forwarded-Proto", forwardedProto)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// direct tls
+	assert.Equal(t, http.StatusOK, send("192.0.2.1:1234", true, ""))
+	assert.Equal(t, http.StatusForbidden, send("192.0.2.1:1234", false, ""))
+
+	// forwarded proto is only honored from trusted proxies
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", false, "https"))
+	assert.Equal(t, http.StatusForbidden, send("10.0.0.1:1234", false, "http"))
+	assert.Equal(t, http.StatusForbidden, send("192.0.2.1:1234", false, "https"))
+}
+
+func TestTLSAttributes(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetTLSAttributes(true)
+	defer SetTLSAttributes(false)
+
+	server := httptest.NewTLSServer(newTestRouter())
+	defer server.Close()
+	client := server.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.MaxVersion = tls.VersionTLS12
+	client.Transport.(*http.Transport).TLSClientConfig.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+
+	resp, err := client.Post(fmt.Sprintf("%s/v1/logs/raw?%s=1", server.URL, LogDrainProjectQueryParam), "text/plain", strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, 1, len(*submitted))
+	assert.Equal(t, "TLS 1.2", (*submitted)[0].log.Attributes[TLSVersionAttribute])
+	assert.Equal(t, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", (*submitted)[0].log.Attributes[TLSCipherAttribute])
+
+	// plaintext requests are not stamped
+	plain := httptest.NewServer(newTestRouter())
+	defer plain.Close()
+	resp, err = http.Post(fmt.Sprintf("%s/v1/logs/raw?%s=1", plain.URL, LogDrainProjectQueryParam), "text/plain", strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, 2, len(*submitted))
+	assert.NotContains(t, (*submitted)[1].log.Attributes, TLSVersionAttribute)
+	assert.NotContains(t, (*submitted)[1].log.Attributes, TLSCipherAttribute)
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const (
+	// TraceIDAttribute holds the 32 character hex trace id of a log.
+	TraceIDAttribute = "trace_id"
+	// SpanIDAttribute holds the 16 character hex span id of a log.
+	SpanIDAttribute = "span_id"
+)
+
+// traceIDKeys are the fields that loggers write trace ids to, in order of precedence.
+var traceIDKeys = []string{TraceIDAttribute, "traceId", "traceID", "trace.id", "otel.trace_id", "dd.trace_id"}
+
+// spanIDKeys are the fields that loggers write span ids to, in order of precedence.
+var spanIDKeys = []string{SpanIDAttribute, "spanId", "spanID", "span.id", "otel.span_id", "dd.span_id"}
+
+// isDatadogKey reports whether the field holds a datadog id, which is always decimal.
+func isDatadogKey(key string) bool {
+	return strings.HasPrefix(key, "dd.")
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeID returns the hex representation of an id of the given number of hex characters.
+// Hex ids are either of that width or 64 bit trace ids, which are left padded with zeros.
+// Other ids, and every id of a datadog field, are decimal 64 bit ids that are converted to hex.
+// Ids that are all zeros are invalid.
+func normalizeID(value string, width int, decimal bool) (string, bool) {
+	value = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "0x"))
+	if value == "" {
+		return "", false
+	}
+	var id string
+	if !decimal && (len(value) == width || len(value) == 16) && isHex(value) {
+		id = strings.Repeat("0", width-len(value)) + value
+	} else if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+		id = fmt.Sprintf("%0*x", width, n)
+	} else {
+		return "", false
+	}
+	if strings.Trim(id, "0") == "" {
+		return "", false
+	}
+	return id, true
+}
+
+func normalizeTraceID(key, value string) (string, bool) {
+	return normalizeID(value, 32, isDatadogKey(key))
+}
+
+func normalizeSpanID(key, value string) (string, bool) {
+	return normalizeID(value, 16, isDatadogKey(key))
+}
+
+// messageTraceFields returns the trace and span fields of a json message.
+func messageTraceFields(message string) map[string]string {
+	if !strings.HasPrefix(strings.TrimSpace(message), "{") {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &fields); err != nil {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, key := range append(append([]string{}, traceIDKeys...), spanIDKeys...) {
+		switch v := fields[key].(type) {
+		case string:
+			values[key] = v
+		case float64:
+			// json numbers lose precision past 2^53, so only smaller ids are usable
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return values
+}
+
+// findID returns the first of the keys holding a valid id, along with the key it was found in.
+func findID(fields map[string]string, keys []string, normalize func(key, value string) (string, bool)) (string, string, bool) {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			if id, ok := normalize(key, value); ok {
+				return key, id, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// applyTraceContext normalizes the trace and span ids of a log, found in its attributes or in its
+// json message, into the TraceIDAttribute and SpanIDAttribute so that the log is linked to its trace.
+// The attributes the ids were found in are replaced.
+func applyTraceContext(lg *hlog.Log) {
+	fields, fromAttributes := lg.Attributes, true
+	traceKey, traceID, ok := findID(fields, traceIDKeys, normalizeTraceID)
+	if !ok {
+		fields, fromAttributes = messageTraceFields(lg.Message), false
+		if traceKey, traceID, ok = findID(fields, traceIDKeys, normalizeTraceID); !ok {
+			return
+		}
+	}
+	spanKey, spanID, hasSpan := findID(fields, spanIDKeys, normalizeSpanID)
+
+	if fromAttributes {
+		delete(lg.Attributes, traceKey)
+		if hasSpan {
+			delete(lg.Attributes, spanKey)
+		}
+	}
+	lg.Attributes[TraceIDAttribute] = traceID
+	if hasSpan {
+		lg.Attributes[SpanIDAttribute] = spanID
+	}
+}
+
+// logSpanContext returns the span context of a log with a trace id, which its span is started in
+// so that the log is recorded as part of the trace.
+func logSpanContext(lg hlog.Log) (trace.SpanContext, bool) {
+	traceID, err := trace.TraceIDFromHex(lg.Attributes[TraceIDAttribute])
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	cfg := trace.SpanContextConfig{TraceID: traceID, Remote: true}
+	if spanID, err := trace.SpanIDFromHex(lg.Attributes[SpanIDAttribute]); err == nil {
+		cfg.SpanID = spanID
+	}
+	return trace.NewSpanContext(cfg), true
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func TestApplyTraceContext(t *testing.T) {
+	for _, tc := range []struct {
+		attributes map[string]string
+		message    string
+		traceID    string
+		spanID     string
+	}{
+		{map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"}, "", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{map[string]string{"traceId": "4BF92F3577B34DA6A3CE929D0E0E4736", "spanId": "00F067AA0BA902B7"}, "", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{map[string]string{"traceID": "0x4bf92f3577b34da6a3ce929d0e0e4736", "spanID": "0x00f067aa0ba902b7"}, "", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{map[string]string{"trace.id": "4bf92f3577b34da6a3ce929d0e0e4736", "span.id": "00f067aa0ba902b7"}, "", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{map[string]string{"otel.trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "otel.span_id": "00f067aa0ba902b7"}, "", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		// datadog ids are decimal
+		{map[string]string{"dd.trace_id": "1234567890123456789", "dd.span_id": "9876543210987654321"}, "", "0000000000000000112210f47de98115", "891087b8e3b70cb1"},
+		{map[string]string{"trace_id": "1234567890123456789"}, "", "0000000000000000112210f47de98115", ""},
+		// 64 bit hex trace ids are padded
+		{map[string]string{"trace_id": "a3ce929d0e0e4736"}, "", "0000000000000000a3ce929d0e0e4736", ""},
+		// the ids of a json message are used when the attributes have none
+		{map[string]string{}, `{"msg":"hello","traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7"}`, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{map[string]string{}, `{"msg":"hello","dd.trace_id":"1234567890123456789"}`, "0000000000000000112210f47de98115", ""},
+		// invalid ids are ignored
+		{map[string]string{"trace_id": "00000000000000000000000000000000"}, "", "", ""},
+		{map[string]string{"trace_id": "not-a-trace"}, "", "", ""},
+		{map[string]string{"trace_id": "123456789012345678901234567890"}, "", "", ""},
+		{map[string]string{"dd.trace_id": "4bf92f3577b34da6"}, "", "", ""},
+		{map[string]string{"span_id": "00f067aa0ba902b7"}, "", "", ""},
+	} {
+		attributes := make(map[string]string)
+		for k, v := range tc.attributes {
+			attributes[k] = v
+		}
+		lg := hlog.Log{Message: tc.message, Attributes: attributes}
+		applyTraceContext(&lg)
+		if tc.traceID == "" {
+			assert.Equal(t, tc.attributes, lg.Attributes)
+			continue
+		}
+		assert.Equal(t, tc.traceID, lg.Attributes[TraceIDAttribute], tc.attributes)
+		if tc.spanID == "" {
+			assert.NotContains(t, lg.Attributes, SpanIDAttribute, tc.attributes)
+		} else {
+			assert.Equal(t, tc.spanID, lg.Attributes[SpanIDAttribute], tc.attributes)
+		}
+		// the ids replace the fields they were found in
+		for k := range tc.attributes {
+			if k != TraceIDAttribute && k != SpanIDAttribute {
+				assert.NotContains(t, lg.Attributes, k)
+			}
+		}
+
+		spanCtx, ok := logSpanContext(lg)
+		assert.True(t, ok)
+		assert.Equal(t, tc.traceID, spanCtx.TraceID().String())
+	}
+}
+
+func TestHandleJSONLogTraceContext(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(`{"message":"charged","dd.trace_id":"1234567890123456789","dd.span_id":"9876543210987654321"}`))
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	HandleJSONLog(w, r)
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 1, len(*submitted)) {
+		lg := (*submitted)[0].log
+		assert.Equal(t, "0000000000000000112210f47de98115", lg.Attributes[TraceIDAttribute])
+		assert.Equal(t, "891087b8e3b70cb1", lg.Attributes[SpanIDAttribute])
+		assert.NotContains(t, lg.Attributes, "dd.trace_id")
+	}
+}
+
+func TestHandleFirehoseLogTraceContext(t *testing.T) {
+	submitted := captureSubmits(t)
+
+	cloudwatch := `{"messageType":"DATA_MESSAGE","logGroup":"/aws/lambda/checkout","logStream":"stream","logEvents":[{"id":"1","timestamp":1697062455123,"message":"{\"msg\":\"order placed\",\"trace_id\":\"4bf92f3577b34da6a3ce929d0e0e4736\",\"span_id\":\"00f067aa0ba902b7\"}"}]}`
+	w := httptest.NewRecorder()
+	HandleFirehoseLog(w, newFirehoseRequest(cloudwatch, "no trace here"))
+	assert.Equal(t, 200, w.Code)
+
+	if assert.Equal(t, 2, len(*submitted)) {
+		lg := (*submitted)[0].log
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", lg.Attributes[TraceIDAttribute])
+		assert.Equal(t, "00f067aa0ba902b7", lg.Attributes[SpanIDAttribute])
+		assert.NotContains(t, (*submitted)[1].log.Attributes, TraceIDAttribute)
+	}
+}
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+const TruncatedAttribute = "highlight.truncated"
+
+// AttributesSizeTruncatedAttribute marks a log whose largest attributes were dropped to fit the attributes size limit.
+const AttributesSizeTruncatedAttribute = "attributes_size_truncated"
+
+var messageLengthLimit = 0
+var attributeValueLengthLimit = hlog.LogAttributeValueLengthLimit
+var attributesSizeLimit = 0
+
+// SetMessageLengthLimit sets the maximum size in bytes of a log message. Zero disables the limit.
+func SetMessageLengthLimit(limit int) {
+	messageLengthLimit = limit
+}
+
+// SetAttributeValueLengthLimit sets the maximum size in bytes of a log attribute value. Zero disables the limit.
+func SetAttributeValueLengthLimit(limit int) {
+	attributeValueLengthLimit = limit
+}
+
+// SetAttributesSizeLimit sets the maximum total size in bytes of the keys and values of a log's
+// attributes. Zero disables the limit.
+func SetAttributesSizeLimit(limit int) {
+	attributesSizeLimit = limit
+}
+
+// LengthLimits overrides the global length limits for a project. A zero limit falls back to the global limit.
+type LengthLimits struct {
+	MessageLength        int
+	AttributeValueLength int
+	AttributesSize       int
+}
+
+var projectLengthLimits = struct {
+	sync.RWMutex
+	byProject map[int]LengthLimits
+}{byProject: make(map[int]LengthLimits)}
+
+// SetProjectLengthLimits overrides the length limits of a project. Passing nil removes the override.
+func SetProjectLengthLimits(projectID int, limits *LengthLimits) {
+	projectLengthLimits.Lock()
+	defer projectLengthLimits.Unlock()
+	if limits == nil {
+		delete(projectLengthLimits.byProject, projectID)
+		return
+	}
+	projectLengthLimits.byProject[projectID] = *limits
+}
+
+func getLengthLimits(projectID int) LengthLimits {
+	limits := LengthLimits{
+		MessageLength:        messageLengthLimit,
+		AttributeValueLength: attributeValueLengthLimit,
+		AttributesSize:       attributesSizeLimit,
+	}
+	projectLengthLimits.RLock()
+	override, ok := projectLengthLimits.byProject[projectID]
+	projectLengthLimits.RUnlock()
+	if !ok {
+		return limits
+	}
+	if override.MessageLength > 0 {
+		limits.MessageLength = override.MessageLength
+	}
+	if override.AttributeValueLength > 0 {
+		limits.AttributeValueLength = override.AttributeValueLength
+	}
+	if override.AttributesSize > 0 {
+		limits.AttributesSize = override.AttributesSize
+	}
+	return limits
+}
+
+// dropLargestAttributes drops the attributes with the largest values until the total size of the
+// keys and values fits the limit, returning the number of attributes dropped.
+func dropLargestAttributes(attributes map[string]string, limit int) int {
+	size := 0
+	for k, v := range attributes {
+		size += len(k) + len(v)
+	}
+	if size <= limit {
+		return 0
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(attributes[keys[i]]) != len(attributes[keys[j]]) {
+			return len(attributes[keys[i]]) > len(attributes[keys[j]])
+		}
+		return keys[i] < keys[j]
+	})
+	dropped := 0
+	for _, k := range keys {
+		if size <= limit {
+			break
+		}
+		size -= len(k) + len(attributes[k])
+		delete(attributes, k)
+		dropped++
+	}
+	return dropped
+}
+
+// truncateLog enforces the message, attribute value and attributes size limits of the project, marking
+// the log and counting the truncation in the request stats when anything was cut.
+func truncateLog(ctx context.Context, projectID int, lg *hlog.Log) {
+	stats := getIngestStats(ctx)
+	truncated := false
+	limits := getLengthLimits(projectID)
+
+	if limits.MessageLength > 0 && len(lg.Message) > limits.MessageLength {
+		lg.Message = hlog.TruncateUTF8(lg.Message, limits.MessageLength)
+		truncated = true
+		if stats != nil {
+			stats.messagesTruncated.Add(1)
+		}
+	}
+
+	if limits.AttributeValueLength > 0 {
+		for k, v := range lg.Attributes {
+			if len(v) > limits.AttributeValueLength {
+				lg.Attributes[k] = hlog.TruncateUTF8(v, limits.AttributeValueLength)
+				truncated = true
+				if stats != nil {
+					stats.attributesTruncated.Add(1)
+				}
+			}
+		}
+	}
+
+	if limits.AttributesSize > 0 {
+		if dropped := dropLargestAttributes(lg.Attributes, limits.AttributesSize); dropped > 0 {
+			lg.Attributes[AttributesSizeTruncatedAttribute] = "true"
+			truncated = true
+			if stats != nil {
+				stats.attributesTruncated.Add(int64(dropped))
+			}
+		}
+	}
+
+	if truncated {
+		lg.Attributes[TruncatedAttribute] = "true"
+	}
+}
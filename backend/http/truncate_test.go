@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	hlog "github.com/highlight/highlight/sdk/highlight-go/log"
+)
+
+func TestTruncationMarkers(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetMessageLengthLimit(16)
+	SetAttributeValueLengthLimit(32)
+	defer SetMessageLengthLimit(0)
+	defer SetAttributeValueLengthLimit(hlog.LogAttributeValueLengthLimit)
+
+	body := strings.Join([]string{
+		`{"message":"short","level":"info","timestamp":"2023-10-11T22:14:15.000Z"}`,
+		`{"message":"this message is far too long","level":"info","timestamp":"2023-10-11T22:14:15.000Z","blob":"abcdefghijklmnopqrstuvwxyz0123456789","tag":"ok"}`,
+		`{"message":"also far too long for the limit","level":"info","timestamp":"2023-10-11T22:14:15.000Z"}`,
+	}, "\n")
+	r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/json?%s=1", LogDrainProjectQueryParam), strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Header.Set(LogDrainProjectHeader, "1")
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "2", w.Header().Get(MessagesTruncatedHeader))
+	assert.Equal(t, "1", w.Header().Get(AttributesTruncatedHeader))
+	assert.Equal(t, 3, len(*submitted))
+
+	assert.NotContains(t, (*submitted)[0].log.Attributes, TruncatedAttribute)
+	lg := (*submitted)[1].log
+	assert.Equal(t, "this message is ", lg.Message)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz012345", lg.Attributes["blob"])
+	assert.Equal(t, "ok", lg.Attributes["tag"])
+	assert.Equal(t, "true", lg.Attributes[TruncatedAttribute])
+	assert.Equal(t, "true", (*submitted)[2].log.Attributes[TruncatedAttribute])
+}
+
+func TestProjectLengthLimits(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetMessageLengthLimit(16)
+	defer SetMessageLengthLimit(0)
+	SetProjectLengthLimits(2, &LengthLimits{MessageLength: 64})
+	defer SetProjectLengthLimits(2, nil)
+
+	ctx := context.Background()
+	message := "panic: runtime error: index out of range [3]"
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: message}))
+	assert.NoError(t, submitLog(ctx, 2, hlog.Log{Message: message}))
+
+	assert.Equal(t, "panic: runtime e", (*submitted)[0].log.Message)
+	assert.Equal(t, message, (*submitted)[1].log.Message)
+	assert.NotContains(t, (*submitted)[1].log.Attributes, TruncatedAttribute)
+}
+
+func TestTruncationAboveSDKAttributeLimit(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetProjectLengthLimits(2, &LengthLimits{AttributeValueLength: 2 * hlog.LogAttributeValueLengthLimit})
+	defer SetProjectLengthLimits(2, nil)
+
+	blob := strings.Repeat("a", hlog.LogAttributeValueLengthLimit+1000)
+	send := func(project string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/v1/logs/json", strings.NewReader(fmt.Sprintf(`{"message":"hi","blob":"%s"}`, blob)))
+		r.Header.Set(LogDrainProjectHeader, project)
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		return w
+	}
+
+	w := send("1")
+	assert.Equal(t, "1", w.Header().Get(AttributesTruncatedHeader))
+	assert.Equal(t, hlog.LogAttributeValueLengthLimit, len((*submitted)[0].log.Attributes["blob"]))
+	assert.Equal(t, "true", (*submitted)[0].log.Attributes[TruncatedAttribute])
+
+	w = send("2")
+	assert.Equal(t, "0", w.Header().Get(AttributesTruncatedHeader))
+	assert.Equal(t, blob, (*submitted)[1].log.Attributes["blob"])
+}
+
+func TestAttributesSizeLimit(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetAttributesSizeLimit(64)
+	defer SetAttributesSizeLimit(0)
+	SetProjectLengthLimits(2, &LengthLimits{AttributesSize: 1024})
+	defer SetProjectLengthLimits(2, nil)
+
+	attributes := func() map[string]string {
+		return map[string]string{
+			"request.body":    strings.Repeat("b", 40),
+			"response.body":   strings.Repeat("r", 30),
+			"user.id":         "42",
+			"service.name":    "checkout",
+			"deployment.tier": strings.Repeat("t", 10),
+		}
+	}
+	ctx := context.Background()
+	assert.NoError(t, submitLog(ctx, 1, hlog.Log{Message: "hello", Attributes: attributes()}))
+	assert.NoError(t, submitLog(ctx, 2, hlog.Log{Message: "hello", Attributes: attributes()}))
+
+	// the largest values are dropped first until the keys and values fit in 64 bytes
+	lg := (*submitted)[0].log
+	assert.NotContains(t, lg.Attributes, "request.body")
+	assert.NotContains(t, lg.Attributes, "response.body")
+	assert.Equal(t, "42", lg.Attributes["user.id"])
+	assert.Equal(t, "checkout", lg.Attributes["service.name"])
+	assert.Equal(t, strings.Repeat("t", 10), lg.Attributes["deployment.tier"])
+	assert.Equal(t, "true", lg.Attributes[AttributesSizeTruncatedAttribute])
+	assert.Equal(t, "true", lg.Attributes[TruncatedAttribute])
+
+	// the project override leaves room for every attribute
+	lg = (*submitted)[1].log
+	assert.Equal(t, attributes(), lg.Attributes)
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+// DefaultIgnoredUserAgents match the health probes of common load balancers and orchestrators.
+var DefaultIgnoredUserAgents = []*regexp.Regexp{
+	regexp.MustCompile(`^ELB-HealthChecker/`),
+	regexp.MustCompile(`^kube-probe/`),
+	regexp.MustCompile(`^GoogleHC/`),
+}
+
+var ignoredUserAgents = struct {
+	sync.RWMutex
+	patterns []*regexp.Regexp
+}{}
+
+// SetIgnoredUserAgents acknowledges requests whose User-Agent matches any of the patterns
+// without ingesting them. Passing nil disables it.
+func SetIgnoredUserAgents(patterns []*regexp.Regexp) {
+	ignoredUserAgents.Lock()
+	defer ignoredUserAgents.Unlock()
+	ignoredUserAgents.patterns = patterns
+}
+
+func isIgnoredUserAgent(userAgent string) bool {
+	ignoredUserAgents.RLock()
+	defer ignoredUserAgents.RUnlock()
+	for _, p := range ignoredUserAgents.patterns {
+		if p.MatchString(userAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoredUserAgentMiddleware responds with a 204 to health probes so that their bodies are not ingested.
+func IgnoredUserAgentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isIgnoredUserAgent(r.UserAgent()) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,32 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoredUserAgents(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetIgnoredUserAgents(DefaultIgnoredUserAgents)
+	defer SetIgnoredUserAgents(nil)
+
+	send := func(userAgent string) int {
+		r, _ := http.NewRequest("POST", fmt.Sprintf("/v1/logs/raw?%s=1", LogDrainProjectQueryParam), strings.NewReader("probe"))
+		r.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, send("ELB-HealthChecker/2.0"))
+	assert.Equal(t, http.StatusNoContent, send("kube-probe/1.27"))
+	assert.Equal(t, 0, len(*submitted))
+
+	assert.Equal(t, http.StatusOK, send("vector/0.32.0"))
+	assert.Equal(t, 1, len(*submitted))
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+const (
+	webSocketPongWait     = 60 * time.Second
+	webSocketPingInterval = 50 * time.Second
+	webSocketWriteWait    = 10 * time.Second
+)
+
+const defaultWebSocketReadLimit = 1 << 20
+
+var webSocketUpgrader = websocket.Upgrader{
+	CheckOrigin: checkWebSocketOrigin,
+}
+
+var webSocketReadLimit int64 = defaultWebSocketReadLimit
+var webSocketAllowedOrigins []string
+
+// SetWebSocketReadLimit caps the size in bytes of a single log frame. A non-positive limit restores the 1MiB default.
+func SetWebSocketReadLimit(limit int64) {
+	if limit <= 0 {
+		limit = defaultWebSocketReadLimit
+	}
+	webSocketReadLimit = limit
+}
+
+// SetWebSocketAllowedOrigins sets the browser origins allowed to open a log websocket, such as
+// "https://app.example.com". Non-browser clients without an Origin header and same-origin pages
+// are always allowed, and "*" allows any origin.
+func SetWebSocketAllowedOrigins(origins []string) {
+	webSocketAllowedOrigins = origins
+}
+
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range webSocketAllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocketAck is sent back for every log frame received over the websocket.
+type WebSocketAck struct {
+	Seq   int64  `json:"seq"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// HandleWebSocketLog streams json log frames over a websocket. The project is resolved from the
+// highlight headers or query string when the connection is upgraded, and every frame is acknowledged.
+func HandleWebSocketLog(w http.ResponseWriter, r *http.Request) {
+	projectID, serviceName, err := getProjectParams(r)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+
+	conn, err := webSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("failed to upgrade http logs websocket")
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(webSocketReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(webSocketPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteWait)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	var seq int64
+	for {
+		messageType, frame, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.WithContext(r.Context()).WithError(err).Warn("http logs websocket closed unexpectedly")
+			}
+			return
+		}
+		if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+			continue
+		}
+		seq++
+
+		ack := WebSocketAck{Seq: seq, OK: true}
+		lg, err := parseJSONLog(r.Context(), frame)
+		if err == nil {
+			if serviceName != "" {
+				lg.Attributes[string(semconv.ServiceNameKey)] = serviceName
+			}
+			err = submitLog(r.Context(), projectID, lg)
+		}
+		if err != nil {
+			ack = WebSocketAck{Seq: seq, Error: err.Error()}
+		}
+
+		_ = conn.SetWriteDeadline(time.Now().Add(webSocketWriteWait))
+		if err := conn.WriteJSON(ack); err != nil {
+			log.WithContext(r.Context()).WithError(err).Warn("failed to ack http logs websocket frame")
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleWebSocketLog(t *testing.T) {
+	submitted := captureSubmits(t)
+	server := httptest.NewServer(newTestRouter())
+	defer server.Close()
+
+	url := fmt.Sprintf("ws%s/v1/logs/ws?%s=1&%s=devtools", strings.TrimPrefix(server.URL, "http"), LogDrainProjectQueryParam, LogDrainServiceQueryParam)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+
+	frames := []string{
+		`{"message":"first","level":"info","timestamp":"2023-10-11T22:14:15.000Z"}`,
+		`not json`,
+		`{"message":"second","level":"warn","timestamp":"2023-10-11T22:14:16.000Z"}`,
+	}
+	for _, frame := range frames {
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(frame)))
+	}
+
+	var acks []WebSocketAck
+	for range frames {
+		var ack WebSocketAck
+		assert.NoError(t, conn.ReadJSON(&ack))
+		acks = append(acks, ack)
+	}
+	assert.True(t, acks[0].OK)
+	assert.False(t, acks[1].OK)
+	assert.NotEmpty(t, acks[1].Error)
+	assert.True(t, acks[2].OK)
+	assert.Equal(t, int64(3), acks[2].Seq)
+
+	assert.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	_ = conn.Close()
+
+	assert.Equal(t, 2, len(*submitted))
+	assert.Equal(t, "first", (*submitted)[0].log.Message)
+	assert.Equal(t, "devtools", (*submitted)[1].log.Attributes["service.name"])
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	captureSubmits(t)
+	server := httptest.NewServer(newTestRouter())
+	defer server.Close()
+	defer SetWebSocketAllowedOrigins(nil)
+
+	url := fmt.Sprintf("ws%s/v1/logs/ws?%s=1", strings.TrimPrefix(server.URL, "http"), LogDrainProjectQueryParam)
+	dial := func(origin string) (*http.Response, error) {
+		conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{origin}})
+		if err == nil {
+			_ = conn.Close()
+		}
+		return resp, err
+	}
+
+	_, err := dial(server.URL)
+	assert.NoError(t, err)
+
+	resp, err := dial("https://evil.example.com")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	SetWebSocketAllowedOrigins([]string{"https://app.example.com"})
+	_, err = dial("https://app.example.com")
+	assert.NoError(t, err)
+	_, err = dial("https://evil.example.com")
+	assert.Error(t, err)
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	submitted := captureSubmits(t)
+	SetWebSocketReadLimit(64)
+	defer SetWebSocketReadLimit(0)
+	server := httptest.NewServer(newTestRouter())
+	defer server.Close()
+
+	url := fmt.Sprintf("ws%s/v1/logs/ws?%s=1", strings.TrimPrefix(server.URL, "http"), LogDrainProjectQueryParam)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	frame := fmt.Sprintf(`{"message":%q}`, strings.Repeat("a", 128))
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(frame)))
+
+	var ack WebSocketAck
+	err = conn.ReadJSON(&ack)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+	assert.Empty(t, *submitted)
+}
@@ -7,15 +7,18 @@ import (
 	"html/template"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/marketplacemetering"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
@@ -201,6 +204,213 @@ func validateOrigin(_ *http.Request, origin string) bool {
 
 var defaultPort = "8082"
 
+func getEnvInt(key string) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.WithError(err).WithField("key", key).Error("invalid integer environment variable")
+	}
+	return i
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// configureHttpLogs applies the options of the http logs endpoints from the environment.
+func configureHttpLogs(redisClient *redis.Client) {
+	var trustedProxies []*net.IPNet
+	for _, cidr := range getEnvList("HTTP_LOGS_TRUSTED_PROXIES") {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.WithError(err).WithField("cidr", cidr).Error("invalid http logs trusted proxy")
+			continue
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+
+	highlightHttp.SetRequireTLS(os.Getenv("HTTP_LOGS_REQUIRE_TLS") == "true", trustedProxies)
+	highlightHttp.SetTLSAttributes(os.Getenv("HTTP_LOGS_TLS_ATTRIBUTES") == "true")
+	if os.Getenv("HTTP_LOGS_REJECT_DUPLICATE_HEADERS") == "true" {
+		highlightHttp.SetDuplicateHeaderMode(highlightHttp.DuplicateHeaderReject)
+	}
+	if logsPerSecond, err := strconv.ParseFloat(os.Getenv("HTTP_LOGS_IP_RATE_LIMIT"), 64); err == nil {
+		highlightHttp.SetIPRateLimit(&highlightHttp.IPRateLimit{
+			LogsPerSecond:  logsPerSecond,
+			Burst:          getEnvInt("HTTP_LOGS_IP_RATE_BURST"),
+			TrustedProxies: trustedProxies,
+		})
+	}
+	highlightHttp.SetProjectRateLimit(getEnvInt("HTTP_LOGS_PROJECT_RATE_LIMIT"), getEnvInt("HTTP_LOGS_PROJECT_RATE_BURST"))
+
+	if os.Getenv("HTTP_LOGS_AUDIT") == "false" {
+		highlightHttp.SetAuditSink(nil)
+	}
+	if size := getEnvInt("HTTP_LOGS_INGEST_ERRORS_SIZE"); size > 0 {
+		highlightHttp.SetIngestErrorsSize(size)
+	}
+	highlightHttp.SetIngestErrorsToken(os.Getenv("HTTP_LOGS_INGEST_ERRORS_TOKEN"))
+	if os.Getenv("HTTP_LOGS_INGEST_GATE") == "true" {
+		highlightHttp.SetIngestGate(highlightHttp.NewRedisIngestGate(redisClient.Client))
+	}
+	if limit := getEnvInt("HTTP_LOGS_DAILY_QUOTA"); limit > 0 {
+		highlightHttp.SetDailyQuota(highlightHttp.NewRedisQuotaTracker(redisClient.Client), int64(limit))
+	}
+	if os.Getenv("HTTP_LOGS_INGEST_SEQUENCE") == "true" {
+		highlightHttp.SetSequenceCounter(highlightHttp.NewRedisSequenceCounter(redisClient.Client))
+	}
+	highlightHttp.SetFirehoseAsync(getEnvInt("HTTP_LOGS_FIREHOSE_ASYNC_WORKERS"), getEnvInt("HTTP_LOGS_FIREHOSE_ASYNC_QUEUE_SIZE"))
+	if timeout, err := time.ParseDuration(os.Getenv("HTTP_LOGS_SUBMIT_TIMEOUT")); err == nil {
+		highlightHttp.SetSubmitTimeout(timeout)
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("HTTP_LOGS_FIREHOSE_DEDUP_TTL")); err == nil {
+		highlightHttp.SetFirehoseDedup(highlightHttp.NewMemoryDedupStore(getEnvInt("HTTP_LOGS_FIREHOSE_DEDUP_SIZE")), ttl)
+	}
+	if threshold, err := time.ParseDuration(os.Getenv("HTTP_LOGS_CLOCK_REGRESSION_THRESHOLD")); err == nil {
+		highlightHttp.SetClockRegressionCheck(&highlightHttp.ClockRegressionCheck{Threshold: threshold})
+	}
+
+	switch os.Getenv("HTTP_LOGS_TIMESTAMP_PRECISION") {
+	case "ms":
+		highlightHttp.SetTimestampPrecision(highlightHttp.TimestampPrecisionMillisecond)
+	case "ns":
+		highlightHttp.SetTimestampPrecision(highlightHttp.TimestampPrecisionNanosecond)
+	}
+	timestampWindow := highlightHttp.DefaultTimestampWindow
+	if future, err := time.ParseDuration(os.Getenv("HTTP_LOGS_TIMESTAMP_MAX_FUTURE")); err == nil {
+		timestampWindow.Future = future
+	}
+	if past, err := time.ParseDuration(os.Getenv("HTTP_LOGS_TIMESTAMP_MAX_PAST")); err == nil {
+		timestampWindow.Past = past
+	}
+	highlightHttp.SetTimestampWindow(timestampWindow)
+	switch os.Getenv("HTTP_LOGS_DEAD_LETTER") {
+	case "stdout":
+		highlightHttp.SetDeadLetterSink(highlightHttp.NewStdoutDeadLetterSink())
+	case "stderr":
+		highlightHttp.SetDeadLetterSink(highlightHttp.NewStderrDeadLetterSink())
+	}
+	if os.Getenv("HTTP_LOGS_SKIP_LAMBDA_PLATFORM_EVENTS") == "true" {
+		highlightHttp.SetSkipLambdaPlatformEvents(true)
+	}
+	if os.Getenv("HTTP_LOGS_KEEP_WINDOWS_TEXT") == "true" {
+		highlightHttp.SetNormalizeText(false)
+	}
+	if os.Getenv("HTTP_LOGS_METRICS_WITHOUT_PROJECT") == "true" {
+		highlightHttp.SetMetricsProjectLabel(false)
+	}
+	if os.Getenv("HTTP_LOGS_SERVER_TIMING") == "true" {
+		highlightHttp.SetServerTiming(true)
+	}
+	if header, ok := os.LookupEnv("HTTP_LOGS_API_KEY_HEADER"); ok {
+		highlightHttp.SetAPIKeyHeader(header)
+	}
+	if os.Getenv("HTTP_LOGS_QUERY_PARAMS") == "true" {
+		highlightHttp.SetQueryParams(true)
+	}
+	if os.Getenv("HTTP_LOGS_KEEP_EMPTY_MESSAGES") == "true" {
+		highlightHttp.SetDropEmptyMessages(false)
+	}
+	if os.Getenv("HTTP_LOGS_IGNORE_HEALTH_CHECKS") == "true" {
+		highlightHttp.SetIgnoredUserAgents(highlightHttp.DefaultIgnoredUserAgents)
+	}
+	if os.Getenv("HTTP_LOGS_MESSAGE_TEMPLATES") == "true" {
+		highlightHttp.SetFingerprintRules(highlightHttp.DefaultFingerprintRules)
+	}
+	if path := os.Getenv("HTTP_LOGS_HOST_METADATA_FILE"); path != "" {
+		if err := highlightHttp.LoadHostMetadataFile(path); err != nil {
+			log.WithError(err).WithField("path", path).Error("failed to load http logs host metadata")
+		}
+	}
+	highlightHttp.SetWebSocketAllowedOrigins(getEnvList("HTTP_LOGS_WEBSOCKET_ORIGINS"))
+	highlightHttp.SetWebSocketReadLimit(int64(getEnvInt("HTTP_LOGS_WEBSOCKET_READ_LIMIT")))
+	highlightHttp.SetMaxBodyBytes(int64(getEnvInt("HTTP_LOGS_MAX_BODY_BYTES")))
+	highlightHttp.SetMaxConcurrentDecompressions(getEnvInt("HTTP_LOGS_MAX_CONCURRENT_DECOMPRESSIONS"))
+	highlightHttp.SetRawRecordSeparator(os.Getenv("HTTP_LOGS_RAW_RECORD_SEPARATOR"))
+	if otlpEndpoint != "" {
+		highlightHttp.SetReadinessCheck(highlightHttp.NewDialReadinessCheck(otlpEndpoint, 2*time.Second))
+	}
+	switch os.Getenv("HTTP_LOGS_ARRAY_ATTRIBUTES") {
+	case "index":
+		highlightHttp.SetArrayAttributes(highlightHttp.ArrayAttributes{Default: highlightHttp.ArrayModeIndex})
+	case "join":
+		highlightHttp.SetArrayAttributes(highlightHttp.ArrayAttributes{Default: highlightHttp.ArrayModeJoin})
+	case "json":
+		highlightHttp.SetArrayAttributes(highlightHttp.ArrayAttributes{Default: highlightHttp.ArrayModeJSON})
+	}
+	if depth := getEnvInt("HTTP_LOGS_MAX_ATTRIBUTE_DEPTH"); depth > 0 {
+		highlightHttp.SetMaxAttributeDepth(depth)
+	}
+	highlightHttp.SetMaxAttributes(getEnvInt("HTTP_LOGS_MAX_ATTRIBUTES"))
+	highlightHttp.SetBodyProjectField(os.Getenv("HTTP_LOGS_BODY_PROJECT_FIELD"))
+	highlightHttp.SetGCPProjectAttribute(os.Getenv("HTTP_LOGS_GCP_PROJECT_ATTRIBUTE"))
+	if header := os.Getenv("HTTP_LOGS_OTLP_RESOURCE_ATTRIBUTES_HEADER"); header != "" {
+		otel.SetResourceAttributesHeader(header)
+	}
+	highlightHttp.SetDecodeField(os.Getenv("HTTP_LOGS_DECODE_FIELD"))
+	var fallbackAttributes map[string]string
+	for _, pair := range getEnvList("HTTP_LOGS_FALLBACK_ATTRIBUTES") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			if fallbackAttributes == nil {
+				fallbackAttributes = make(map[string]string)
+			}
+			fallbackAttributes[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	highlightHttp.SetFallbackAttributes(fallbackAttributes)
+	var bulkIndexServices map[string]string
+	for _, pair := range getEnvList("HTTP_LOGS_BULK_INDEX_SERVICES") {
+		if index, service, ok := strings.Cut(pair, "="); ok {
+			if bulkIndexServices == nil {
+				bulkIndexServices = make(map[string]string)
+			}
+			bulkIndexServices[strings.TrimSpace(index)] = strings.TrimSpace(service)
+		}
+	}
+	highlightHttp.SetBulkIndexServices(bulkIndexServices)
+	for _, endpoint := range getEnvList("HTTP_LOGS_REQUEST_LOGGING") {
+		path, rate, _ := strings.Cut(endpoint, "=")
+		sampleRate, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			sampleRate = 1
+		}
+		highlightHttp.SetRequestLogging(strings.TrimSpace(path), &highlightHttp.RequestLogging{SampleRate: sampleRate})
+	}
+	if bucket := os.Getenv("HTTP_LOGS_ARCHIVE_BUCKET"); bucket != "" {
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			log.WithError(err).Error("failed to load aws config for the http logs archive")
+		} else {
+			highlightHttp.SetS3Archive(&highlightHttp.S3Archive{
+				Client:        s3.NewFromConfig(cfg),
+				Bucket:        bucket,
+				Prefix:        os.Getenv("HTTP_LOGS_ARCHIVE_PREFIX"),
+				MaxBatchBytes: getEnvInt("HTTP_LOGS_ARCHIVE_BATCH_BYTES"),
+			})
+		}
+	}
+
+	if os.Getenv("OTEL_SANITIZE_ATTRIBUTE_KEYS") == "false" {
+		otel.SetSanitizeAttributeKeys(false)
+	}
+	if tz := os.Getenv("SYSLOG_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.WithError(err).WithField("timezone", tz).Error("invalid syslog timezone")
+		}
+		otel.SetSyslogTimezone(loc)
+	}
+}
+
 func main() {
 	rand.New(rand.NewSource(time.Now().UnixNano()))
 	ctx := context.TODO()
@@ -520,6 +730,7 @@ func main() {
 		otelHandler := otel.New(publicResolver)
 		otelHandler.Listen(r)
 		vercel.Listen(r, tracer)
+		configureHttpLogs(redisClient)
 		highlightHttp.Listen(r, tracer)
 	}
 
@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	model "github.com/highlight-run/highlight/backend/model"
 	modelInputs "github.com/highlight-run/highlight/backend/private-graph/graph/model"
@@ -21,6 +23,9 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 )
 
+// TraceSampledAttribute holds whether the trace of a log record was sampled.
+const TraceSampledAttribute = "trace.sampled"
+
 var ExternalHighlightData = e.New("dropping otel data from external highlight instance")
 var fluentProjectPattern = regexp.MustCompile(fmt.Sprintf(`%s=([\S]+)`, highlight.ProjectIDAttribute))
 
@@ -75,7 +80,9 @@ type extractFieldsParams struct {
 	event     *ptrace.SpanEvent
 	scopeLogs *plog.ScopeLogs
 	logRecord *plog.LogRecord
-	curTime   time.Time
+	// defaults are the project and service of a record that does not set its own
+	defaults logDefaults
+	curTime  time.Time
 }
 
 func extractFields(ctx context.Context, params extractFieldsParams) (*extractedFields, error) {
@@ -127,11 +134,22 @@ func extractFields(ctx context.Context, params extractFieldsParams) (*extractedF
 
 	if params.logRecord != nil {
 		fields.timestamp = params.logRecord.Timestamp().AsTime()
+		// collectors often only set the time the record was observed, which is closer than now
+		if params.logRecord.Timestamp() == 0 && params.logRecord.ObservedTimestamp() != 0 {
+			fields.timestamp = params.logRecord.ObservedTimestamp().AsTime()
+		}
 		fields.logSeverity = params.logRecord.SeverityText()
+		if fields.logSeverity == "" {
+			fields.logSeverity = severityNumberLevel(params.logRecord.SeverityNumber())
+		}
 		logAttributes = params.logRecord.Attributes().AsRaw()
+		// the sampled trace flag tells whether the trace of the record was recorded
+		if !params.logRecord.TraceID().IsEmpty() {
+			fields.attrs[TraceSampledAttribute] = strconv.FormatBool(params.logRecord.Flags().IsSampled())
+		}
 		// this could be a log record from syslog, with a projectID token prefix. ie:
 		// 1jdkoe52 <1>1 2023-07-27T05:43:22.401882Z render render-log-endpoint-test 1 render-log-endpoint-test - Render test log
-		fields.logBody = params.logRecord.Body().Str()
+		fields.logBody = logBodyString(params.logRecord.Body())
 		if len(fields.logBody) > 0 {
 			if fields.logBody[0] != '<' {
 				parts := strings.SplitN(fields.logBody, " <", 2)
@@ -288,6 +306,14 @@ func extractFields(ctx context.Context, params extractFieldsParams) (*extractedF
 		}
 	}
 
+	// the payload takes precedence over the headers of the request
+	if fields.projectID == "" {
+		fields.projectID = params.defaults.projectID
+	}
+	if fields.serviceName == "" {
+		fields.serviceName = params.defaults.serviceName
+	}
+
 	var err error
 	fields.projectIDInt, err = projectToInt(fields.projectID)
 
@@ -300,9 +326,80 @@ func extractFields(ctx context.Context, params extractFieldsParams) (*extractedF
 
 	fields.timestamp = graph.ClampTime(fields.timestamp, params.curTime)
 
+	if sanitizeAttributeKeys {
+		sanitizeAttrKeys(fields.attrs)
+	}
+
 	return fields, err
 }
 
+var sanitizeAttributeKeys = true
+
+// SetSanitizeAttributeKeys configures whether attribute keys are stripped of invalid UTF-8 and control characters.
+func SetSanitizeAttributeKeys(enabled bool) {
+	sanitizeAttributeKeys = enabled
+}
+
+// sanitizeAttrKey drops the invalid UTF-8 sequences and control characters of binary data leaking into a key.
+func sanitizeAttrKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(key, ""))
+}
+
+// sanitizeAttrKeys rewrites the keys that need sanitization. Attributes whose key is empty
+// once sanitized are dropped, and existing valid keys take precedence over rewritten ones.
+func sanitizeAttrKeys(attrs map[string]string) {
+	rewritten := make(map[string]string)
+	for k, v := range attrs {
+		if key := sanitizeAttrKey(k); key != k {
+			delete(attrs, k)
+			if key != "" {
+				rewritten[key] = v
+			}
+		}
+	}
+	for k, v := range rewritten {
+		if _, ok := attrs[k]; !ok {
+			attrs[k] = v
+		}
+	}
+}
+
+// severityNumberLevel maps the ranges of OTLP severity numbers to log levels.
+// An unspecified or out of range severity number has no level.
+func severityNumberLevel(severity plog.SeverityNumber) string {
+	switch {
+	case severity >= plog.SeverityNumberFatal && severity <= plog.SeverityNumberFatal4:
+		return modelInputs.LogLevelFatal.String()
+	case severity >= plog.SeverityNumberError:
+		return modelInputs.LogLevelError.String()
+	case severity >= plog.SeverityNumberWarn:
+		return modelInputs.LogLevelWarn.String()
+	case severity >= plog.SeverityNumberInfo:
+		return modelInputs.LogLevelInfo.String()
+	case severity >= plog.SeverityNumberDebug:
+		return modelInputs.LogLevelDebug.String()
+	case severity >= plog.SeverityNumberTrace:
+		return modelInputs.LogLevelTrace.String()
+	}
+	return ""
+}
+
+// logBodyString formats a log record body of any type. Maps and arrays are serialized as json,
+// and bytes are kept as text when they are valid utf-8 or base64 encoded otherwise.
+func logBodyString(body pcommon.Value) string {
+	if body.Type() == pcommon.ValueTypeBytes {
+		if b := body.Bytes().AsRaw(); utf8.Valid(b) {
+			return string(b)
+		}
+	}
+	return body.AsString()
+}
+
 func mergeMaps(maps ...map[string]any) map[string]any {
 	merged := make(map[string]any)
 
@@ -9,6 +9,7 @@ import (
 	"github.com/highlight/highlight/sdk/highlight-go"
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 )
@@ -380,3 +381,126 @@ func TestExtractFields_HandleInvalidTimestamp(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, curTime, fields.timestamp)
 }
+
+func TestExtractFields_LogBodyTypes(t *testing.T) {
+	resource := newResource(t, map[string]any{})
+	for name, tc := range map[string]struct {
+		setBody  func(body pcommon.Value)
+		expected string
+	}{
+		"string": {func(body pcommon.Value) { body.SetStr("hello") }, "hello"},
+		"kvlist": {func(body pcommon.Value) { body.SetEmptyMap().PutStr("user", "42") }, `{"user":"42"}`},
+		"array": {func(body pcommon.Value) {
+			s := body.SetEmptySlice()
+			s.AppendEmpty().SetStr("a")
+			s.AppendEmpty().SetInt(1)
+		}, `["a",1]`},
+		"bytes":        {func(body pcommon.Value) { body.SetEmptyBytes().FromRaw([]byte("hello")) }, "hello"},
+		"binary bytes": {func(body pcommon.Value) { body.SetEmptyBytes().FromRaw([]byte{0xff}) }, "/w=="},
+	} {
+		logRecord := plog.NewLogRecord()
+		tc.setBody(logRecord.Body())
+		fields, err := extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord})
+		assert.NoError(t, err, name)
+		assert.Equal(t, tc.expected, fields.logBody, name)
+	}
+}
+
+func TestExtractFields_SeverityNumber(t *testing.T) {
+	resource := newResource(t, map[string]any{})
+	for _, tc := range []struct {
+		severityText   string
+		severityNumber plog.SeverityNumber
+		expected       string
+	}{
+		{"", plog.SeverityNumberUnspecified, ""},
+		{"", 1, "trace"},
+		{"", 4, "trace"},
+		{"", 5, "debug"},
+		{"", 8, "debug"},
+		{"", 9, "info"},
+		{"", 12, "info"},
+		{"", 13, "warn"},
+		{"", 16, "warn"},
+		{"", 17, "error"},
+		{"", 20, "error"},
+		{"", 21, "fatal"},
+		{"", 24, "fatal"},
+		{"", 25, ""},
+		{"WARNING", 9, "WARNING"},
+	} {
+		logRecord := plog.NewLogRecord()
+		logRecord.SetSeverityText(tc.severityText)
+		logRecord.SetSeverityNumber(tc.severityNumber)
+		fields, err := extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, fields.logSeverity, "severity number %d", tc.severityNumber)
+	}
+}
+
+func TestExtractFields_SanitizeAttributeKeys(t *testing.T) {
+	resource := newResource(t, map[string]any{})
+	logRecord := plog.NewLogRecord()
+	logRecord.Attributes().PutStr("user\x00.id\x1b", "42")
+	logRecord.Attributes().PutStr("\x01\x02", "dropped")
+	logRecord.Attributes().PutStr("path\xff", "/")
+	logRecord.Attributes().PutStr("valid", "kept")
+
+	fields, err := extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"user.id": "42", "path": "/", "valid": "kept"}, fields.attrs)
+
+	SetSanitizeAttributeKeys(false)
+	defer SetSanitizeAttributeKeys(true)
+	fields, err = extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord})
+	assert.NoError(t, err)
+	assert.Equal(t, "42", fields.attrs["user\x00.id\x1b"])
+}
+
+func TestExtractFields_ObservedTimestamp(t *testing.T) {
+	curTime := time.Now().Truncate(time.Second).UTC()
+	observed := curTime.Add(-time.Minute)
+	resource := newResource(t, map[string]any{})
+
+	logRecord := plog.NewLogRecord()
+	logRecord.SetObservedTimestamp(pcommon.NewTimestampFromTime(observed))
+	fields, err := extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord, curTime: curTime})
+	assert.NoError(t, err)
+	assert.Equal(t, observed, fields.timestamp)
+
+	// the event time takes precedence over the observed time
+	logRecord.SetTimestamp(pcommon.NewTimestampFromTime(observed.Add(-time.Second)))
+	fields, err = extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord, curTime: curTime})
+	assert.NoError(t, err)
+	assert.Equal(t, observed.Add(-time.Second), fields.timestamp)
+
+	// without either time the record is stamped with the current time
+	logRecord = plog.NewLogRecord()
+	fields, err = extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord, curTime: curTime})
+	assert.NoError(t, err)
+	assert.Equal(t, curTime, fields.timestamp)
+}
+
+func TestExtractFields_TraceSampled(t *testing.T) {
+	resource := newResource(t, map[string]any{})
+	traceID := pcommon.TraceID([16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36})
+
+	logRecord := plog.NewLogRecord()
+	logRecord.SetTraceID(traceID)
+	logRecord.SetFlags(plog.DefaultLogRecordFlags.WithIsSampled(true))
+	fields, err := extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", fields.attrs[TraceSampledAttribute])
+
+	logRecord.SetFlags(plog.DefaultLogRecordFlags)
+	fields, err = extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord})
+	assert.NoError(t, err)
+	assert.Equal(t, "false", fields.attrs[TraceSampledAttribute])
+
+	// without a trace there is no sampling decision
+	logRecord = plog.NewLogRecord()
+	logRecord.SetFlags(plog.DefaultLogRecordFlags.WithIsSampled(true))
+	fields, err = extractFields(context.TODO(), extractFieldsParams{resource: &resource, logRecord: &logRecord})
+	assert.NoError(t, err)
+	assert.NotContains(t, fields.attrs, TraceSampledAttribute)
+}
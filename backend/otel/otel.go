@@ -5,7 +5,9 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
@@ -130,26 +132,52 @@ func getMetric(ctx context.Context, ts time.Time, fields *extractedFields, spanI
 	}, nil
 }
 
-func (o *Handler) HandleTrace(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	body, err := io.ReadAll(r.Body)
+var errUnsupportedEncoding = e.New("unsupported content encoding, only gzip is supported")
+
+// decodeBody decompresses an OTLP/HTTP request body according to its Content-Encoding. Bodies without
+// an encoding are sniffed for gzip to keep accepting clients that compress without setting the header.
+func decodeBody(r *http.Request, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "gzip":
+	case "", "identity":
+		if !bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+			return body, nil
+		}
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("invalid trace logBody")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+	return io.ReadAll(gz)
+}
+
+// writeDecodeError replies to a request whose body could not be decoded, advertising gzip
+// as the supported encoding when the request used another one.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnsupportedEncoding) {
+		w.Header().Set("Accept-Encoding", "gzip")
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
 		return
 	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
 
-	gz, err := gzip.NewReader(bytes.NewReader(body))
+func (o *Handler) HandleTrace(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("invalid gzip format for trace")
+		log.WithContext(ctx).WithError(err).Error("invalid trace logBody")
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	output, err := io.ReadAll(gz)
+	output, err := decodeBody(r, body)
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("invalid gzip stream for trace")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.WithContext(ctx).WithError(err).Error("invalid encoding for trace")
+		writeDecodeError(w, err)
 		return
 	}
 
@@ -397,31 +425,62 @@ func (o *Handler) HandleLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gz, err := gzip.NewReader(bytes.NewReader(body))
+	output, err := decodeBody(r, body)
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("invalid gzip format for log")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.WithContext(ctx).WithError(err).Error("invalid encoding for log")
+		writeDecodeError(w, err)
 		return
 	}
 
-	output, err := io.ReadAll(gz)
+	jsonEncoded := isJSONContentType(r.Header.Get("Content-Type"))
+	req := plogotlp.NewExportRequest()
+	if jsonEncoded {
+		// an export request decodes without error from json that only holds unknown fields,
+		// such as the bare log records written one per line by some collectors
+		if err = req.UnmarshalJSON(output); err != nil || req.Logs().ResourceLogs().Len() == 0 {
+			if records, recordsErr := parseLogRecordLines(output, getResourceAttributes(r)); recordsErr == nil {
+				req, err = records, nil
+			}
+		}
+	} else {
+		err = req.UnmarshalProto(output)
+	}
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("invalid gzip stream for log")
+		log.WithContext(ctx).WithError(err).Error("invalid otel log export request")
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	req := plogotlp.NewExportRequest()
-	err = req.UnmarshalProto(output)
-	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("invalid log protobuf")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	projectLogs, rejected := extractProjectLogs(ctx, req, getLogDefaults(r), time.Now())
+
+	if err := o.submitProjectLogs(ctx, projectLogs); err != nil {
+		log.WithContext(ctx).WithError(err).Error("failed to submit otel project logs")
+		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 
-	var projectLogs = make(map[string][]*clickhouse.LogRow)
+	writeLogsResponse(ctx, w, rejected, jsonEncoded)
+}
 
-	var curTime = time.Now()
+// logRejections counts the log records of an export request that could not be ingested.
+type logRejections struct {
+	count int64
+	err   error
+}
+
+func (r *logRejections) reject(err error) {
+	r.count++
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// extractProjectLogs maps the log records of an export request to log rows grouped by project,
+// counting the records that were rejected. The project and service of the request headers apply
+// to the records that do not set their own.
+func extractProjectLogs(ctx context.Context, req plogotlp.ExportRequest, defaults logDefaults, curTime time.Time) (map[string][]*clickhouse.LogRow, logRejections) {
+	var projectLogs = make(map[string][]*clickhouse.LogRow)
+	var rejected logRejections
 
 	resourceLogs := req.Logs().ResourceLogs()
 	for i := 0; i < resourceLogs.Len(); i++ {
@@ -436,16 +495,19 @@ func (o *Handler) HandleLog(w http.ResponseWriter, r *http.Request) {
 				fields, err := extractFields(ctx, extractFieldsParams{
 					resource:  &resource,
 					logRecord: &logRecord,
+					defaults:  defaults,
 					curTime:   curTime,
 				})
 				if err != nil {
 					lg(ctx, fields).WithError(err).Info("failed to extract fields from log")
+					rejected.reject(err)
 					continue
 				}
 
 				logRow := clickhouse.NewLogRow(
 					fields.timestamp, uint32(fields.projectIDInt),
 					clickhouse.WithTraceID(logRecord.TraceID().String()),
+					clickhouse.WithSpanID(logRecord.SpanID().String()),
 					clickhouse.WithSecureSessionID(fields.sessionID),
 					clickhouse.WithBody(ctx, fields.logBody),
 					clickhouse.WithLogAttributes(fields.attrs),
@@ -463,19 +525,57 @@ func (o *Handler) HandleLog(w http.ResponseWriter, r *http.Request) {
 					projectLogs[fields.projectID] = append(projectLogs[fields.projectID], logRow)
 				} else {
 					lg(ctx, fields).Errorf("otel log got no project")
+					rejected.reject(e.New("otel log got no project"))
 					continue
 				}
 			}
 		}
 	}
 
-	if err := o.submitProjectLogs(ctx, projectLogs); err != nil {
-		log.WithContext(ctx).WithError(err).Error("failed to submit otel project logs")
-		w.WriteHeader(http.StatusServiceUnavailable)
+	return projectLogs, rejected
+}
+
+// isJSONContentType reports whether an OTLP/HTTP request is json encoded rather than protobuf.
+// Json lines of bare log records are json encoded too.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(mediaType) {
+	case "application/json", "application/x-ndjson", "application/jsonl":
+		return true
+	}
+	return false
+}
+
+// writeLogsResponse replies with an OTLP export response, reporting rejected records as a partial success
+// so that compliant exporters do not retry the whole request. The response uses the encoding of the request.
+func writeLogsResponse(ctx context.Context, w http.ResponseWriter, rejected logRejections, jsonEncoded bool) {
+	resp := plogotlp.NewExportResponse()
+	if rejected.count > 0 {
+		resp.PartialSuccess().SetRejectedLogRecords(rejected.count)
+		resp.PartialSuccess().SetErrorMessage(rejected.err.Error())
+	}
+
+	contentType := "application/x-protobuf"
+	marshal := resp.MarshalProto
+	if jsonEncoded {
+		contentType = "application/json"
+		marshal = resp.MarshalJSON
+	}
+	body, err := marshal()
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("failed to marshal otel log response")
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.WithContext(ctx).WithError(err).Error("failed to write otel log response")
+	}
 }
 
 func (o *Handler) getQuotaExceededByProject(ctx context.Context, projectIds map[uint32]struct{}, productType model2.PricingProductType) (map[uint32]bool, error) {
@@ -533,6 +633,10 @@ func (o *Handler) getQuotaExceededByProject(ctx context.Context, projectIds map[
 }
 
 func (o *Handler) submitProjectLogs(ctx context.Context, projectLogs map[string][]*clickhouse.LogRow) error {
+	if len(projectLogs) == 0 {
+		return nil
+	}
+
 	projectIds := map[uint32]struct{}{}
 	for _, logRows := range projectLogs {
 		for _, logRow := range logRows {
@@ -655,6 +759,10 @@ func (o *Handler) Listen(r *chi.Mux) {
 		r.HandleFunc("/traces", o.HandleTrace)
 		r.HandleFunc("/logs", o.HandleLog)
 	})
+	// the canonical OTLP/HTTP logs path, so that standard exporters work when pointed at the base url.
+	// our own sdk json shape stays at /v1/logs/json.
+	r.With(highlightChi.Middleware).Post("/v1/logs", o.HandleLog)
+	r.With(highlightChi.Middleware).Post("/v1/logs/otlp", o.HandleLog)
 }
 
 func New(resolver *graph.Resolver) *Handler {
@@ -6,10 +6,13 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/highlight-run/highlight/backend/clickhouse"
 	"github.com/highlight-run/highlight/backend/integrations"
 	kafka_queue "github.com/highlight-run/highlight/backend/kafka-queue"
@@ -26,8 +29,13 @@ import (
 	"github.com/highlight-run/highlight/backend/model"
 	privateModel "github.com/highlight-run/highlight/backend/private-graph/graph/model"
 	public "github.com/highlight-run/highlight/backend/public-graph/graph"
+	"github.com/highlight/highlight/sdk/highlight-go"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 )
 
 type MockKafkaProducer struct {
@@ -211,3 +219,193 @@ func TestHandler_HandleTrace(t *testing.T) {
 	}
 
 }
+
+func TestExtractProjectLogsPartialSuccess(t *testing.T) {
+	ctx := context.Background()
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	accepted := records.AppendEmpty()
+	accepted.Body().SetStr("hello")
+	accepted.Attributes().PutStr(highlight.ProjectIDAttribute, "1")
+	records.AppendEmpty().Body().SetStr("no project")
+
+	projectLogs, rejected := extractProjectLogs(ctx, plogotlp.NewExportRequestFromLogs(logs), logDefaults{}, time.Now())
+	assert.Len(t, projectLogs["1"], 1)
+	assert.Equal(t, int64(1), rejected.count)
+
+	w := httptest.NewRecorder()
+	writeLogsResponse(ctx, w, rejected, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	resp := plogotlp.NewExportResponse()
+	assert.NoError(t, resp.UnmarshalProto(w.Body.Bytes()))
+	assert.Equal(t, int64(1), resp.PartialSuccess().RejectedLogRecords())
+	assert.NotEmpty(t, resp.PartialSuccess().ErrorMessage())
+}
+
+func TestHandler_HandleLogCanonicalPath(t *testing.T) {
+	logs := plog.NewLogs()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("no project")
+	body, err := plogotlp.NewExportRequestFromLogs(logs).MarshalJSON()
+	assert.NoError(t, err)
+
+	b := bytes.Buffer{}
+	gz := gzip.NewWriter(&b)
+	_, err = gz.Write(body)
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+
+	h := Handler{resolver: &public.Resolver{BatchedQueue: &MockKafkaProducer{}}}
+	router := chi.NewMux()
+	h.Listen(router)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/logs", &b)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	resp := plogotlp.NewExportResponse()
+	assert.NoError(t, resp.UnmarshalJSON(w.Body.Bytes()))
+	assert.Equal(t, int64(1), resp.PartialSuccess().RejectedLogRecords())
+}
+
+func TestHandler_HandleLogContentEncoding(t *testing.T) {
+	logs := plog.NewLogs()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("no project")
+	body, err := plogotlp.NewExportRequestFromLogs(logs).MarshalProto()
+	assert.NoError(t, err)
+
+	gzipped := bytes.Buffer{}
+	gz := gzip.NewWriter(&gzipped)
+	_, err = gz.Write(body)
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+
+	h := Handler{resolver: &public.Resolver{BatchedQueue: &MockKafkaProducer{}}}
+	router := chi.NewMux()
+	h.Listen(router)
+
+	for name, tc := range map[string]struct {
+		encoding string
+		body     []byte
+		expected int
+	}{
+		"gzip":        {"gzip", gzipped.Bytes(), http.StatusOK},
+		"identity":    {"", body, http.StatusOK},
+		"unsupported": {"br", body, http.StatusUnsupportedMediaType},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(tc.body))
+		r.Header.Set("Content-Type", "application/x-protobuf")
+		if tc.encoding != "" {
+			r.Header.Set("Content-Encoding", tc.encoding)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, tc.expected, w.Code, name)
+
+		if tc.expected == http.StatusOK {
+			resp := plogotlp.NewExportResponse()
+			assert.NoError(t, resp.UnmarshalProto(w.Body.Bytes()), name)
+			assert.Equal(t, int64(1), resp.PartialSuccess().RejectedLogRecords(), name)
+		} else {
+			assert.Equal(t, "gzip", w.Header().Get("Accept-Encoding"), name)
+		}
+	}
+}
+
+func TestParseLogRecordLines(t *testing.T) {
+	body := `{"timeUnixNano":"1697062455123000000","severityNumber":17,"body":{"stringValue":"payment failed"},"attributes":[{"key":"http.status_code","value":{"intValue":"502"}}]}
+{"observedTimeUnixNano":"1697062456000000000","severityText":"WARNING","body":{"stringValue":"slow response"}}
+[{"body":{"stringValue":"first of batch"}},{"body":{"stringValue":"second of batch"},"attributes":[{"key":"service.name","value":{"stringValue":"worker"}}]}]
+`
+	r := httptest.NewRequest(http.MethodPost, "/v1/logs", nil)
+	r.Header.Set(ResourceAttributesHeader, "highlight.project_id=1,service.name=checkout,deployment.environment=production%20eu")
+	req, err := parseLogRecordLines([]byte(body), getResourceAttributes(r))
+	assert.NoError(t, err)
+
+	projectLogs, rejected := extractProjectLogs(context.Background(), req, logDefaults{}, time.Now())
+	assert.Zero(t, rejected.count)
+	if assert.Len(t, projectLogs["1"], 4) {
+		first := projectLogs["1"][0]
+		assert.Equal(t, "payment failed", first.Body)
+		assert.Equal(t, "502", first.LogAttributes["http.status_code"])
+		assert.Equal(t, "checkout", first.ServiceName)
+		assert.Equal(t, "production eu", first.Environment)
+
+		assert.Equal(t, "WARNING", projectLogs["1"][1].SeverityText)
+		assert.Equal(t, "first of batch", projectLogs["1"][2].Body)
+		// record attributes take precedence over the resource
+		assert.Equal(t, "worker", projectLogs["1"][3].ServiceName)
+	}
+
+	_, err = parseLogRecordLines([]byte(`{"message":"not a record"}`), nil)
+	assert.Error(t, err)
+}
+
+func TestHandler_HandleLogRecordLines(t *testing.T) {
+	h := Handler{resolver: &public.Resolver{BatchedQueue: &MockKafkaProducer{}}}
+	router := chi.NewMux()
+	h.Listen(router)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader(`{"body":{"stringValue":"no project"}}`+"\n"))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	resp := plogotlp.NewExportResponse()
+	assert.NoError(t, resp.UnmarshalJSON(w.Body.Bytes()))
+	// the record was decoded, then rejected for having no project
+	assert.Equal(t, int64(1), resp.PartialSuccess().RejectedLogRecords())
+}
+
+func TestExtractProjectLogsDefaults(t *testing.T) {
+	ctx := context.Background()
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	traceID := pcommon.TraceID([16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36})
+	spanID := pcommon.SpanID([8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7})
+
+	defaulted := records.AppendEmpty()
+	defaulted.Body().SetStr("defaulted")
+	defaulted.SetTraceID(traceID)
+	defaulted.SetSpanID(spanID)
+	// the payload takes precedence over the headers
+	own := records.AppendEmpty()
+	own.Body().SetStr("own")
+	own.Attributes().PutStr(highlight.ProjectIDAttribute, "2")
+	own.Attributes().PutStr(string(semconv.ServiceNameKey), "worker")
+
+	projectLogs, rejected := extractProjectLogs(ctx, plogotlp.NewExportRequestFromLogs(logs), logDefaults{projectID: "1", serviceName: "checkout"}, time.Now())
+	assert.Zero(t, rejected.count)
+	if assert.Len(t, projectLogs["1"], 1) {
+		row := projectLogs["1"][0]
+		assert.Equal(t, "defaulted", row.Body)
+		assert.Equal(t, "checkout", row.ServiceName)
+		assert.Equal(t, traceID.String(), row.TraceId)
+		assert.Equal(t, spanID.String(), row.SpanId)
+	}
+	if assert.Len(t, projectLogs["2"], 1) {
+		assert.Equal(t, "worker", projectLogs["2"][0].ServiceName)
+	}
+}
+
+func TestHandler_HandleLogOTLPPath(t *testing.T) {
+	h := Handler{resolver: &public.Resolver{BatchedQueue: &MockKafkaProducer{}}}
+	router := chi.NewMux()
+	h.Listen(router)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/logs/otlp", strings.NewReader(`{"body":{"stringValue":"no project"}}`+"\n"))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := plogotlp.NewExportResponse()
+	assert.NoError(t, resp.UnmarshalJSON(w.Body.Bytes()))
+	assert.Equal(t, int64(1), resp.PartialSuccess().RejectedLogRecords())
+}
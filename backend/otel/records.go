@@ -0,0 +1,138 @@
+package otel
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	e "github.com/pkg/errors"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+)
+
+const (
+	// LogProjectHeader holds the project of the log records of a request that do not set one.
+	LogProjectHeader = "x-highlight-project"
+	// LogServiceHeader holds the service of the log records of a request that do not set one.
+	LogServiceHeader = "x-highlight-service"
+)
+
+// ResourceAttributesHeader is the default header holding the resource of bare log records,
+// in the `key=value,key=value` format of OTEL_RESOURCE_ATTRIBUTES.
+const ResourceAttributesHeader = "x-highlight-resource-attributes"
+
+var resourceAttributesHeader = ResourceAttributesHeader
+
+// SetResourceAttributesHeader sets the header holding the resource of bare log records.
+// Passing an empty header disables it.
+func SetResourceAttributesHeader(header string) {
+	resourceAttributesHeader = header
+}
+
+// logDefaults are the project and service of the log records of a request that do not set
+// their own, read from the request headers.
+type logDefaults struct {
+	projectID   string
+	serviceName string
+}
+
+func getLogDefaults(r *http.Request) logDefaults {
+	return logDefaults{
+		projectID:   strings.TrimSpace(r.Header.Get(LogProjectHeader)),
+		serviceName: strings.TrimSpace(r.Header.Get(LogServiceHeader)),
+	}
+}
+
+// logRecordFields are the fields of an otlp/json LogRecord, in the camel and snake case
+// spellings that the json encoding accepts.
+var logRecordFields = []string{
+	"timeUnixNano", "time_unix_nano",
+	"observedTimeUnixNano", "observed_time_unix_nano",
+	"severityNumber", "severity_number",
+	"severityText", "severity_text",
+	"body", "attributes",
+	"traceId", "trace_id",
+	"spanId", "span_id",
+}
+
+func isLogRecord(fields map[string]json.RawMessage) bool {
+	for _, field := range logRecordFields {
+		if _, ok := fields[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getResourceAttributes reads the resource attributes header of a request. Values may be percent encoded.
+func getResourceAttributes(r *http.Request) map[string]string {
+	attributes := make(map[string]string)
+	if resourceAttributesHeader == "" {
+		return attributes
+	}
+	for _, pair := range strings.Split(strings.Join(r.Header.Values(resourceAttributesHeader), ","), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+			v = unescaped
+		}
+		attributes[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return attributes
+}
+
+var errNotLogRecords = e.New("body does not hold otlp log records")
+
+// parseLogRecordLines wraps the bare log records of a json body, as written one per line by some
+// collectors, in an export request with the given resource. Each json value of the body is a
+// record or an array of records.
+func parseLogRecordLines(body []byte, resource map[string]string) (plogotlp.ExportRequest, error) {
+	var records []json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return plogotlp.ExportRequest{}, err
+		}
+		batch := []json.RawMessage{value}
+		if bytes.HasPrefix(value, []byte("[")) {
+			if err := json.Unmarshal(value, &batch); err != nil {
+				return plogotlp.ExportRequest{}, err
+			}
+		}
+		for _, record := range batch {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(record, &fields); err != nil || !isLogRecord(fields) {
+				return plogotlp.ExportRequest{}, errNotLogRecords
+			}
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return plogotlp.ExportRequest{}, errNotLogRecords
+	}
+
+	wrapped, err := json.Marshal(map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}},
+		}},
+	})
+	if err != nil {
+		return plogotlp.ExportRequest{}, err
+	}
+	req := plogotlp.NewExportRequest()
+	if err := req.UnmarshalJSON(wrapped); err != nil {
+		return plogotlp.ExportRequest{}, err
+	}
+	attributes := req.Logs().ResourceLogs().At(0).Resource().Attributes()
+	for k, v := range resource {
+		attributes.PutStr(k, v)
+	}
+	return req, nil
+}
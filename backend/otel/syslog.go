@@ -2,49 +2,170 @@ package otel
 
 import (
 	"strconv"
+	"time"
 
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/influxdata/go-syslog/v3/rfc3164"
 	"github.com/influxdata/go-syslog/v3/rfc5424"
 	"go.opentelemetry.io/collector/pdata/plog"
 )
 
-func extractSyslog(fields *extractedFields) {
+var syslogTimezone = time.UTC
+
+// SetSyslogTimezone sets the timezone of RFC3164 syslog timestamps, which carry no offset. nil restores UTC.
+func SetSyslogTimezone(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	syslogTimezone = loc
+}
+
+// inferSyslogYear places an RFC3164 timestamp, which has no year, in the year closest to now.
+// A December message received in January belongs to the previous year and a January message
+// received in late December, from a clock running ahead, to the next one.
+func inferSyslogYear(ts time.Time, now time.Time, loc *time.Location) time.Time {
+	now = now.In(loc)
+	year := now.Year()
+	if ts.Month() == time.December && now.Month() == time.January {
+		year--
+	} else if ts.Month() == time.January && now.Month() == time.December {
+		year++
+	}
+	return time.Date(year, ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), loc)
+}
+
+// syslogStandardParams names the attributes of the params of the standard RFC5424 SD-IDs.
+var syslogStandardParams = map[string]map[string]string{
+	"timeQuality": {
+		"tzKnown":      "timeQuality.tzKnown",
+		"isSynced":     "timeQuality.isSynced",
+		"syncAccuracy": "timeQuality.syncAccuracy",
+	},
+	"origin": {
+		"ip":           "origin.ip",
+		"enterpriseId": "origin.enterpriseId",
+		"software":     "origin.software",
+		"swVersion":    "origin.swVersion",
+	},
+	"meta": {
+		"sequenceId": "meta.sequenceId",
+		"sysUpTime":  "meta.sysUpTime",
+		"language":   "meta.language",
+	},
+}
+
+// syslogFlagParams are the standard params holding a 0 or 1 flag, stored as booleans.
+var syslogFlagParams = map[string]bool{"timeQuality.tzKnown": true, "timeQuality.isSynced": true}
+
+// extractSyslogStructuredData maps the params of the standard SD-IDs to their attributes and
+// flattens the params of any other SD-ID as `sdid.param`.
+func extractSyslogStructuredData(fields *extractedFields, structuredData map[string]map[string]string) {
+	for sdID, params := range structuredData {
+		standard := syslogStandardParams[sdID]
+		for k, v := range params {
+			key, ok := standard[k]
+			if !ok {
+				fields.attrs[sdID+"."+k] = v
+				continue
+			}
+			if syslogFlagParams[key] {
+				v = strconv.FormatBool(v == "1")
+			}
+			fields.attrs[key] = v
+		}
+	}
+}
+
+func extractSyslogBase(fields *extractedFields, msg *syslog.Base) {
+	if msg.Message != nil {
+		fields.logBody = *msg.Message
+	}
+	if msg.Facility != nil {
+		fields.attrs["facility"] = strconv.Itoa(int(*msg.Facility))
+	}
+	if msg.Severity != nil {
+		fields.logSeverity = plog.SeverityNumber(*msg.Severity).String()
+	}
+	if msg.Priority != nil {
+		fields.attrs["priority"] = strconv.Itoa(int(*msg.Priority))
+	}
+	if msg.Timestamp != nil {
+		fields.timestamp = *msg.Timestamp
+	}
+	if msg.Hostname != nil {
+		fields.attrs["hostname"] = *msg.Hostname
+	}
+	if msg.Appname != nil {
+		fields.attrs["app_name"] = *msg.Appname
+	}
+	if msg.ProcID != nil {
+		fields.attrs["proc_id"] = *msg.ProcID
+	}
+	if msg.MsgID != nil {
+		fields.attrs["msg_id"] = *msg.MsgID
+	}
+}
+
+// parseSyslog parses an RFC5424 line, falling back to the BSD format of RFC3164 whose timestamp
+// is placed in the year closest to now in the syslog timezone. It returns false if the line is not syslog.
+func parseSyslog(line string, now time.Time) (*syslog.Base, *map[string]map[string]string, bool) {
 	p := rfc5424.NewParser(rfc5424.WithBestEffort())
-	message, err := p.Parse([]byte(fields.logBody))
+	message, err := p.Parse([]byte(line))
 	if msg, ok := message.(*rfc5424.SyslogMessage); err == nil && ok {
-		if msg.Message != nil {
-			fields.logBody = *msg.Message
-		}
-		if msg.Facility != nil {
-			fields.attrs["facility"] = strconv.Itoa(int(*msg.Facility))
-		}
-		if msg.Severity != nil {
-			fields.logSeverity = plog.SeverityNumber(*msg.Severity).String()
-		}
-		if msg.Priority != nil {
-			fields.attrs["priority"] = strconv.Itoa(int(*msg.Priority))
-		}
+		return &msg.Base, msg.StructuredData, true
+	}
+
+	// fall back to the BSD syslog format still sent by many network devices and older daemons
+	p = rfc3164.NewParser(rfc3164.WithBestEffort())
+	message, err = p.Parse([]byte(line))
+	if msg, ok := message.(*rfc3164.SyslogMessage); err == nil && ok {
 		if msg.Timestamp != nil {
-			fields.timestamp = *msg.Timestamp
-		}
-		if msg.Hostname != nil {
-			fields.attrs["hostname"] = *msg.Hostname
-		}
-		if msg.Appname != nil {
-			fields.attrs["app_name"] = *msg.Appname
-		}
-		if msg.ProcID != nil {
-			fields.attrs["proc_id"] = *msg.ProcID
-		}
-		if msg.MsgID != nil {
-			fields.attrs["msg_id"] = *msg.MsgID
+			ts := inferSyslogYear(*msg.Timestamp, now, syslogTimezone)
+			msg.Timestamp = &ts
 		}
-		if msg.StructuredData != nil {
+		return &msg.Base, nil, true
+	}
+	return nil, nil, false
+}
 
-			for topLevelKey, vMap := range *msg.StructuredData {
-				for k, v := range vMap {
-					fields.attrs[topLevelKey+"."+k] = v
-				}
-			}
-		}
+func extractSyslog(fields *extractedFields) {
+	base, structuredData, ok := parseSyslog(fields.logBody, time.Now())
+	if !ok {
+		return
+	}
+	extractSyslogBase(fields, base)
+	if structuredData != nil {
+		extractSyslogStructuredData(fields, *structuredData)
+	}
+}
+
+// SyslogMessage is a parsed syslog line.
+type SyslogMessage struct {
+	Message string
+	// Severity is the severity of the priority of the line, from 0 for emergency to 7 for debug.
+	Severity *uint8
+	// Timestamp is zero when the line has no timestamp.
+	Timestamp time.Time
+	// Attributes holds the header fields and the structured data of the line.
+	Attributes map[string]string
+}
+
+// ParseSyslog parses a syslog line as the otel log handler does, so that the other endpoints
+// receiving syslog ingest the same logs. It returns false if the line is not syslog.
+func ParseSyslog(line string, now time.Time) (*SyslogMessage, bool) {
+	base, structuredData, ok := parseSyslog(line, now)
+	if !ok {
+		return nil, false
+	}
+	fields := newExtractedFields()
+	extractSyslogBase(fields, base)
+	if structuredData != nil {
+		extractSyslogStructuredData(fields, *structuredData)
 	}
+	return &SyslogMessage{
+		Message:    fields.logBody,
+		Severity:   base.Severity,
+		Timestamp:  fields.timestamp,
+		Attributes: fields.attrs,
+	}, true
 }
@@ -2,6 +2,7 @@ package otel
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,3 +27,56 @@ func Test_extractSyslogWithStructuredData(t *testing.T) {
 	assert.Equal(t, "Application", fields.attrs["exampleSDID@32473.eventSource"])
 	assert.Equal(t, "1011", fields.attrs["exampleSDID@32473.eventID"])
 }
+
+func Test_extractSyslogStandardStructuredData(t *testing.T) {
+	fields := newExtractedFields()
+
+	fields.logBody = `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [origin ip="192.0.2.1" software="rsyslogd" swVersion="8.2102.0"][meta sequenceId="29" sysUpTime="123456"][timeQuality tzKnown="1" isSynced="0"][exampleSDID@32473 iut="3"] An application event log entry`
+	extractSyslog(fields)
+	assert.Equal(t, "An application event log entry", fields.logBody)
+	assert.Equal(t, "192.0.2.1", fields.attrs["origin.ip"])
+	assert.Equal(t, "rsyslogd", fields.attrs["origin.software"])
+	assert.Equal(t, "8.2102.0", fields.attrs["origin.swVersion"])
+	assert.Equal(t, "29", fields.attrs["meta.sequenceId"])
+	assert.Equal(t, "123456", fields.attrs["meta.sysUpTime"])
+	assert.Equal(t, "true", fields.attrs["timeQuality.tzKnown"])
+	assert.Equal(t, "false", fields.attrs["timeQuality.isSynced"])
+	assert.Equal(t, "3", fields.attrs["exampleSDID@32473.iut"])
+}
+
+func Test_extractSyslogRFC3164(t *testing.T) {
+	fields := newExtractedFields()
+
+	fields.logBody = "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8"
+	extractSyslog(fields)
+	assert.Equal(t, "mymachine", fields.attrs["hostname"])
+	assert.Equal(t, "su", fields.attrs["app_name"])
+	assert.Equal(t, "123", fields.attrs["proc_id"])
+	assert.Equal(t, "'su root' failed for lonvick on /dev/pts/8", fields.logBody)
+	assert.Equal(t, time.October, fields.timestamp.Month())
+	assert.Equal(t, 22, fields.timestamp.Hour())
+}
+
+func Test_inferSyslogYear(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	}
+
+	for _, tc := range []struct {
+		ts       time.Time
+		now      time.Time
+		expected int
+	}{
+		{at(0, time.October, 11), at(2023, time.October, 11), 2023},
+		{at(0, time.December, 31), at(2024, time.January, 1), 2023},
+		{at(0, time.January, 1), at(2023, time.December, 31), 2024},
+	} {
+		ts := inferSyslogYear(tc.ts, tc.now, loc)
+		assert.Equal(t, tc.expected, ts.Year())
+		assert.Equal(t, tc.ts.Month(), ts.Month())
+		assert.Equal(t, 12, ts.Hour())
+		assert.Equal(t, loc, ts.Location())
+	}
+}
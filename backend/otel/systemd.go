@@ -11,8 +11,13 @@ const Message SystemdKey = "MESSAGE"
 const Priority SystemdKey = "PRIORITY"
 
 func extractSystemd(fields *extractedFields, m map[string]any) {
-	fields.logBody = m[Message].(string)
-	if priority, err := strconv.ParseInt(m[Priority].(string), 10, 4); err == nil {
+	message, ok := m[Message].(string)
+	if !ok {
+		return
+	}
+	fields.logBody = message
+	priority, _ := m[Priority].(string)
+	if priority, err := strconv.ParseInt(priority, 10, 4); err == nil {
 		switch priority {
 		case 0, 1:
 			fields.logSeverity = plog.SeverityNumberFatal.String()
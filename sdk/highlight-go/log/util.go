@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -19,6 +20,25 @@ const TimestampFormat = "2006-01-02T15:04:05.000Z"
 const TimestampFormatNano = "2006-01-02T15:04:05.999999999Z"
 const LogAttributeValueLengthLimit = 2 << 15
 
+// TruncateUTF8 shortens s to at most maxBytes bytes without splitting a multibyte character.
+func TruncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	if maxBytes <= 0 {
+		return ""
+	}
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	s = s[:end]
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	return s
+}
+
 type PinoLog struct {
 	Level    uint8  `json:"level"`
 	Time     int64  `json:"time"`
@@ -153,7 +173,7 @@ func SubmitHTTPLog(ctx context.Context, tracer trace.Tracer, projectID int, lg L
 func FormatLogAttributes(ctx context.Context, k string, v interface{}) map[string]string {
 	if vStr, ok := v.(string); ok {
 		if len(vStr) > LogAttributeValueLengthLimit {
-			vStr = vStr[:LogAttributeValueLengthLimit] + "..."
+			vStr = TruncateUTF8(vStr, LogAttributeValueLengthLimit) + "..."
 		}
 		return map[string]string{k: vStr}
 	}
@@ -0,0 +1,31 @@
+package hlog
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	// each emoji is 4 bytes and each CJK character is 3 bytes
+	s := strings.Repeat("😀", 4) + strings.Repeat("日本", 4)
+	for limit := 0; limit <= len(s); limit++ {
+		truncated := TruncateUTF8(s, limit)
+		assert.True(t, utf8.ValidString(truncated))
+		assert.LessOrEqual(t, len(truncated), limit)
+		assert.True(t, strings.HasPrefix(s, truncated))
+	}
+	assert.Equal(t, "😀", TruncateUTF8(s, 7))
+	assert.Equal(t, strings.Repeat("😀", 4)+"日", TruncateUTF8(s, 21))
+}
+
+func TestFormatLogAttributesTruncatesOnRuneBoundary(t *testing.T) {
+	// the limit falls in the middle of the last character
+	value := strings.Repeat("日", LogAttributeValueLengthLimit/3+1)
+	attrs := FormatLogAttributes(context.Background(), "key", value)
+	assert.True(t, utf8.ValidString(attrs["key"]))
+	assert.Equal(t, LogAttributeValueLengthLimit-LogAttributeValueLengthLimit%3+len("..."), len(attrs["key"]))
+}